@@ -4,6 +4,7 @@ import (
 	"context"
 	"log"
 	"net/http"
+	"net/netip"
 	"os/signal"
 	"syscall"
 	"time"
@@ -11,15 +12,19 @@ import (
 	"multi-tenant/internal/api"
 	"multi-tenant/internal/auth"
 	"multi-tenant/internal/config"
+	"multi-tenant/internal/ingest"
 	"multi-tenant/internal/manager"
 	"multi-tenant/internal/messaging"
 	"multi-tenant/internal/metrics"
+	"multi-tenant/internal/plan"
 	"multi-tenant/internal/storage"
+	"multi-tenant/internal/worker"
 
 	_ "multi-tenant/docs" // swagger generated docs
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"github.com/segmentio/kafka-go"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -33,6 +38,10 @@ import (
 // @securityDefinitions.apikey ApiKeyAuth
 // @in header
 // @name Authorization
+
+// @securityDefinitions.apikey AdminAuth
+// @in header
+// @name X-Admin-Token
 func main() {
 	// Init Metrics
 	metrics.Init()
@@ -47,25 +56,98 @@ func main() {
 	// Setup JWT Secret
 	auth.SetSecret(cfg.Auth.JWTSecret)
 
-	// Init PostgreSQL
-	db, err := storage.NewStorage(cfg.Database.URL)
-	if err != nil {
-		log.Fatalf("Failed to init DB: %v", err)
+	// Init storage
+	dedupWindow := time.Duration(cfg.Ingest.DedupWindowMinutes) * time.Minute
+	var db storage.Store
+	switch cfg.Database.Driver {
+	case "", "postgres":
+		pg, err := storage.NewStorage(cfg.Database.URL)
+		if err != nil {
+			log.Fatalf("Failed to init DB: %v", err)
+		}
+		pg.DedupWindow = dedupWindow
+		if cfg.Database.PoolSize > 0 {
+			pg.DB.SetMaxOpenConns(cfg.Database.PoolSize)
+		}
+		db = pg
+		log.Println("PostgreSQL connected")
+	case "memory":
+		mem := storage.NewMemoryStore()
+		mem.DedupWindow = dedupWindow
+		db = mem
+		log.Println("Using in-memory storage")
+	default:
+		log.Fatalf("Unknown database driver %q", cfg.Database.Driver)
+	}
+	if cfg.Database.PoolSize > 0 && cfg.Database.ReservedConnections >= cfg.Database.PoolSize {
+		log.Fatalf("database.reserved_connections (%d) must be below database.pool_size (%d)",
+			cfg.Database.ReservedConnections, cfg.Database.PoolSize)
+	}
+	// Without a pool size tenants are still held to max_per_tenant
+	if cfg.Database.PoolSize > 0 || cfg.Database.MaxPerTenant > 0 {
+		db = storage.NewIsolatedStore(db, cfg.Database.PoolSize, cfg.Database.ReservedConnections, cfg.Database.MaxPerTenant)
 	}
-	defer db.DB.Close()
-	log.Println("PostgreSQL connected")
+	defer db.Close()
 
-	// Init RabbitMQ
-	rabbitClient, err := messaging.NewRabbitClient(cfg.RabbitMQ.URL)
-	if err != nil {
-		log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+	// Init broker
+	var broker messaging.Broker
+	switch cfg.Broker {
+	case "", "rabbitmq":
+		rabbitClient, err := messaging.NewRabbitClient(cfg.RabbitMQ.URL)
+		if err != nil {
+			log.Fatalf("Failed to connect to RabbitMQ: %v", err)
+		}
+		rabbitClient.ManagementURL = cfg.RabbitMQ.ManagementURL
+		broker = rabbitClient
+		log.Println("RabbitMQ connected")
+	case "nats":
+		natsClient, err := messaging.NewNATSClient(cfg.NATS.URL)
+		if err != nil {
+			log.Fatalf("Failed to connect to NATS: %v", err)
+		}
+		broker = natsClient
+		log.Println("NATS connected")
+	case "memory":
+		broker = messaging.NewMemoryBroker()
+		log.Println("Using in-memory broker")
+	default:
+		log.Fatalf("Unknown broker %q", cfg.Broker)
 	}
-	defer rabbitClient.Close()
-	log.Println("RabbitMQ connected")
+	defer broker.Close()
 
 	// Init TenantManager
-	rabbitConn := rabbitClient.GetConnection() // use connection from exposed channel
-	tm := manager.NewTenantManager(rabbitConn, rabbitClient, db)
+	tm := manager.NewTenantManager(broker, db)
+	tm.SetBatchConfig(cfg.Ingest.BatchSize, time.Duration(cfg.Ingest.FlushIntervalMS)*time.Millisecond)
+	plans, err := plan.NewCatalog(cfg.Plans, cfg.DefaultPlan)
+	if err != nil {
+		log.Fatalf("invalid plans: %v", err)
+	}
+	tm.SetPlans(plans)
+	tm.SetWorkerBudget(cfg.WorkerBudget.Total, cfg.WorkerBudget.MinPerTenant)
+	tm.SetAutoscaler(manager.NewAutoscaler(manager.AutoscaleConfig{
+		Enabled:           cfg.Autoscale.Enabled,
+		Interval:          time.Duration(cfg.Autoscale.IntervalSeconds) * time.Second,
+		MinWorkers:        cfg.Autoscale.MinWorkers,
+		MaxWorkers:        cfg.Autoscale.MaxWorkers,
+		TargetLatency:     time.Duration(cfg.Autoscale.TargetLatencyMS) * time.Millisecond,
+		ScaleUpCooldown:   time.Duration(cfg.Autoscale.ScaleUpCooldownSeconds) * time.Second,
+		ScaleDownCooldown: time.Duration(cfg.Autoscale.ScaleDownCooldownSeconds) * time.Second,
+	}))
+
+	// Webhooks reach public addresses and the allowed networks only
+	if len(cfg.Webhooks.AllowedNetworks) > 0 {
+		allow := make([]netip.Prefix, 0, len(cfg.Webhooks.AllowedNetworks))
+		for _, n := range cfg.Webhooks.AllowedNetworks {
+			p, err := netip.ParsePrefix(n)
+			if err != nil {
+				log.Fatalf("invalid webhooks.allowed_networks entry %q: %v", n, err)
+			}
+			allow = append(allow, p)
+		}
+		handlers := worker.NewRegistry()
+		handlers.Register("webhook", worker.NewWebhookFactory(allow))
+		tm.SetHandlerRegistry(handlers)
+	}
 
 	// Load tenants from DB and start pools
 	tenants, err := db.ListTenants()
@@ -73,23 +155,31 @@ func main() {
 		log.Fatalf("failed to list tenants: %v", err)
 	}
 	for _, t := range tenants {
-		if err := tm.AddTenant(t.ID); err != nil {
+		if err := tm.AddTenant(t.ID, t.Settings); err != nil {
 			log.Printf("warn: add tenant %s: %v", t.ID, err)
 			continue
 		}
-		if err := tm.SetWorkerCount(t.ID.String(), t.Concurrency); err != nil {
+		// Workers above a plan's maximum since lowered are dropped
+		p, err := tm.Plan(t.ID)
+		if err != nil {
+			log.Printf("warn: plan of tenant %s: %v", t.ID, err)
+			continue
+		}
+		if err := tm.SetWorkerCount(t.ID.String(), p.Workers(t.Concurrency)); err != nil {
 			log.Printf("warn: set concurrency %s: %v", t.ID, err)
 		}
 	}
 
-	// Prometheus loop
+	// Forget expired idempotency keys
 	go func() {
-		ticker := time.NewTicker(10 * time.Second)
+		ticker := time.NewTicker(time.Hour)
 		defer ticker.Stop()
 
 		for range ticker.C {
-			for _, tid := range tm.ListTenantIDs() {
-				rabbitClient.UpdateQueueDepth(tid)
+			if n, err := db.PruneDedup(); err != nil {
+				log.Printf("warn: prune dedup keys: %v", err)
+			} else if n > 0 {
+				log.Printf("Pruned %d expired idempotency keys", n)
 			}
 		}
 	}()
@@ -115,6 +205,44 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
 	defer stop()
 
+	// Publish scheduled messages as they fall due
+	go tm.RunScheduler(ctx)
+
+	// Store publish usage for the monthly quotas
+	go tm.RunLimiter(ctx)
+
+	// Add metered usage to the hourly ledger
+	go tm.RunMeter(ctx)
+
+	// Share the worker budget as tenants' demand changes
+	go tm.RunBudget(ctx)
+
+	// Export queue depths and autoscale tenant workers
+	go tm.RunAutoscaler(ctx)
+
+	// Delete stored messages past their plan's retention
+	go tm.RunRetention(ctx)
+
+	// Kafka ingestion
+	kafkaDone := make(chan struct{})
+	if cfg.Kafka.Enabled {
+		reader := kafka.NewReader(kafka.ReaderConfig{
+			Brokers: cfg.Kafka.Brokers,
+			Topic:   cfg.Kafka.Topic,
+			GroupID: cfg.Kafka.GroupID,
+		})
+		source := ingest.NewKafkaSource(reader, tm, cfg.Kafka.TenantHeader)
+		go func() {
+			defer close(kafkaDone)
+			log.Printf("Consuming Kafka topic %s", cfg.Kafka.Topic)
+			if err := source.Run(ctx); err != nil {
+				log.Printf("Kafka source stopped: %v", err)
+			}
+		}()
+	} else {
+		close(kafkaDone)
+	}
+
 	go func() {
 		log.Println("🚀 Starting API server on port 8080")
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -134,6 +262,9 @@ func main() {
 		log.Printf("HTTP shutdown error: %v", err)
 	}
 
+	// Let the Kafka source finish its current record
+	<-kafkaDone
+
 	// Stop all tenant consumers
 	tm.ShutdownAll()
 
@@ -12,13 +12,13 @@ import (
 
 type API struct {
 	TenantMgr  *manager.TenantManager
-	Storage    *storage.Storage
+	Storage    storage.Store
 	WorkerPool map[uuid.UUID]*worker.WorkerPool
 	Cfg        *config.Config
 	Routers    *chi.Mux
 }
 
-func NewAPI(tm *manager.TenantManager, db *storage.Storage, cfg *config.Config, r *chi.Mux) *API {
+func NewAPI(tm *manager.TenantManager, db storage.Store, cfg *config.Config, r *chi.Mux) *API {
 	return &API{
 		TenantMgr:  tm,
 		Storage:    db,
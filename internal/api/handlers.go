@@ -1,14 +1,30 @@
 package api
 
 import (
+	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
+	"math"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/google/uuid"
 
 	"multi-tenant/internal/auth"
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+	"multi-tenant/internal/ratelimit"
+	"multi-tenant/internal/storage"
+	"multi-tenant/internal/worker"
 )
 
 func (a *API) Router() http.Handler {
@@ -21,26 +37,97 @@ func (a *API) Router() http.Handler {
 		r.Use(auth.JWTAuthMiddleware)
 
 		r.Put("/tenants/{id}/config/concurrency", a.UpdateConcurrency)
+		r.Put("/tenants/{id}/config/ordering", a.UpdateOrdering)
+		r.Put("/tenants/{id}/config/limits", a.UpdateQueueLimits)
+		r.Put("/tenants/{id}/config/autoscale", a.UpdateAutoscale)
+		r.Get("/tenants/{id}/autoscale", a.GetAutoscale)
+		r.Get("/tenants/{id}/config/handlers", a.GetHandlers)
+		r.Put("/tenants/{id}/config/handlers", a.UpdateHandlers)
+		r.Post("/messages", a.PublishMessage)
 		r.Get("/messages", a.ListMessages)
+		r.Get("/messages/search", a.SearchMessages)
+		r.Get("/messages/scheduled", a.ListScheduledMessages)
+		r.Post("/messages/replay", a.ReplayMessages)
+		r.Get("/usage", a.GetUsage)
+		r.Delete("/messages/scheduled/{id}", a.CancelScheduledMessage)
+		r.Get("/messages/{id}", a.GetMessage)
+		r.Get("/bindings", a.ListBindings)
+		r.Post("/bindings", a.AddBinding)
+		r.Delete("/bindings", a.RemoveBinding)
+		r.Get("/subscriptions", a.ListSubscriptions)
+		r.Post("/subscriptions", a.RequestSubscription)
+		r.Post("/subscriptions/{id}/approve", a.ApproveSubscription)
+		r.Delete("/subscriptions/{id}", a.RevokeSubscription)
+	})
+
+	// Admin
+	a.Routers.Group(func(r chi.Router) {
+		r.Use(auth.AdminMiddleware(a.Cfg.Auth.AdminToken))
+
+		r.Get("/admin/tenants/{id}/publish-limits", a.GetPublishLimits)
+		r.Put("/admin/tenants/{id}/publish-limits", a.UpdatePublishLimits)
+		r.Get("/admin/usage/export", a.ExportUsage)
+		r.Get("/admin/plans", a.ListPlans)
+		r.Get("/admin/tenants/{id}/plan", a.GetTenantPlan)
+		r.Put("/admin/tenants/{id}/plan", a.UpdateTenantPlan)
+		r.Put("/admin/tenants/{id}/weight", a.UpdateTenantWeight)
 	})
 
 	return a.Routers
 }
 
 // @Summary Create a tenant
+// @Description Settings are optional and fixed at creation; max_priority (1-255) makes the
+// @Description tenant queue a priority queue. queue_type is classic (default), quorum or stream;
+// @Description delivery_limit sets how often a quorum queue redelivers a failing message.
+// @Description limits cap the queue length, size and message age and can be changed later.
+// @Description New tenants get the default plan; settings must fit it and workers are capped at
+// @Description its maximum. handlers pick the chain of handlers each message runs through by
+// @Description event type. plan, publish_limits, plan_overrides and weight are ignored;
+// @Description administrators set them through the admin API.
 // @Tags Tenants
+// @Accept json
 // @Produce json
+// @Param body body model.TenantSettings false "Tenant settings"
 // @Success 200 {object} map[string]string
+// @Failure 400 {string} string "invalid tenant settings"
+// @Failure 403 {string} string "not included in the plan"
+// @Failure 501 {string} string "not supported by this broker"
 // @Router /tenants [post]
 func (a *API) CreateTenant(w http.ResponseWriter, r *http.Request) {
 	id := uuid.New()
 
-	if err := a.TenantMgr.AddTenant(id); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var settings model.TenantSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "invalid tenant settings", http.StatusBadRequest)
+		return
+	}
+	settings.Plan = ""
+	settings.PublishLimits = nil
+	settings.PlanOverrides = nil
+	settings.Weight = 0
+
+	if err := a.TenantMgr.AddTenant(id, settings); err != nil {
+		switch {
+		case errors.Is(err, messaging.ErrInvalidQueueOptions), errors.Is(err, worker.ErrInvalidOrderingKey),
+			errors.Is(err, worker.ErrInvalidHandler):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		case errors.Is(err, plan.ErrFeatureDisabled), errors.Is(err, plan.ErrLimitExceeded):
+			http.Error(w, err.Error(), http.StatusForbidden)
+		case errors.Is(err, messaging.ErrUnsupported):
+			http.Error(w, err.Error(), http.StatusNotImplemented)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
 		return
 	}
 
-	if err := a.TenantMgr.SetWorkerCount(id.String(), a.Cfg.Workers); err != nil {
+	p, err := a.TenantMgr.Plan(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := a.TenantMgr.SetWorkerCount(id.String(), p.Workers(a.Cfg.Workers)); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
@@ -78,6 +165,9 @@ func (a *API) DeleteTenant(w http.ResponseWriter, r *http.Request) {
 // @Security ApiKeyAuth
 // @Param body body ConcurrencyConfig true "Concurrency config"
 // @Success 204
+// @Failure 400 {string} string "workers must be positive"
+// @Failure 403 {string} string "exceeds plan limit"
+// @Failure 404 {string} string "tenant not found"
 // @Router /tenants/{id}/config/concurrency [put]
 func (a *API) UpdateConcurrency(w http.ResponseWriter, r *http.Request) {
 	tenantStr := auth.GetTenantID(r)
@@ -93,22 +183,287 @@ func (a *API) UpdateConcurrency(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := a.TenantMgr.SetWorkerCount(id.String(), a.Cfg.Workers); err != nil {
+	if body.Workers <= 0 {
+		http.Error(w, "workers must be positive", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetWorkerCount(id.String(), body.Workers)
+	switch {
+	case errors.Is(err, plan.ErrLimitExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.Error(w, "tenant not found", http.StatusNotFound)
+	w.WriteHeader(http.StatusNoContent)
 }
 
-// @Summary List messages by tenant
+// @Summary Update the key that keeps related messages in order
+// @Description Messages with the same key are processed one at a time, in order, while
+// @Description others run on the remaining workers. The key is read from a header or a
+// @Description JSON path into the payload; an empty body restores the x-ordering-key header.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Accept json
+// @Param body body model.OrderingKey false "Ordering key"
+// @Success 204
+// @Failure 400 {string} string "invalid ordering key"
+// @Router /tenants/{id}/config/ordering [put]
+func (a *API) UpdateOrdering(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var ordering *model.OrderingKey
+	if err := json.NewDecoder(r.Body).Decode(&ordering); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetOrdering(id, ordering)
+	switch {
+	case errors.Is(err, worker.ErrInvalidOrderingKey):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Update the tenant queue limits
+// @Description Applies max_length, max_length_bytes, message_ttl_ms and the overflow policy
+// @Description (drop-head, reject-publish or dead-letter) to the existing queue without
+// @Description redeclaring it; an empty body removes the limits. Limits left unset, and those
+// @Description of an empty body, are the plan's, which they may not exceed.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Accept json
+// @Param body body model.QueueLimits false "Queue limits"
+// @Success 204
+// @Failure 400 {string} string "invalid queue limits"
+// @Failure 403 {string} string "exceeds plan limit"
+// @Failure 501 {string} string "not supported by this broker"
+// @Router /tenants/{id}/config/limits [put]
+func (a *API) UpdateQueueLimits(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var limits *model.QueueLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetQueueLimits(id, limits)
+	switch {
+	case errors.Is(err, messaging.ErrInvalidQueueOptions):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, plan.ErrLimitExceeded):
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	case errors.Is(err, messaging.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Update the tenant's autoscaling
+// @Description While enabled, workers are added when messages wait longer than target_latency_ms
+// @Description and removed once they wait less than half of it, between min_workers and
+// @Description max_workers (capped by the plan). An empty body restores the server defaults.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Accept json
+// @Param body body model.Autoscale false "Autoscale settings"
+// @Success 204
+// @Failure 400 {string} string "invalid autoscale settings"
+// @Router /tenants/{id}/config/autoscale [put]
+func (a *API) UpdateAutoscale(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var settings *model.Autoscale
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetAutoscale(id, settings)
+	switch {
+	case errors.Is(err, manager.ErrInvalidAutoscale):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get the tenant's autoscaling status
+// @Description Returns the effective settings, the queue depth, processing rate and latency last
+// @Description observed, and the most recent worker changes with their reasons.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {object} manager.AutoscaleStatus
+// @Failure 404 {string} string "tenant not found"
+// @Router /tenants/{id}/autoscale [get]
+func (a *API) GetAutoscale(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	status, err := a.TenantMgr.AutoscaleStatus(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(status)
+}
+
+// @Summary Get the tenant's message handlers
+// @Description Returns the routes that pick a chain of handlers by event type; an empty list
+// @Description means every message is stored.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} model.HandlerRoute
+// @Failure 404 {string} string "tenant not found"
+// @Router /tenants/{id}/config/handlers [get]
+func (a *API) GetHandlers(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	routes, err := a.TenantMgr.Handlers(id)
+	switch {
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if routes == nil {
+		routes = []model.HandlerRoute{}
+	}
+
+	json.NewEncoder(w).Encode(routes)
+}
+
+// @Summary Update the tenant's message handlers
+// @Description Each route runs its handlers in order on messages whose event type matches
+// @Description event_types (e.g. "order.*" or "#"); the first matching route wins and messages
+// @Description no route matches are stored. Handler types are persist, webhook (url, headers,
+// @Description timeout_ms), transform (set, remove), validate (required, types, max_bytes) and
+// @Description drop. Messages a handler rejects are dead-lettered. An empty body stores every
+// @Description message. Changes apply to the next messages without restarting the consumer.
+// @Tags Tenants
+// @Security ApiKeyAuth
+// @Accept json
+// @Param body body []model.HandlerRoute false "Handler routes"
+// @Success 204
+// @Failure 400 {string} string "invalid handler"
+// @Failure 404 {string} string "tenant not found"
+// @Router /tenants/{id}/config/handlers [put]
+func (a *API) UpdateHandlers(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	id, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var routes []model.HandlerRoute
+	if err := json.NewDecoder(r.Body).Decode(&routes); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetHandlers(id, routes)
+	switch {
+	case errors.Is(err, worker.ErrInvalidHandler):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Publish a message to the tenant queue
+// @Description The request body is the JSON payload. Retried requests carrying the same
+// @Description Idempotency-Key are stored only once within the deduplication window.
+// @Description The message is routed as <tenant>.<event_type> to the tenant queue and to
+// @Description any other tenant queue with a matching binding. With deliver_at or delay
+// @Description the message is held until then and the scheduled message is returned.
 // @Tags Messages
 // @Security ApiKeyAuth
+// @Accept json
 // @Produce json
-// @Param cursor query string false "Pagination cursor"
-// @Success 200 {object} map[string]interface{}
-// @Router /messages [get]
-func (a *API) ListMessages(w http.ResponseWriter, r *http.Request) {
+// @Param Idempotency-Key header string false "Deduplication key"
+// @Param Ordering-Key header string false "Messages with the same key are processed in order"
+// @Param event_type query string false "Dot-separated event type, e.g. order.created"
+// @Param priority query int false "Priority (0-255) within a priority queue; higher is delivered first"
+// @Param deliver_at query string false "Deliver at this RFC3339 time"
+// @Param delay query string false "Deliver after this duration, e.g. 90s or 2h"
+// @Param body body object true "Message payload"
+// @Success 202 {object} model.ScheduledMessage "Only when delivery is delayed"
+// @Failure 400 {string} string "payload must be valid JSON"
+// @Failure 403 {string} string "scheduling not included in the plan"
+// @Failure 429 {string} string "publish rate limit or monthly quota exceeded"
+// @Failure 503 {string} string "tenant queue is full"
+// @Router /messages [post]
+func (a *API) PublishMessage(w http.ResponseWriter, r *http.Request) {
 	tenantStr := auth.GetTenantID(r)
 	tenantID, err := uuid.Parse(tenantStr)
 	if err != nil {
@@ -116,17 +471,949 @@ func (a *API) ListMessages(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cursorStr := r.URL.Query().Get("cursor")
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+	if !json.Valid(body) {
+		http.Error(w, "payload must be valid JSON", http.StatusBadRequest)
+		return
+	}
+
+	var opts []messaging.PublishOption
+	if key := r.Header.Get("Idempotency-Key"); key != "" {
+		opts = append(opts, messaging.WithMessageID(key))
+	}
+	if key := r.Header.Get("Ordering-Key"); key != "" {
+		opts = append(opts, messaging.WithOrderingKey(key))
+	}
+	if eventType := r.URL.Query().Get("event_type"); eventType != "" {
+		if err := messaging.ValidateEventType(eventType); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, messaging.WithEventType(eventType))
+	}
+	if v := r.URL.Query().Get("priority"); v != "" {
+		p, err := strconv.ParseUint(v, 10, 8)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid priority %q", v), http.StatusBadRequest)
+			return
+		}
+		opts = append(opts, messaging.WithPriority(uint8(p)))
+	}
+
+	deliverAt, err := parseDeliverAt(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if deliverAt.After(time.Now()) {
+		opts = append(opts, messaging.WithDeliverAt(deliverAt))
+		sm, err := a.TenantMgr.Schedule(tenantID, body, opts...)
+		if err != nil {
+			switch {
+			case writeLimitError(w, err):
+			case errors.Is(err, plan.ErrFeatureDisabled):
+				http.Error(w, err.Error(), http.StatusForbidden)
+			default:
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(sm)
+		return
+	}
+
+	if err := a.TenantMgr.Publish(tenantID, body, opts...); err != nil {
+		switch {
+		case writeLimitError(w, err):
+		case errors.Is(err, messaging.ErrQueueFull):
+			http.Error(w, "tenant queue is full", http.StatusServiceUnavailable)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// writeLimitError answers a publish refused by the tenant's publish
+// limits with 429 and a Retry-After in whole seconds, reporting whether
+// err was one
+func writeLimitError(w http.ResponseWriter, err error) bool {
+	var limitErr *ratelimit.LimitError
+	if !errors.As(err, &limitErr) {
+		return false
+	}
+	seconds := int(math.Ceil(limitErr.RetryAfter.Seconds()))
+	w.Header().Set("Retry-After", strconv.Itoa(max(seconds, 1)))
+	http.Error(w, limitErr.Error(), http.StatusTooManyRequests)
+	return true
+}
+
+// @Summary Get a tenant's publish limits and usage this month
+// @Tags Admin
+// @Security AdminAuth
+// @Produce json
+// @Param id path string true "Tenant UUID"
+// @Success 200 {object} PublishLimitsResponse
+// @Failure 404 {string} string "tenant not found"
+// @Router /admin/tenants/{id}/publish-limits [get]
+func (a *API) GetPublishLimits(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tenant id", http.StatusBadRequest)
+		return
+	}
 
-	messages, nextCursor, err := a.Storage.ListMessagesPaginated(tenantID, cursorStr, 10)
+	limits, usage, err := a.TenantMgr.PublishLimits(id)
+	if errors.Is(err, manager.ErrTenantNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	resp := map[string]interface{}{
-		"data":        messages,
-		"next_cursor": nextCursor,
+	json.NewEncoder(w).Encode(PublishLimitsResponse{Limits: limits, Usage: usage})
+}
+
+// @Summary Update a tenant's publish rate limits and monthly quotas
+// @Description Publishes over a rate or quota are refused with 429 and Retry-After. Rates
+// @Description allow bursts of one second's worth; an empty body removes all limits.
+// @Tags Admin
+// @Security AdminAuth
+// @Accept json
+// @Param id path string true "Tenant UUID"
+// @Param body body model.PublishLimits false "Publish limits"
+// @Success 204
+// @Failure 400 {string} string "invalid publish limits"
+// @Failure 404 {string} string "tenant not found"
+// @Router /admin/tenants/{id}/publish-limits [put]
+func (a *API) UpdatePublishLimits(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tenant id", http.StatusBadRequest)
+		return
 	}
-	json.NewEncoder(w).Encode(resp)
+
+	var limits *model.PublishLimits
+	if err := json.NewDecoder(r.Body).Decode(&limits); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetPublishLimits(id, limits)
+	switch {
+	case errors.Is(err, ratelimit.ErrInvalidLimits):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API: Updated publish limits of tenant %s", id)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List the plans tenants can be on
+// @Tags Admin
+// @Security AdminAuth
+// @Produce json
+// @Success 200 {array} model.Plan
+// @Router /admin/plans [get]
+func (a *API) ListPlans(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(a.TenantMgr.Plans())
+}
+
+// @Summary Get a tenant's plan
+// @Tags Admin
+// @Security AdminAuth
+// @Produce json
+// @Param id path string true "Tenant UUID"
+// @Success 200 {object} TenantPlanResponse
+// @Failure 404 {string} string "tenant not found"
+// @Router /admin/tenants/{id}/plan [get]
+func (a *API) GetTenantPlan(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tenant id", http.StatusBadRequest)
+		return
+	}
+
+	effective, err := a.TenantMgr.Plan(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	t, err := a.Storage.GetTenant(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(TenantPlanResponse{
+		Plan:      t.Settings.Plan,
+		Overrides: t.Settings.PlanOverrides,
+		Effective: effective,
+	})
+}
+
+// @Summary Move a tenant to another plan
+// @Description The plan's limits apply at once, with overrides replacing the tenant's current
+// @Description ones. Workers above the new maximum are stopped; an existing queue keeps its type.
+// @Tags Admin
+// @Security AdminAuth
+// @Accept json
+// @Param id path string true "Tenant UUID"
+// @Param body body TenantPlanRequest true "Plan and overrides"
+// @Success 204
+// @Failure 400 {string} string "unknown plan"
+// @Failure 404 {string} string "tenant not found"
+// @Failure 501 {string} string "not supported by this broker"
+// @Router /admin/tenants/{id}/plan [put]
+func (a *API) UpdateTenantPlan(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tenant id", http.StatusBadRequest)
+		return
+	}
+
+	var body TenantPlanRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetPlan(id, body.Plan, body.Overrides)
+	switch {
+	case errors.Is(err, plan.ErrUnknownPlan), errors.Is(err, plan.ErrInvalidPlan),
+		errors.Is(err, ratelimit.ErrInvalidLimits), errors.Is(err, messaging.ErrInvalidQueueOptions):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, messaging.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API: Moved tenant %s to plan %q", id, body.Plan)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Update a tenant's share of the global worker budget
+// @Description Busy tenants share the workers in proportion to their weights; zero counts as 1.
+// @Tags Admin
+// @Security AdminAuth
+// @Accept json
+// @Param id path string true "Tenant UUID"
+// @Param body body WeightRequest true "Weight"
+// @Success 204
+// @Failure 400 {string} string "invalid weight"
+// @Failure 404 {string} string "tenant not found"
+// @Router /admin/tenants/{id}/weight [put]
+func (a *API) UpdateTenantWeight(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid tenant id", http.StatusBadRequest)
+		return
+	}
+
+	var body WeightRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.SetWeight(id, body.Weight)
+	switch {
+	case errors.Is(err, manager.ErrInvalidWeight):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	log.Printf("API: Set weight of tenant %s to %d", id, body.Weight)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary Get the tenant's hourly usage
+// @Description Hours are UTC; from is rounded down to the hour. The latest hour may lag by a few seconds.
+// @Tags Usage
+// @Security ApiKeyAuth
+// @Produce json
+// @Param from query string false "RFC3339 start, default the start of this month"
+// @Param to query string false "RFC3339 end (exclusive), default now"
+// @Success 200 {object} UsageResponse
+// @Failure 400 {string} string "invalid time range"
+// @Router /usage [get]
+func (a *API) GetUsage(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil || tenantID == uuid.Nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	from, to, err := parseUsageRange(r.URL.Query(), time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	records, err := a.TenantMgr.Usage(tenantID, from, to)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := UsageResponse{From: from, To: to, Records: records}
+	for _, rec := range records {
+		resp.Total.Add(rec.Usage)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
+
+// @Summary Export the usage ledger for billing
+// @Description Rows are per tenant and UTC hour, ordered by tenant then hour, and include deleted tenants.
+// @Tags Admin
+// @Security AdminAuth
+// @Produce json,text/csv
+// @Param from query string false "RFC3339 start, default the start of this month"
+// @Param to query string false "RFC3339 end (exclusive), default now"
+// @Param tenant_id query string false "Only this tenant"
+// @Param format query string false "csv (default) or json"
+// @Success 200 {array} model.UsageRecord
+// @Failure 400 {string} string "invalid export parameters"
+// @Router /admin/usage/export [get]
+func (a *API) ExportUsage(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	from, to, err := parseUsageRange(q, time.Now())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var tenantID uuid.UUID
+	if v := q.Get("tenant_id"); v != "" {
+		if tenantID, err = uuid.Parse(v); err != nil || tenantID == uuid.Nil {
+			http.Error(w, "invalid tenant id", http.StatusBadRequest)
+			return
+		}
+	}
+	format := q.Get("format")
+	if format != "" && format != "csv" && format != "json" {
+		http.Error(w, fmt.Sprintf("invalid format %q", format), http.StatusBadRequest)
+		return
+	}
+
+	var records []model.UsageRecord
+	if tenantID == uuid.Nil {
+		records, err = a.TenantMgr.AllUsage(from, to)
+	} else {
+		records, err = a.TenantMgr.Usage(tenantID, from, to)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if format == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(records)
+		return
+	}
+
+	filename := fmt.Sprintf("usage-%s-%s.csv", from.Format("20060102T15"), to.Format("20060102T15"))
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"tenant_id", "hour", "published", "processed", "failed", "bytes_stored"})
+	for _, rec := range records {
+		cw.Write([]string{
+			rec.TenantID.String(),
+			rec.Hour.Format(time.RFC3339),
+			strconv.FormatInt(rec.Published, 10),
+			strconv.FormatInt(rec.Processed, 10),
+			strconv.FormatInt(rec.Failed, 10),
+			strconv.FormatInt(rec.BytesStored, 10),
+		})
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		log.Printf("API: usage export failed: %v", err)
+	}
+}
+
+// @Summary List messages by tenant
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Produce json
+// @Param cursor query string false "Opaque pagination cursor (next_cursor or prev_cursor)"
+// @Param limit query int false "Page size (max 100)"
+// @Param order query string false "Sort direction (asc or desc)"
+// @Param from query string false "Only messages created at or after this RFC3339 time"
+// @Param to query string false "Only messages created before this RFC3339 time"
+// @Param filter[field] query string false "Match a top-level payload field, e.g. filter[event]=created"
+// @Success 200 {object} storage.MessagePage
+// @Failure 400 {string} string "invalid query parameter"
+// @Router /messages [get]
+func (a *API) ListMessages(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	filter, err := parseMessageFilter(r.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	cursorStr := r.URL.Query().Get("cursor")
+
+	page, err := a.Storage.ListMessagesPaginated(tenantID, cursorStr, filter)
+	if errors.Is(err, storage.ErrInvalidCursor) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// @Summary Get a message by ID
+// @Description Returns the payload together with the delivery metadata recorded when it was consumed
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Message UUID"
+// @Success 200 {object} model.Message
+// @Failure 404 {string} string "message not found"
+// @Router /messages/{id} [get]
+func (a *API) GetMessage(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid message id", http.StatusBadRequest)
+		return
+	}
+
+	msg, err := a.Storage.GetMessage(tenantID, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(msg)
+}
+
+// @Summary Search messages by content
+// @Description Full-text search over payload string values (websearch syntax) and/or a JSONPath
+// @Description predicate over the JSONB payload. Text matches are ordered by relevance.
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Produce json
+// @Param q query string false "Full-text query, e.g. refund -failed"
+// @Param jsonpath query string false "SQL/JSON path, e.g. $ ? (@.amount > 100)"
+// @Param limit query int false "Page size (max 100)"
+// @Param cursor query string false "Opaque pagination cursor (next_cursor or prev_cursor)"
+// @Success 200 {object} storage.MessagePage
+// @Failure 400 {string} string "invalid search query"
+// @Router /messages/search [get]
+func (a *API) SearchMessages(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	q := r.URL.Query()
+	search := storage.SearchQuery{
+		Text:     q.Get("q"),
+		JSONPath: q.Get("jsonpath"),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, fmt.Sprintf("invalid limit %q", v), http.StatusBadRequest)
+			return
+		}
+		search.Limit = n
+	}
+
+	page, err := a.Storage.SearchMessages(tenantID, q.Get("cursor"), search)
+	if errors.Is(err, storage.ErrInvalidCursor) || errors.Is(err, storage.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(page)
+}
+
+// @Summary List the tenant's undelivered scheduled messages
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} model.ScheduledMessage
+// @Router /messages/scheduled [get]
+func (a *API) ListScheduledMessages(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	scheduled, err := a.TenantMgr.ListScheduled(tenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(scheduled)
+}
+
+// @Summary Replay the tenant's stream queue from an offset
+// @Description Restarts consuming a stream queue tenant at from, which is first, last, next,
+// @Description a numeric offset or an RFC3339 time. Messages already stored are skipped.
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Param from query string true "Stream offset"
+// @Success 202
+// @Failure 400 {string} string "invalid stream offset"
+// @Failure 409 {string} string "tenant queue is not a stream"
+// @Router /messages/replay [post]
+func (a *API) ReplayMessages(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+	offset, err := messaging.ParseStreamOffset(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid stream offset", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.Replay(tenantID, offset)
+	switch {
+	case errors.Is(err, manager.ErrNotStream):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// @Summary Cancel a scheduled message before it is delivered
+// @Tags Messages
+// @Security ApiKeyAuth
+// @Param id path string true "Scheduled message UUID"
+// @Success 204
+// @Failure 404 {string} string "scheduled message not found"
+// @Router /messages/scheduled/{id} [delete]
+func (a *API) CancelScheduledMessage(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid scheduled message id", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.CancelScheduled(tenantID, id)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "scheduled message not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List the tenant's extra topic bindings
+// @Tags Bindings
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} model.Binding
+// @Router /bindings [get]
+func (a *API) ListBindings(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	bindings, err := a.TenantMgr.ListBindings(tenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(bindings)
+}
+
+// @Summary Bind a topic pattern to the tenant queue
+// @Description Messages published under a routing key matching the pattern are copied
+// @Description into the tenant queue. The pattern must start with the caller's own tenant ID,
+// @Description e.g. <tenant>.order.* ("*" matches one word, "#" zero or more); other
+// @Description tenants' messages are received through subscriptions instead.
+// @Tags Bindings
+// @Security ApiKeyAuth
+// @Accept json
+// @Param body body BindingRequest true "Binding pattern"
+// @Success 201
+// @Failure 400 {string} string "invalid binding pattern"
+// @Failure 501 {string} string "not supported by this broker"
+// @Router /bindings [post]
+func (a *API) AddBinding(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var body BindingRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+
+	err = a.TenantMgr.AddBinding(tenantID, body.Pattern)
+	switch {
+	case errors.Is(err, messaging.ErrInvalidPattern):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, messaging.ErrUnsupported):
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+}
+
+// @Summary Remove a topic pattern from the tenant queue
+// @Tags Bindings
+// @Security ApiKeyAuth
+// @Param pattern query string true "Binding pattern"
+// @Success 204
+// @Failure 404 {string} string "binding not found"
+// @Router /bindings [delete]
+func (a *API) RemoveBinding(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	err = a.TenantMgr.RemoveBinding(tenantID, r.URL.Query().Get("pattern"))
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "binding not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// @Summary List subscriptions the tenant is the source or target of
+// @Tags Subscriptions
+// @Security ApiKeyAuth
+// @Produce json
+// @Success 200 {array} model.Subscription
+// @Router /subscriptions [get]
+func (a *API) ListSubscriptions(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	subs, err := a.TenantMgr.ListSubscriptions(tenantID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(subs)
+}
+
+// @Summary Request a subscription to another tenant's events
+// @Description Once the source tenant approves, its messages whose event type matches
+// @Description the pattern (e.g. order.*) are copied into the caller's queue.
+// @Tags Subscriptions
+// @Security ApiKeyAuth
+// @Accept json
+// @Produce json
+// @Param body body SubscriptionRequest true "Source tenant and event type pattern"
+// @Success 201 {object} model.Subscription
+// @Failure 400 {string} string "invalid binding pattern"
+// @Failure 404 {string} string "tenant not found"
+// @Router /subscriptions [post]
+func (a *API) RequestSubscription(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+
+	var body SubscriptionRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "bad request body", http.StatusBadRequest)
+		return
+	}
+	source, err := uuid.Parse(body.SourceTenantID)
+	if err != nil {
+		http.Error(w, "invalid source tenant id", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := a.TenantMgr.RequestSubscription(tenantID, source, body.Pattern)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(sub)
+}
+
+// @Summary Approve a pending subscription to the tenant's events
+// @Tags Subscriptions
+// @Security ApiKeyAuth
+// @Produce json
+// @Param id path string true "Subscription UUID"
+// @Success 200 {object} model.Subscription
+// @Failure 403 {string} string "only the source tenant can approve"
+// @Failure 409 {string} string "subscription is not pending"
+// @Router /subscriptions/{id}/approve [post]
+func (a *API) ApproveSubscription(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	sub, err := a.TenantMgr.ApproveSubscription(tenantID, id)
+	if err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(sub)
+}
+
+// @Summary Revoke a subscription as its source or target
+// @Tags Subscriptions
+// @Security ApiKeyAuth
+// @Param id path string true "Subscription UUID"
+// @Success 204
+// @Failure 404 {string} string "subscription not found"
+// @Router /subscriptions/{id} [delete]
+func (a *API) RevokeSubscription(w http.ResponseWriter, r *http.Request) {
+	tenantStr := auth.GetTenantID(r)
+	tenantID, err := uuid.Parse(tenantStr)
+	if err != nil {
+		http.Error(w, "unauthorized tenant", http.StatusUnauthorized)
+		return
+	}
+	id, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "invalid subscription id", http.StatusBadRequest)
+		return
+	}
+
+	if err := a.TenantMgr.RevokeSubscription(tenantID, id); err != nil {
+		writeSubscriptionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeSubscriptionError maps subscription errors to HTTP statuses
+func writeSubscriptionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, messaging.ErrInvalidPattern):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, manager.ErrNotAllowed):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, manager.ErrTenantNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, storage.ErrNotFound):
+		http.Error(w, "subscription not found", http.StatusNotFound)
+	case errors.Is(err, manager.ErrInvalidTransition):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// parseUsageRange reads the from and to query parameters of the usage
+// endpoints. from is rounded down to the ledger hour and defaults to the
+// start of the month; to defaults to now.
+func parseUsageRange(q url.Values, now time.Time) (from, to time.Time, err error) {
+	now = now.UTC()
+	from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to = now
+	if v := q.Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid from time %q", v)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			return from, to, fmt.Errorf("invalid to time %q", v)
+		}
+	}
+	from = from.UTC().Truncate(time.Hour)
+	to = to.UTC()
+	if !from.Before(to) {
+		return from, to, fmt.Errorf("from must be before to")
+	}
+	return from, to, nil
+}
+
+// parseMessageFilter builds a storage filter from GET /messages query parameters
+func parseMessageFilter(q url.Values) (storage.MessageFilter, error) {
+	var f storage.MessageFilter
+
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return f, fmt.Errorf("invalid limit %q", v)
+		}
+		f.Limit = n
+	}
+
+	order, err := storage.ParseSortOrder(q.Get("order"))
+	if err != nil {
+		return f, err
+	}
+	f.Order = order
+
+	if v := q.Get("from"); v != "" {
+		if f.From, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("invalid from time %q", v)
+		}
+	}
+	if v := q.Get("to"); v != "" {
+		if f.To, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("invalid to time %q", v)
+		}
+	}
+
+	for key, values := range q {
+		if !strings.HasPrefix(key, "filter[") || !strings.HasSuffix(key, "]") {
+			continue
+		}
+		field := key[len("filter[") : len(key)-1]
+		if field == "" {
+			return f, fmt.Errorf("empty filter field")
+		}
+		if f.Payload == nil {
+			f.Payload = make(map[string]string)
+		}
+		f.Payload[field] = values[0]
+	}
+
+	return f, nil
+}
+
+// parseDeliverAt reads the deliver_at or delay query parameter of
+// POST /messages; the zero time means deliver now
+func parseDeliverAt(q url.Values) (time.Time, error) {
+	at, delay := q.Get("deliver_at"), q.Get("delay")
+	switch {
+	case at != "" && delay != "":
+		return time.Time{}, fmt.Errorf("deliver_at and delay are mutually exclusive")
+	case at != "":
+		t, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid deliver_at time %q", at)
+		}
+		return t, nil
+	case delay != "":
+		d, err := time.ParseDuration(delay)
+		if err != nil || d < 0 {
+			return time.Time{}, fmt.Errorf("invalid delay %q", delay)
+		}
+		return time.Now().Add(d), nil
+	}
+	return time.Time{}, nil
 }
@@ -1,6 +1,59 @@
 package api
 
+import (
+	"time"
+
+	"multi-tenant/internal/model"
+)
+
 // ConcurrencyConfig represents worker config update request body
 type ConcurrencyConfig struct {
 	Workers int `json:"workers"`
 }
+
+// WeightRequest is the body of PUT /admin/tenants/{id}/weight
+type WeightRequest struct {
+	Weight int `json:"weight" example:"2"`
+}
+
+// BindingRequest is the body of POST /bindings
+type BindingRequest struct {
+	Pattern string `json:"pattern" example:"3f1c2d4e-0000-4000-8000-000000000000.order.*"`
+}
+
+// SubscriptionRequest is the body of POST /subscriptions
+type SubscriptionRequest struct {
+	SourceTenantID string `json:"source_tenant_id"`
+	Pattern        string `json:"pattern" example:"order.*"`
+}
+
+// PublishLimitsResponse is a tenant's publish limits and its usage this
+// month
+type PublishLimitsResponse struct {
+	Limits *model.PublishLimits `json:"limits"`
+	Usage  model.PublishUsage   `json:"usage"`
+}
+
+// UsageResponse is a tenant's hourly usage between From and To, and its
+// sum
+type UsageResponse struct {
+	From    time.Time           `json:"from"`
+	To      time.Time           `json:"to"`
+	Records []model.UsageRecord `json:"records"`
+	Total   model.Usage         `json:"total"`
+}
+
+// TenantPlanRequest is the body of PUT /admin/tenants/{id}/plan; an empty
+// plan selects the default plan
+type TenantPlanRequest struct {
+	Plan      string               `json:"plan" example:"standard"`
+	Overrides *model.PlanOverrides `json:"overrides,omitempty"`
+}
+
+// TenantPlanResponse is a tenant's plan, its overrides and the limits
+// that result
+type TenantPlanResponse struct {
+	Plan      string               `json:"plan" example:"standard"`
+	Overrides *model.PlanOverrides `json:"overrides,omitempty"`
+	Effective model.Plan           `json:"effective"`
+}
@@ -3,6 +3,7 @@ package auth
 
 import (
 	"context"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 )
@@ -11,6 +12,9 @@ type contextKey string
 
 const TenantIDKey contextKey = "tenant_id"
 
+// AdminTokenHeader carries the admin API token
+const AdminTokenHeader = "X-Admin-Token"
+
 func JWTAuthMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
@@ -39,3 +43,18 @@ func GetTenantID(r *http.Request) string {
 	}
 	return ""
 }
+
+// AdminMiddleware admits requests carrying the admin token; with an empty
+// token every request is refused
+func AdminMiddleware(token string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got := r.Header.Get(AdminTokenHeader)
+			if token == "" || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+				http.Error(w, "admin token required", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,68 +2,65 @@
 package consumer
 
 import (
-	"fmt"
 	"log"
-	"multi-tenant/internal/worker"
+	"sync"
 
-	"github.com/streadway/amqp"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/worker"
 )
 
-type MessageHandlerFunc func(tenantID string, delivery amqp.Delivery)
+type MessageHandlerFunc func(tenantID string, delivery messaging.Delivery)
 
 // Consumer holds control channels and metadata for a running tenant consumer
 type Consumer struct {
-	TenantID    string
-	QueueName   string
-	Channel     *amqp.Channel
-	StopChan    chan struct{}
-	DoneChan    chan struct{}
-	Handler     MessageHandlerFunc
-	ConsumerTag string
-	Pool        *worker.WorkerPool
-}
+	TenantID     string
+	QueueName    string
+	Subscription messaging.Subscription
+	StopChan     chan struct{}
+	DoneChan     chan struct{}
+	Handler      MessageHandlerFunc
+	Pool         *worker.WorkerPool
 
-// StartConsumer starts a goroutine that consumes messages for a tenant
-func StartConsumer(conn *amqp.Connection, tenantID string, handler MessageHandlerFunc) (*Consumer, error) {
-	ch, err := conn.Channel()
-	if err != nil {
-		return nil, fmt.Errorf("tenant %s: failed to open channel: %w", tenantID, err)
-	}
+	// Lanes runs Handler on one lane per worker, keeping messages with
+	// the same ordering key in order
+	Lanes *worker.Dispatcher
+
+	// OnStop runs after the consume loop exits but before the subscription
+	// is cancelled, so pending deliveries can still be acked
+	OnStop func()
 
-	queueName := fmt.Sprintf("tenant_%s_queue", tenantID)
-	consumerTag := fmt.Sprintf("consumer-%s", tenantID)
-
-	msgs, err := ch.Consume(
-		queueName,
-		consumerTag,
-		false, // autoAck: false to handle manually
-		false,
-		false,
-		false,
-		nil,
-	)
+	stopOnce sync.Once
+}
+
+// StartConsumer starts a goroutine that consumes messages for a tenant,
+// handling them on a single lane until SetWorkerCount adds more. key reads
+// the ordering key of a message; nil leaves every message unkeyed.
+func StartConsumer(broker messaging.Broker, tenantID string, key worker.KeyFunc, handler MessageHandlerFunc, opts ...messaging.ConsumeOption) (*Consumer, error) {
+	sub, err := broker.Consume(tenantID, opts...)
 	if err != nil {
-		return nil, fmt.Errorf("tenant %s: failed to start consuming: %w", tenantID, err)
+		return nil, err
 	}
 
 	c := &Consumer{
-		TenantID:    tenantID,
-		QueueName:   queueName,
-		Channel:     ch,
-		StopChan:    make(chan struct{}),
-		DoneChan:    make(chan struct{}),
-		Handler:     handler,
-		ConsumerTag: consumerTag,
+		TenantID:     tenantID,
+		QueueName:    messaging.QueueName(tenantID),
+		Subscription: sub,
+		StopChan:     make(chan struct{}),
+		DoneChan:     make(chan struct{}),
+		Handler:      handler,
 	}
+	c.Lanes = worker.NewDispatcher(1, key, func(msg messaging.Delivery) {
+		c.Handler(c.TenantID, msg)
+	})
 
-	go c.consumeLoop(msgs)
+	go c.consumeLoop(sub.Deliveries())
 
 	log.Printf("Started consumer for tenant %s", tenantID)
 	return c, nil
 }
 
 // consumeLoop processes messages until StopChan is closed
-func (c *Consumer) consumeLoop(msgs <-chan amqp.Delivery) {
+func (c *Consumer) consumeLoop(msgs <-chan messaging.Delivery) {
 	defer func() {
 		close(c.DoneChan)
 	}()
@@ -75,24 +72,41 @@ func (c *Consumer) consumeLoop(msgs <-chan amqp.Delivery) {
 				log.Printf("Tenant %s: delivery channel closed", c.TenantID)
 				return
 			}
-			c.Handler(c.TenantID, msg)
+			c.Lanes.Dispatch(msg)
 
 		case <-c.StopChan:
 			log.Printf("Stopping consumer for tenant %s...", c.TenantID)
-			_ = c.Channel.Cancel(c.ConsumerTag, false)
 			return
 		}
 	}
 }
 
-// Stop signals the consumer to stop and waits for cleanup
+// Stop signals the consumer to stop and waits for cleanup. Later calls
+// wait for the first to finish.
 func (c *Consumer) Stop() {
-	close(c.StopChan)
-	<-c.DoneChan
-	_ = c.Channel.Close()
-	log.Printf("Stopped consumer for tenant %s", c.TenantID)
+	c.stopOnce.Do(func() {
+		close(c.StopChan)
+		<-c.DoneChan
+		c.Lanes.Stop()
+		if c.OnStop != nil {
+			c.OnStop()
+		}
+		_ = c.Subscription.Cancel()
+		log.Printf("Stopped consumer for tenant %s", c.TenantID)
+	})
 }
 
+// SetWorkerCount sets the number of lanes, and rescales the worker pool
+// attached to the consumer, if any
 func (c *Consumer) SetWorkerCount(n int) {
+	c.Lanes.Resize(n)
+	if c.Pool == nil {
+		return
+	}
 	c.Pool.SetWorkerCount(n)
 }
+
+// SetKey changes how ordering keys are read
+func (c *Consumer) SetKey(key worker.KeyFunc) {
+	c.Lanes.SetKey(key)
+}
@@ -0,0 +1,178 @@
+// internal/ingest/kafka.go
+
+// Package ingest feeds messages into tenants from sources other than the
+// tenant queues.
+package ingest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/metrics"
+)
+
+// DefaultTenantHeader is the record header that routes a record to a
+// tenant; records without it are routed by their key
+const DefaultTenantHeader = "x-tenant-id"
+
+const (
+	minRetryBackoff = 100 * time.Millisecond
+	maxRetryBackoff = 10 * time.Second
+)
+
+// KafkaReader is the subset of *kafka.Reader used by KafkaSource, so tests
+// can substitute an in-process fake
+type KafkaReader interface {
+	FetchMessage(ctx context.Context) (kafka.Message, error)
+	CommitMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// Sink stores a message for a tenant; *manager.TenantManager implements it
+type Sink interface {
+	Ingest(tenantID uuid.UUID, msg messaging.Delivery) error
+}
+
+// KafkaSource consumes a topic and stores each record for the tenant named
+// by its header or key. A record's offset is committed only once it is
+// stored, or when it can never be (unknown tenant, invalid payload, rejected
+// by the tenant's handlers); failed
+// inserts are retried in place, so a transient error never loses a record
+// and the per-partition order is kept. Redelivered records after a crash are
+// dropped by the idempotency key derived from their offset.
+type KafkaSource struct {
+	reader       KafkaReader
+	sink         Sink
+	tenantHeader string
+}
+
+func NewKafkaSource(reader KafkaReader, sink Sink, tenantHeader string) *KafkaSource {
+	if tenantHeader == "" {
+		tenantHeader = DefaultTenantHeader
+	}
+	return &KafkaSource{
+		reader:       reader,
+		sink:         sink,
+		tenantHeader: tenantHeader,
+	}
+}
+
+// Run consumes until ctx is cancelled, then closes the reader
+func (s *KafkaSource) Run(ctx context.Context) error {
+	defer s.reader.Close()
+
+	for {
+		rec, err := s.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("fetch kafka record: %w", err)
+		}
+
+		if err := s.handle(ctx, rec); err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+// handle stores rec, retrying until it succeeds or ctx ends, and commits it
+func (s *KafkaSource) handle(ctx context.Context, rec kafka.Message) error {
+	tenantID, err := s.route(rec)
+	if err != nil {
+		s.skip(rec, "unroutable", err)
+		return s.commit(ctx, rec)
+	}
+	if !json.Valid(rec.Value) {
+		s.skip(rec, "invalid_payload", errors.New("payload is not valid JSON"))
+		return s.commit(ctx, rec)
+	}
+
+	if rec.HighWaterMark > 0 {
+		metrics.KafkaConsumerLag.WithLabelValues(tenantID.String()).Set(float64(rec.HighWaterMark - rec.Offset - 1))
+	}
+
+	backoff := minRetryBackoff
+	for {
+		err := s.sink.Ingest(tenantID, toDelivery(rec))
+		if err == nil {
+			break
+		}
+		if errors.Is(err, manager.ErrTenantNotFound) {
+			s.skip(rec, "unknown_tenant", err)
+			break
+		}
+		if errors.Is(err, manager.ErrRejected) {
+			s.skip(rec, "rejected", err)
+			break
+		}
+
+		log.Printf("[Kafka] Failed to store %s, retrying in %s: %v", recordID(rec), backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		backoff = min(backoff*2, maxRetryBackoff)
+	}
+	return s.commit(ctx, rec)
+}
+
+func (s *KafkaSource) commit(ctx context.Context, rec kafka.Message) error {
+	if err := s.reader.CommitMessages(ctx, rec); err != nil {
+		return fmt.Errorf("commit %s: %w", recordID(rec), err)
+	}
+	return nil
+}
+
+func (s *KafkaSource) skip(rec kafka.Message, reason string, err error) {
+	log.Printf("[Kafka] Skipping %s: %v", recordID(rec), err)
+	metrics.KafkaRecordsSkipped.WithLabelValues(reason).Inc()
+}
+
+// route returns the tenant named by the tenant header, or else the key
+func (s *KafkaSource) route(rec kafka.Message) (uuid.UUID, error) {
+	for _, h := range rec.Headers {
+		if h.Key == s.tenantHeader {
+			return uuid.Parse(string(h.Value))
+		}
+	}
+	if len(rec.Key) == 0 {
+		return uuid.Nil, fmt.Errorf("no %s header or key", s.tenantHeader)
+	}
+	return uuid.Parse(string(rec.Key))
+}
+
+// toDelivery maps a record onto the broker delivery shape. The message ID
+// is the record's topic/partition/offset, which stays stable across
+// redeliveries and so serves as the default idempotency key.
+func toDelivery(rec kafka.Message) messaging.Delivery {
+	d := messaging.Delivery{
+		Body:        rec.Value,
+		MessageID:   recordID(rec),
+		ContentType: "application/json",
+		Headers:     make(map[string]interface{}, len(rec.Headers)),
+		RoutingKey:  rec.Topic,
+		Timestamp:   rec.Time,
+	}
+	for _, h := range rec.Headers {
+		d.Headers[h.Key] = string(h.Value)
+	}
+	return d
+}
+
+func recordID(rec kafka.Message) string {
+	return fmt.Sprintf("kafka:%s/%d/%d", rec.Topic, rec.Partition, rec.Offset)
+}
@@ -0,0 +1,127 @@
+package ingest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/segmentio/kafka-go"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/ingest"
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+)
+
+// fakeReader serves records from a slice, then blocks until ctx ends
+type fakeReader struct {
+	mu        sync.Mutex
+	records   []kafka.Message
+	committed []int64
+}
+
+func (r *fakeReader) FetchMessage(ctx context.Context) (kafka.Message, error) {
+	r.mu.Lock()
+	if len(r.records) > 0 {
+		rec := r.records[0]
+		r.records = r.records[1:]
+		r.mu.Unlock()
+		return rec, nil
+	}
+	r.mu.Unlock()
+	<-ctx.Done()
+	return kafka.Message{}, ctx.Err()
+}
+
+func (r *fakeReader) CommitMessages(_ context.Context, msgs ...kafka.Message) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range msgs {
+		r.committed = append(r.committed, m.Offset)
+	}
+	return nil
+}
+
+func (r *fakeReader) Close() error { return nil }
+
+func (r *fakeReader) Committed() []int64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]int64(nil), r.committed...)
+}
+
+// fakeSink stores for known tenants, failing the first failures calls
+type fakeSink struct {
+	mu       sync.Mutex
+	tenants  map[uuid.UUID]bool
+	failures int
+	stored   []messaging.Delivery
+	routed   []uuid.UUID
+}
+
+func (s *fakeSink) Ingest(tenantID uuid.UUID, msg messaging.Delivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.tenants[tenantID] {
+		return manager.ErrTenantNotFound
+	}
+	if string(msg.Body) == `{"reject":true}` {
+		return fmt.Errorf("%w: invalid order", manager.ErrRejected)
+	}
+	if s.failures > 0 {
+		s.failures--
+		return errors.New("database unavailable")
+	}
+	s.stored = append(s.stored, msg)
+	s.routed = append(s.routed, tenantID)
+	return nil
+}
+
+func TestKafkaSource(t *testing.T) {
+	byKey, byHeader, unknown := uuid.New(), uuid.New(), uuid.New()
+	reader := &fakeReader{records: []kafka.Message{
+		{Topic: "events", Offset: 0, Key: []byte(byKey.String()), Value: []byte(`{"n":0}`), HighWaterMark: 7},
+		{Topic: "events", Offset: 1, Key: []byte(byKey.String()), Value: []byte(`{"n":1}`),
+			Headers: []kafka.Header{{Key: ingest.DefaultTenantHeader, Value: []byte(byHeader.String())}}},
+		{Topic: "events", Offset: 2, Key: []byte("not-a-tenant"), Value: []byte(`{}`)},
+		{Topic: "events", Offset: 3, Key: []byte(unknown.String()), Value: []byte(`{}`)},
+		{Topic: "events", Offset: 4, Key: []byte(byKey.String()), Value: []byte(`not json`)},
+		{Topic: "events", Offset: 5, Key: []byte(byKey.String()), Value: []byte(`{"reject":true}`)},
+		{Topic: "events", Offset: 6, Key: []byte(byKey.String()), Value: []byte(`{"n":6}`)},
+	}}
+	// The first record is stored only on the third attempt
+	sink := &fakeSink{tenants: map[uuid.UUID]bool{byKey: true, byHeader: true}, failures: 2}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- ingest.NewKafkaSource(reader, sink, "").Run(ctx) }()
+
+	require.Eventually(t, func() bool { return len(reader.Committed()) == 7 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	require.NoError(t, <-done)
+
+	// Every offset is committed in order, but only routable records the
+	// tenant's handlers accept are stored
+	require.Equal(t, []int64{0, 1, 2, 3, 4, 5, 6}, reader.Committed())
+	require.Equal(t, []uuid.UUID{byKey, byHeader, byKey}, sink.routed)
+	require.Equal(t, `{"n":0}`, string(sink.stored[0].Body))
+	require.Equal(t, "kafka:events/0/0", sink.stored[0].MessageID)
+	require.Equal(t, byHeader.String(), sink.stored[1].Headers[ingest.DefaultTenantHeader])
+}
+
+func TestKafkaSourceRetriesUntilCancelled(t *testing.T) {
+	tenantID := uuid.New()
+	reader := &fakeReader{records: []kafka.Message{
+		{Topic: "events", Key: []byte(tenantID.String()), Value: []byte(`{}`)},
+	}}
+	sink := &fakeSink{tenants: map[uuid.UUID]bool{tenantID: true}, failures: 1 << 30}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	require.NoError(t, ingest.NewKafkaSource(reader, sink, "").Run(ctx))
+	require.Empty(t, reader.Committed(), "a record that was never stored must not be committed")
+}
@@ -0,0 +1,398 @@
+// internal/manager/autoscaler.go
+package manager
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/metrics"
+	"multi-tenant/internal/model"
+)
+
+// scaleDownRatio is the fraction of the target latency below which
+// workers are removed; between it and the target nothing changes, so the
+// worker count does not flap around the target
+const scaleDownRatio = 0.5
+
+// maxDecisions is how many recent decisions are kept per tenant
+const maxDecisions = 20
+
+// AutoscaleConfig holds the server-wide autoscaling defaults
+type AutoscaleConfig struct {
+	// Enabled turns autoscaling on for tenants that do not choose
+	Enabled bool
+	// Interval is how often queues are inspected; default 10s
+	Interval time.Duration
+	// MinWorkers and MaxWorkers default to 1 and 10; a tenant's plan
+	// caps MaxWorkers
+	MinWorkers int
+	MaxWorkers int
+	// TargetLatency defaults to 5s
+	TargetLatency time.Duration
+	// ScaleUpCooldown and ScaleDownCooldown are the least time after a
+	// change before workers are added or removed again; default 30s and 2m
+	ScaleUpCooldown   time.Duration
+	ScaleDownCooldown time.Duration
+}
+
+// Observation is what a tenant's queue and workers did over an interval
+type Observation struct {
+	Workers int
+	Depth   int
+	// Handled is how many messages were handled over Elapsed
+	Handled int64
+	Elapsed time.Duration
+	// Latency is the measured mean end-to-end latency, zero if unknown
+	Latency time.Duration
+	// MaxWorkers is the tenant's plan maximum; zero leaves it unlimited
+	MaxWorkers int
+}
+
+// ScaleDecision is a change of a tenant's worker count
+type ScaleDecision struct {
+	At     time.Time `json:"at"`
+	From   int       `json:"from"`
+	To     int       `json:"to"`
+	Reason string    `json:"reason" example:"latency 12.0s above target 5.0s"`
+}
+
+// AutoscaleStatus is a tenant's autoscaling settings, with server
+// defaults applied, what it last observed and its recent decisions
+type AutoscaleStatus struct {
+	Settings model.Autoscale `json:"settings"`
+	Workers  int             `json:"workers"`
+	Depth    int             `json:"depth"`
+	// Rate is messages handled per second
+	Rate float64 `json:"rate"`
+	// LatencySeconds is the larger of the backlog's drain time and the
+	// measured latency; Stalled is set instead when nothing was handled
+	// with messages waiting
+	LatencySeconds float64         `json:"latency_seconds"`
+	Stalled        bool            `json:"stalled"`
+	Decisions      []ScaleDecision `json:"decisions"`
+}
+
+type scaleState struct {
+	lastChange time.Time
+	status     AutoscaleStatus
+}
+
+// Autoscaler decides tenants' worker counts from their queue depth,
+// processing rate and latency. Workers are added in proportion to how
+// far the latency is above its target, at most doubling at a time, and
+// removed one at a time once it is below half of it.
+type Autoscaler struct {
+	// Now is the clock; tests may replace it
+	Now func() time.Time
+
+	cfg AutoscaleConfig
+
+	mu      sync.Mutex
+	tenants map[uuid.UUID]*scaleState
+}
+
+func NewAutoscaler(cfg AutoscaleConfig) *Autoscaler {
+	if cfg.Interval <= 0 {
+		cfg.Interval = 10 * time.Second
+	}
+	if cfg.MinWorkers <= 0 {
+		cfg.MinWorkers = 1
+	}
+	if cfg.MaxWorkers <= 0 {
+		cfg.MaxWorkers = max(10, cfg.MinWorkers)
+	}
+	if cfg.TargetLatency <= 0 {
+		cfg.TargetLatency = 5 * time.Second
+	}
+	if cfg.ScaleUpCooldown <= 0 {
+		cfg.ScaleUpCooldown = 30 * time.Second
+	}
+	if cfg.ScaleDownCooldown <= 0 {
+		cfg.ScaleDownCooldown = 2 * time.Minute
+	}
+	return &Autoscaler{
+		Now:     time.Now,
+		cfg:     cfg,
+		tenants: make(map[uuid.UUID]*scaleState),
+	}
+}
+
+// ValidateAutoscale checks a tenant's autoscale settings
+func ValidateAutoscale(s *model.Autoscale) error {
+	if s == nil {
+		return nil
+	}
+	if s.MinWorkers < 0 || s.MaxWorkers < 0 || s.TargetLatencyMS < 0 {
+		return fmt.Errorf("%w: values must not be negative", ErrInvalidAutoscale)
+	}
+	if s.MaxWorkers > 0 && s.MinWorkers > s.MaxWorkers {
+		return fmt.Errorf("%w: min_workers above max_workers", ErrInvalidAutoscale)
+	}
+	return nil
+}
+
+// Set registers a tenant or changes its settings; nil uses the defaults
+func (a *Autoscaler) Set(tenantID uuid.UUID, settings *model.Autoscale) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.tenants[tenantID]
+	if !ok {
+		s = &scaleState{}
+		a.tenants[tenantID] = s
+	}
+	s.status.Settings = a.effective(settings)
+}
+
+func (a *Autoscaler) Remove(tenantID uuid.UUID) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.tenants, tenantID)
+}
+
+// effective applies the defaults to a tenant's settings
+func (a *Autoscaler) effective(s *model.Autoscale) model.Autoscale {
+	e := model.Autoscale{
+		Enabled:         a.cfg.Enabled,
+		MinWorkers:      a.cfg.MinWorkers,
+		MaxWorkers:      a.cfg.MaxWorkers,
+		TargetLatencyMS: a.cfg.TargetLatency.Milliseconds(),
+	}
+	if s == nil {
+		return e
+	}
+	e.Enabled = s.Enabled
+	if s.MinWorkers > 0 {
+		e.MinWorkers = s.MinWorkers
+	}
+	if s.MaxWorkers > 0 {
+		e.MaxWorkers = s.MaxWorkers
+	}
+	if s.TargetLatencyMS > 0 {
+		e.TargetLatencyMS = s.TargetLatencyMS
+	}
+	e.MaxWorkers = max(e.MaxWorkers, e.MinWorkers)
+	return e
+}
+
+// Status returns a registered tenant's autoscaling status
+func (a *Autoscaler) Status(tenantID uuid.UUID) (AutoscaleStatus, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.tenants[tenantID]
+	if !ok {
+		return AutoscaleStatus{}, false
+	}
+	status := s.status
+	status.Decisions = append([]ScaleDecision{}, s.status.Decisions...)
+	return status, true
+}
+
+// Decide records an observation of a tenant and returns the worker count
+// it should change to, if any
+func (a *Autoscaler) Decide(tenantID uuid.UUID, obs Observation) (int, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	s, ok := a.tenants[tenantID]
+	if !ok {
+		return 0, false
+	}
+	now := a.Now()
+
+	var rate float64
+	if obs.Elapsed > 0 {
+		rate = float64(obs.Handled) / obs.Elapsed.Seconds()
+	}
+	latency := obs.Latency.Seconds()
+	stalled := obs.Depth > 0 && rate == 0
+	if obs.Depth > 0 && rate > 0 {
+		latency = max(latency, float64(obs.Depth)/rate)
+	}
+
+	st := &s.status
+	st.Workers, st.Depth, st.Rate, st.Stalled = obs.Workers, obs.Depth, rate, stalled
+	st.LatencySeconds = latency
+	if stalled {
+		st.LatencySeconds = 0
+	}
+	label := tenantID.String()
+	metrics.ProcessingRate.WithLabelValues(label).Set(rate)
+	metrics.EstimatedLatency.WithLabelValues(label).Set(st.LatencySeconds)
+
+	cfg := st.Settings
+	if !cfg.Enabled {
+		return 0, false
+	}
+	lo, hi := cfg.MinWorkers, cfg.MaxWorkers
+	if obs.MaxWorkers > 0 {
+		hi = min(hi, obs.MaxWorkers)
+		lo = min(lo, hi)
+	}
+	target := time.Duration(cfg.TargetLatencyMS) * time.Millisecond
+
+	cur := obs.Workers
+	to, reason := cur, ""
+	switch {
+	case cur < lo || cur > hi:
+		to = min(max(cur, lo), hi)
+		reason = fmt.Sprintf("outside %d-%d workers", lo, hi)
+	case stalled || latency > target.Seconds():
+		if now.Sub(s.lastChange) < a.cfg.ScaleUpCooldown {
+			return 0, false
+		}
+		to = cur * 2
+		if !stalled {
+			to = min(to, int(math.Ceil(float64(cur)*latency/target.Seconds())))
+		}
+		to = min(max(to, cur+1), hi)
+		if stalled {
+			reason = fmt.Sprintf("%d messages waiting and none handled", obs.Depth)
+		} else {
+			reason = fmt.Sprintf("latency %.1fs above target %.1fs", latency, target.Seconds())
+		}
+	case latency < target.Seconds()*scaleDownRatio:
+		if now.Sub(s.lastChange) < a.cfg.ScaleDownCooldown {
+			return 0, false
+		}
+		to = max(cur-1, lo)
+		reason = fmt.Sprintf("latency %.1fs below %.1fs", latency, target.Seconds()*scaleDownRatio)
+	}
+	if to == cur {
+		return 0, false
+	}
+
+	s.lastChange = now
+	st.Decisions = append(st.Decisions, ScaleDecision{At: now, From: cur, To: to, Reason: reason})
+	if len(st.Decisions) > maxDecisions {
+		st.Decisions = st.Decisions[len(st.Decisions)-maxDecisions:]
+	}
+	direction := "up"
+	if to < cur {
+		direction = "down"
+	}
+	metrics.AutoscalerDecisions.WithLabelValues(label, direction).Inc()
+	metrics.AutoscalerTarget.WithLabelValues(label).Set(float64(to))
+	return to, true
+}
+
+// SetAutoscaler replaces the autoscaler; it applies to tenants added
+// afterwards
+func (tm *TenantManager) SetAutoscaler(a *Autoscaler) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.autoscaler = a
+}
+
+// SetAutoscale changes a tenant's autoscale settings; nil restores the
+// server's defaults
+func (tm *TenantManager) SetAutoscale(tenantID uuid.UUID, settings *model.Autoscale) error {
+	if err := ValidateAutoscale(settings); err != nil {
+		return err
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, ok := tm.consumers[tenantID]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.Autoscale = settings
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist autoscale settings: %w", err)
+	}
+	tm.autoscaler.Set(tenantID, settings)
+	return nil
+}
+
+// AutoscaleStatus returns a tenant's autoscaling settings, what the
+// autoscaler last observed and its recent decisions
+func (tm *TenantManager) AutoscaleStatus(tenantID uuid.UUID) (AutoscaleStatus, error) {
+	tm.mu.RLock()
+	a := tm.autoscaler
+	tm.mu.RUnlock()
+
+	status, ok := a.Status(tenantID)
+	if !ok {
+		return AutoscaleStatus{}, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return status, nil
+}
+
+// RunAutoscaler inspects every tenant queue each interval, recording its
+// depth, and rescales the tenants that autoscale until ctx is cancelled
+func (tm *TenantManager) RunAutoscaler(ctx context.Context) {
+	tm.mu.RLock()
+	a := tm.autoscaler
+	tm.mu.RUnlock()
+
+	ticker := time.NewTicker(a.cfg.Interval)
+	defer ticker.Stop()
+
+	last := time.Now()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			tm.autoscale(a, now.Sub(last))
+			last = now
+		}
+	}
+}
+
+// autoscale runs one autoscaler round over the tenants. Each decision is
+// taken under mu and applied after releasing it.
+func (tm *TenantManager) autoscale(a *Autoscaler, elapsed time.Duration) {
+	for _, id := range tm.ListTenantIDs() {
+		tenantID, err := uuid.Parse(id)
+		if err != nil {
+			continue
+		}
+		depth, err := tm.broker.QueueDepth(id)
+		if err != nil {
+			log.Printf("Failed to inspect queue for %s: %v", id, err)
+			continue
+		}
+		metrics.QueueDepth.WithLabelValues(id).Set(float64(depth))
+
+		tm.mu.Lock()
+		_, ok := tm.consumers[tenantID]
+		if !ok {
+			tm.mu.Unlock()
+			continue
+		}
+		handled, latency := tm.batchers[tenantID].TakeStats()
+		obs := Observation{
+			Workers:    tm.workers(tenantID),
+			Depth:      depth,
+			Handled:    handled,
+			Elapsed:    elapsed,
+			Latency:    latency,
+			MaxWorkers: tm.tenantPlans[tenantID].MaxWorkers,
+		}
+		var resizes []resize
+		if n, ok := a.Decide(tenantID, obs); ok {
+			log.Printf("Tenant %s autoscaled from %d to %d workers", id, obs.Workers, n)
+			resizes = tm.applyWorkers(tenantID, n)
+		}
+		tm.mu.Unlock()
+
+		// Resizing waits for the tenant's lanes to drain, which must not
+		// hold up calls for other tenants
+		applyResizes(resizes)
+	}
+}
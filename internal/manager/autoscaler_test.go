@@ -0,0 +1,72 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/model"
+)
+
+func TestAutoscalerDecide(t *testing.T) {
+	a := manager.NewAutoscaler(manager.AutoscaleConfig{
+		TargetLatency:     time.Second,
+		ScaleUpCooldown:   time.Minute,
+		ScaleDownCooldown: 5 * time.Minute,
+	})
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	a.Now = func() time.Time { return now }
+
+	id := uuid.New()
+	a.Set(id, &model.Autoscale{Enabled: true, MinWorkers: 1, MaxWorkers: 8})
+	obs := func(workers, depth int, handled int64) manager.Observation {
+		return manager.Observation{Workers: workers, Depth: depth, Handled: handled, Elapsed: 10 * time.Second}
+	}
+
+	// 300 waiting at 100/s is 3s behind a 1s target: scale by 3, at most
+	// doubling
+	n, ok := a.Decide(id, obs(2, 300, 1000))
+	require.True(t, ok)
+	require.Equal(t, 4, n)
+
+	// Cooldown, then the plan caps the maximum
+	_, ok = a.Decide(id, obs(4, 3000, 1000))
+	require.False(t, ok)
+	now = now.Add(time.Minute)
+	o := obs(4, 3000, 1000)
+	o.MaxWorkers = 6
+	n, ok = a.Decide(id, o)
+	require.True(t, ok)
+	require.Equal(t, 6, n)
+
+	// Within the hysteresis band nothing changes
+	now = now.Add(10 * time.Minute)
+	_, ok = a.Decide(id, obs(6, 70, 1000))
+	require.False(t, ok)
+
+	// Below half the target workers are removed one at a time
+	n, ok = a.Decide(id, obs(6, 10, 1000))
+	require.True(t, ok)
+	require.Equal(t, 5, n)
+	_, ok = a.Decide(id, obs(5, 0, 0))
+	require.False(t, ok, "scale-down cooldown")
+
+	// A stalled queue doubles the workers
+	now = now.Add(time.Minute)
+	n, ok = a.Decide(id, obs(2, 50, 0))
+	require.True(t, ok)
+	require.Equal(t, 4, n)
+
+	status, ok := a.Status(id)
+	require.True(t, ok)
+	require.True(t, status.Stalled)
+	require.Len(t, status.Decisions, 4)
+
+	// Disabled tenants are observed but not scaled
+	a.Set(id, &model.Autoscale{Enabled: false})
+	_, ok = a.Decide(id, obs(1, 1000, 0))
+	require.False(t, ok)
+}
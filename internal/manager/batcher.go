@@ -0,0 +1,245 @@
+// internal/manager/batcher.go
+package manager
+
+import (
+	"log"
+	"sync/atomic"
+	"time"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/metering"
+	"multi-tenant/internal/metrics"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+const (
+	DefaultBatchSize     = 100
+	DefaultFlushInterval = 200 * time.Millisecond
+)
+
+type pendingDelivery struct {
+	delivery messaging.Delivery
+	message  *model.Message
+}
+
+// Batcher accumulates a tenant's deliveries and stores them in one COPY
+// once BatchSize messages are pending or FlushInterval has elapsed since
+// the first one arrived. The batch is then settled with a single
+// Ack/Nack(multiple=true) on the last delivery tag, which is only correct
+// while a tenant's deliveries arrive in order on its own subscription. Once
+// they are handled on several lanes, an earlier delivery may still be on
+// another lane, so SetAckEach switches to settling them one by one.
+type Batcher struct {
+	tenantID      string
+	storage       storage.Store
+	meter         *metering.Meter
+	size          int
+	flushInterval time.Duration
+	ackEach       atomic.Bool
+	requeueFailed atomic.Bool
+
+	// Counted since the last TakeStats
+	handled   atomic.Int64
+	latencyNS atomic.Int64
+	latencyN  atomic.Int64
+
+	in       chan pendingDelivery
+	flushReq chan chan struct{}
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+// NewBatcher starts a batcher storing into storage; batches that fail to
+// store are recorded on meter
+func NewBatcher(tenantID string, storage storage.Store, meter *metering.Meter, size int, flushInterval time.Duration) *Batcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if flushInterval <= 0 {
+		flushInterval = DefaultFlushInterval
+	}
+
+	b := &Batcher{
+		tenantID:      tenantID,
+		storage:       storage,
+		meter:         meter,
+		size:          size,
+		flushInterval: flushInterval,
+		in:            make(chan pendingDelivery),
+		flushReq:      make(chan chan struct{}),
+		stop:          make(chan struct{}),
+		done:          make(chan struct{}),
+	}
+	go b.run()
+	return b
+}
+
+// Add queues a delivery for the next batch
+func (b *Batcher) Add(d messaging.Delivery, m *model.Message) {
+	b.in <- pendingDelivery{delivery: d, message: m}
+}
+
+// SetAckEach selects settling each delivery on its own rather than the
+// whole batch at once
+func (b *Batcher) SetAckEach(each bool) {
+	b.ackEach.Store(each)
+}
+
+// SetRequeueFailed selects requeueing batches that fail to store rather
+// than dead-lettering them, for queues that enforce a delivery limit
+func (b *Batcher) SetRequeueFailed(requeue bool) {
+	b.requeueFailed.Store(requeue)
+}
+
+// Settle settles a delivery its handlers did not store: it is acked and
+// counted as handled, or rejected like a batch that failed to store
+func (b *Batcher) Settle(d messaging.Delivery, ok bool) {
+	if !ok {
+		d.Nack(false, b.requeueFailed.Load())
+		return
+	}
+	d.Ack(false)
+	b.handled.Add(1)
+}
+
+// Flush stores and settles the pending deliveries now, returning once
+// they are settled
+func (b *Batcher) Flush() {
+	done := make(chan struct{})
+	select {
+	case b.flushReq <- done:
+		<-done
+	case <-b.done:
+	}
+}
+
+// Stop flushes any pending deliveries and waits for the batcher to exit.
+// It must be called before the delivery channel is closed.
+func (b *Batcher) Stop() {
+	close(b.stop)
+	<-b.done
+}
+
+func (b *Batcher) run() {
+	defer close(b.done)
+
+	batch := make([]pendingDelivery, 0, b.size)
+	timer := time.NewTimer(b.flushInterval)
+	timer.Stop()
+
+	flush := func() {
+		timer.Stop()
+		b.flush(batch)
+		batch = batch[:0]
+	}
+
+	for {
+		select {
+		case p := <-b.in:
+			batch = append(batch, p)
+			if len(batch) == 1 {
+				timer.Reset(b.flushInterval)
+			}
+			if len(batch) >= b.size {
+				flush()
+			}
+
+		case <-timer.C:
+			flush()
+
+		case done := <-b.flushReq:
+			flush()
+			close(done)
+
+		case <-b.stop:
+			flush()
+			return
+		}
+	}
+}
+
+func (b *Batcher) flush(batch []pendingDelivery) {
+	if len(batch) == 0 {
+		return
+	}
+
+	msgs := make([]*model.Message, len(batch))
+	for i, p := range batch {
+		msgs[i] = p.message
+	}
+	stored, err := b.storage.InsertMessages(msgs)
+	if err != nil {
+		log.Printf("Tenant %s: batch insert of %d messages failed: %v", b.tenantID, len(batch), err)
+		b.meter.Record(msgs[0].TenantID, model.Usage{Failed: int64(len(batch))})
+		b.settle(batch, false)
+		return
+	}
+
+	// Duplicates are acked along with the batch so they are not redelivered
+	if dups := len(batch) - stored; dups > 0 {
+		metrics.MessageDuplicates.WithLabelValues(b.tenantID).Add(float64(dups))
+	}
+	b.settle(batch, true)
+	b.handled.Add(int64(len(batch)))
+
+	storedAt := time.Now()
+	for _, m := range msgs {
+		observeLatency(b.tenantID, m, storedAt)
+		if m.PublishedAt != nil {
+			if d := storedAt.Sub(*m.PublishedAt); d >= 0 {
+				b.latencyNS.Add(int64(d))
+				b.latencyN.Add(1)
+			}
+		}
+	}
+}
+
+// TakeStats returns how many deliveries were handled, duplicates
+// included, and the mean end-to-end latency of those stamped by their
+// producer, since the last call
+func (b *Batcher) TakeStats() (handled int64, latency time.Duration) {
+	handled = b.handled.Swap(0)
+	sum, n := b.latencyNS.Swap(0), b.latencyN.Swap(0)
+	if n > 0 {
+		latency = time.Duration(sum / n)
+	}
+	return handled, latency
+}
+
+// settle acks the batch, or nacks it to the DLQ or for a retry
+func (b *Batcher) settle(batch []pendingDelivery, ack bool) {
+	requeue := b.requeueFailed.Load()
+	if !b.ackEach.Load() {
+		last := batch[len(batch)-1].delivery
+		if ack {
+			last.Ack(true)
+		} else {
+			last.Nack(true, requeue)
+		}
+		return
+	}
+	for _, p := range batch {
+		if ack {
+			p.delivery.Ack(false)
+		} else {
+			p.delivery.Nack(false, requeue)
+		}
+	}
+}
+
+// observeLatency records how long a producer-stamped message spent queued
+// and in total; clock skew yielding negative durations is ignored
+func observeLatency(tenantID string, m *model.Message, storedAt time.Time) {
+	if m.PublishedAt == nil {
+		return
+	}
+	if m.ReceivedAt != nil {
+		if d := m.ReceivedAt.Sub(*m.PublishedAt); d >= 0 {
+			metrics.MessageLatency.WithLabelValues(tenantID, "queue").Observe(d.Seconds())
+		}
+	}
+	if d := storedAt.Sub(*m.PublishedAt); d >= 0 {
+		metrics.MessageLatency.WithLabelValues(tenantID, "end_to_end").Observe(d.Seconds())
+	}
+}
@@ -0,0 +1,292 @@
+// internal/manager/budget.go
+package manager
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/metrics"
+)
+
+// DefaultBudgetInterval is how often RunBudget reallocates workers
+const DefaultBudgetInterval = time.Second
+
+// demandWindow is about how many samples a tenant's demand is averaged
+// over
+const demandWindow = 10
+
+// demandHysteresis is how far the averaged demand must move from the
+// demand last allocated for before it counts, so lanes are not resized,
+// and drained, for every lane's worth of change
+const demandHysteresis = 1.5
+
+// Budget shares a fixed number of workers among tenants by weighted fair
+// sharing. Each tenant is guaranteed a minimum and may have up to its own
+// worker count; between the two it gets workers only while it has
+// deliveries waiting, averaged over recent samples. Workers idle tenants
+// do not need are lent to busy ones until the idle tenants need them
+// back.
+type Budget struct {
+	total   int
+	minimum int
+
+	mu     sync.Mutex
+	shares map[uuid.UUID]*share
+}
+
+type share struct {
+	weight int
+	max    int
+	// avg is the averaged demand, want the demand allocated for
+	avg  float64
+	want int
+}
+
+// NewBudget shares total workers, guaranteeing each tenant minimum (at
+// least 1). The minimums are kept even when together they exceed total.
+func NewBudget(total, minimum int) *Budget {
+	return &Budget{
+		total:   total,
+		minimum: max(minimum, 1),
+		shares:  make(map[uuid.UUID]*share),
+	}
+}
+
+// Add registers a tenant with a worker maximum of 1 until SetMax; a
+// weight below 1 counts as 1
+func (b *Budget) Add(tenantID uuid.UUID, weight int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.shares[tenantID] = &share{weight: max(weight, 1), max: 1}
+}
+
+// SetWeight changes a registered tenant's weight
+func (b *Budget) SetWeight(tenantID uuid.UUID, weight int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.shares[tenantID]; ok {
+		s.weight = max(weight, 1)
+	}
+}
+
+// SetMax changes the most workers a registered tenant may have
+func (b *Budget) SetMax(tenantID uuid.UUID, n int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.shares[tenantID]; ok {
+		s.max = max(n, 1)
+	}
+}
+
+// Max returns the most workers a registered tenant may have
+func (b *Budget) Max(tenantID uuid.UUID) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if s, ok := b.shares[tenantID]; ok {
+		return s.max
+	}
+	return 0
+}
+
+func (b *Budget) Remove(tenantID uuid.UUID) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.shares, tenantID)
+}
+
+// Observe adds a sample of how many workers each registered tenant could
+// keep busy; tenants missing from samples had no demand. Demand follows
+// an exponential moving average of the samples over about demandWindow
+// of them, once it moves by demandHysteresis.
+func (b *Budget) Observe(samples map[uuid.UUID]int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	const alpha = 2.0 / (demandWindow + 1)
+	for id, s := range b.shares {
+		s.avg += alpha * (float64(samples[id]) - s.avg)
+		if math.Abs(s.avg-float64(s.want)) >= demandHysteresis {
+			s.want = int(math.Round(s.avg))
+		}
+	}
+}
+
+// Demand returns the registered tenants' smoothed demand, for Allocate
+func (b *Budget) Demand() map[uuid.UUID]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	demand := make(map[uuid.UUID]int, len(b.shares))
+	for id, s := range b.shares {
+		demand[id] = s.want
+	}
+	return demand
+}
+
+// Allocate divides the budget among the registered tenants given how
+// many workers each could keep busy. Every tenant gets its minimum; the
+// rest go one at a time to the tenant with the fewest workers per weight
+// among those wanting more, so busy tenants share in proportion to their
+// weights and leftover workers stay unallocated.
+func (b *Budget) Allocate(demand map[uuid.UUID]int) map[uuid.UUID]int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	ids := make([]uuid.UUID, 0, len(b.shares))
+	for id := range b.shares {
+		ids = append(ids, id)
+	}
+	// A fixed order breaks ties the same way on every allocation
+	sort.Slice(ids, func(i, j int) bool { return ids[i].String() < ids[j].String() })
+
+	alloc := make(map[uuid.UUID]int, len(ids))
+	want := make(map[uuid.UUID]int, len(ids))
+	remaining := b.total
+	for _, id := range ids {
+		s := b.shares[id]
+		floor := min(b.minimum, s.max)
+		alloc[id] = floor
+		want[id] = min(max(demand[id], floor), s.max)
+		remaining -= floor
+	}
+
+	for ; remaining > 0; remaining-- {
+		var next uuid.UUID
+		for _, id := range ids {
+			if alloc[id] >= want[id] {
+				continue
+			}
+			// alloc/weight below that of next, without dividing
+			if next == uuid.Nil || alloc[id]*b.shares[next].weight < alloc[next]*b.shares[id].weight {
+				next = id
+			}
+		}
+		if next == uuid.Nil {
+			break
+		}
+		alloc[next]++
+	}
+	return alloc
+}
+
+// SetWorkerBudget caps the workers of all tenants together at total,
+// guaranteeing each minPerTenant; a total of zero gives every tenant its
+// own worker count. It applies to tenants added afterwards.
+func (tm *TenantManager) SetWorkerBudget(total, minPerTenant int) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.budget = nil
+	if total > 0 {
+		tm.budget = NewBudget(total, minPerTenant)
+	}
+}
+
+// applyWorkers gives a tenant n workers, or with a worker budget up to n
+// as the budget allows, and returns the resizes to apply once mu is
+// released. Callers must hold mu.
+func (tm *TenantManager) applyWorkers(tenantID uuid.UUID, n int) []resize {
+	if tm.budget == nil {
+		return []resize{tm.resizeLanes(tenantID, n)}
+	}
+	tm.budget.SetMax(tenantID, n)
+	return tm.rebalance()
+}
+
+// workers returns the worker count a tenant was given: its lanes, or with
+// a worker budget the most it may be allocated. Callers must hold mu.
+func (tm *TenantManager) workers(tenantID uuid.UUID) int {
+	if tm.budget == nil {
+		return tm.laneTargets[tenantID].get()
+	}
+	return tm.budget.Max(tenantID)
+}
+
+// rebalance divides the budget by the tenants' smoothed demand and
+// returns the resizes to apply once mu is released. Callers must hold mu.
+func (tm *TenantManager) rebalance() []resize {
+	var resizes []resize
+	for id, n := range tm.budget.Allocate(tm.budget.Demand()) {
+		t, ok := tm.laneTargets[id]
+		if !ok {
+			continue
+		}
+		if t.get() != n {
+			resizes = append(resizes, tm.resizeLanes(id, n))
+		}
+		metrics.WorkerAllocated.WithLabelValues(id.String()).Set(float64(n))
+	}
+	return resizes
+}
+
+// RunBudget reallocates the worker budget as tenants' demand changes
+// until ctx is cancelled; without a budget it returns at once
+func (tm *TenantManager) RunBudget(ctx context.Context) {
+	tm.mu.RLock()
+	enabled := tm.budget != nil
+	tm.mu.RUnlock()
+	if !enabled {
+		return
+	}
+
+	ticker := time.NewTicker(DefaultBudgetInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			tm.mu.Lock()
+			pending := make(map[uuid.UUID]int, len(tm.consumers))
+			for id, c := range tm.consumers {
+				pending[id] = c.Lanes.Pending()
+			}
+			tm.budget.Observe(pending)
+			resizes := tm.rebalance()
+			tm.mu.Unlock()
+
+			applyResizes(resizes)
+		}
+	}
+}
+
+// SetWeight changes a tenant's share of the worker budget
+func (tm *TenantManager) SetWeight(tenantID uuid.UUID, weight int) error {
+	if weight < 0 {
+		return fmt.Errorf("%w: %d", ErrInvalidWeight, weight)
+	}
+
+	var resizes []resize
+	defer func() { applyResizes(resizes) }()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, ok := tm.consumers[tenantID]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.Weight = weight
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist weight: %w", err)
+	}
+	if tm.budget != nil {
+		tm.budget.SetWeight(tenantID, weight)
+		resizes = tm.rebalance()
+	}
+	return nil
+}
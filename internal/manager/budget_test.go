@@ -0,0 +1,76 @@
+package manager_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+)
+
+func TestBudgetAllocate(t *testing.T) {
+	b := manager.NewBudget(12, 1)
+	heavy, light, idle := uuid.New(), uuid.New(), uuid.New()
+	b.Add(heavy, 2)
+	b.Add(light, 1)
+	b.Add(idle, 1)
+	for _, id := range []uuid.UUID{heavy, light, idle} {
+		b.SetMax(id, 8)
+	}
+
+	// Busy tenants share by weight, the idle one keeps its minimum and
+	// lends the rest
+	alloc := b.Allocate(map[uuid.UUID]int{heavy: 100, light: 100})
+	require.Equal(t, 1, alloc[idle])
+	require.Equal(t, 7, alloc[heavy])
+	require.Equal(t, 4, alloc[light])
+
+	// Once the idle tenant is busy it takes its share back
+	alloc = b.Allocate(map[uuid.UUID]int{heavy: 100, light: 100, idle: 100})
+	require.Equal(t, 6, alloc[heavy])
+	require.Equal(t, 3, alloc[light])
+	require.Equal(t, 3, alloc[idle])
+
+	// Nobody gets more than it can use or its maximum
+	b.SetMax(heavy, 4)
+	alloc = b.Allocate(map[uuid.UUID]int{heavy: 100, light: 3})
+	require.Equal(t, 4, alloc[heavy])
+	require.Equal(t, 3, alloc[light])
+	require.Equal(t, 1, alloc[idle])
+
+	// Minimums hold even past the budget
+	small := manager.NewBudget(2, 1)
+	for range 3 {
+		small.Add(uuid.New(), 1)
+	}
+	for _, n := range small.Allocate(nil) {
+		require.Equal(t, 1, n)
+	}
+}
+
+func TestBudgetDemand(t *testing.T) {
+	b := manager.NewBudget(12, 1)
+	id := uuid.New()
+	b.Add(id, 1)
+
+	for range 30 {
+		b.Observe(map[uuid.UUID]int{id: 6})
+	}
+	require.Equal(t, 6, b.Demand()[id])
+
+	// A lane's worth either way is not worth a resize
+	b.Observe(map[uuid.UUID]int{id: 7})
+	b.Observe(map[uuid.UUID]int{id: 5})
+	require.Equal(t, 6, b.Demand()[id])
+
+	// A single spike is averaged out, not taken as it is
+	b.Observe(map[uuid.UUID]int{id: 100})
+	require.Less(t, b.Demand()[id], 30)
+
+	// Going idle brings the demand down over a few samples
+	for range 30 {
+		b.Observe(nil)
+	}
+	require.Zero(t, b.Demand()[id])
+}
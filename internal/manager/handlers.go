@@ -0,0 +1,63 @@
+// internal/manager/handlers.go
+package manager
+
+import (
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/worker"
+)
+
+// SetHandlerRegistry sets the handler types tenants may configure. It
+// applies to tenants added afterwards; the default registry holds the
+// built-in handlers.
+func (tm *TenantManager) SetHandlerRegistry(r *worker.Registry) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.handlers = r
+}
+
+// Handlers returns a tenant's handler routes; nil means every message is
+// stored
+func (tm *TenantManager) Handlers(tenantID uuid.UUID) ([]model.HandlerRoute, error) {
+	if !tm.hasTenant(tenantID) {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return t.Settings.Handlers, nil
+}
+
+// SetHandlers replaces the routes that pick a tenant's handlers by event
+// type. Messages already in a chain finish it; the next ones take the new
+// routes. Nil restores storing every message.
+func (tm *TenantManager) SetHandlers(tenantID uuid.UUID, routes []model.HandlerRoute) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	router, ok := tm.routers[tenantID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	built, err := tm.handlers.Routes(routes)
+	if err != nil {
+		return err
+	}
+
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.Handlers = routes
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist handlers: %w", err)
+	}
+
+	router.SetRoutes(built)
+	return nil
+}
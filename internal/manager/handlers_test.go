@@ -0,0 +1,80 @@
+package manager_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+	"multi-tenant/internal/worker"
+)
+
+func TestHandlers(t *testing.T) {
+	store := storage.NewMemoryStore()
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), store)
+	tm.SetBatchConfig(1, 10*time.Millisecond)
+	defer tm.ShutdownAll()
+
+	stored := func(tenantID uuid.UUID) []model.Message {
+		page, err := store.ListMessagesPaginated(tenantID, "", storage.MessageFilter{})
+		require.NoError(t, err)
+		return page.Messages
+	}
+
+	id := uuid.New()
+	invalid := []model.HandlerRoute{{EventTypes: "#", Handlers: []model.HandlerSpec{{Type: "archive"}}}}
+	require.ErrorIs(t, tm.AddTenant(id, model.TenantSettings{Handlers: invalid}), worker.ErrInvalidHandler)
+
+	require.NoError(t, tm.AddTenant(id, model.TenantSettings{Handlers: []model.HandlerRoute{
+		{EventTypes: "audit.#", Handlers: []model.HandlerSpec{{Type: "drop"}}},
+		{EventTypes: "order.*", Handlers: []model.HandlerSpec{
+			{Type: "validate", Config: json.RawMessage(`{"required":["id"]}`)},
+			{Type: "transform", Config: json.RawMessage(`{"set":{"source":"orders"}}`)},
+			{Type: "persist"},
+		}},
+	}}))
+
+	require.NoError(t, tm.Publish(id, []byte(`{"user":1}`), messaging.WithEventType("audit.login")))
+	require.NoError(t, tm.Publish(id, []byte(`{"total":5}`), messaging.WithEventType("order.created")))
+	require.NoError(t, tm.Publish(id, []byte(`{"id":7}`), messaging.WithEventType("order.created")))
+	require.NoError(t, tm.Publish(id, []byte(`{"user":2}`), messaging.WithEventType("user.created")))
+	require.Eventually(t, func() bool { return len(stored(id)) == 2 }, time.Second, 10*time.Millisecond)
+
+	payloads := make([]string, 0, 2)
+	for _, m := range stored(id) {
+		payloads = append(payloads, string(m.Payload))
+	}
+	require.ElementsMatch(t, []string{`{"id":7,"source":"orders"}`, `{"user":2}`}, payloads,
+		"audit events are dropped, orders without an id rejected and unrouted events stored")
+
+	// Ingested messages run through the same handlers
+	ingest := func(eventType, body string) error {
+		return tm.Ingest(id, messaging.Delivery{Body: []byte(body), RoutingKey: messaging.RoutingKey(id.String(), eventType)})
+	}
+	require.NoError(t, ingest("audit.login", `{"user":1}`))
+	require.ErrorIs(t, ingest("order.created", `{"total":5}`), manager.ErrRejected)
+	require.NoError(t, ingest("order.created", `{"id":8}`))
+	payloads = payloads[:0]
+	for _, m := range stored(id) {
+		payloads = append(payloads, string(m.Payload))
+	}
+	require.ElementsMatch(t, []string{`{"id":7,"source":"orders"}`, `{"user":2}`, `{"id":8,"source":"orders"}`}, payloads)
+
+	// Routes change without restarting the consumer
+	require.ErrorIs(t, tm.SetHandlers(id, invalid), worker.ErrInvalidHandler)
+	require.NoError(t, tm.SetHandlers(id, nil))
+	routes, err := tm.Handlers(id)
+	require.NoError(t, err)
+	require.Empty(t, routes)
+
+	require.NoError(t, tm.Publish(id, []byte(`{"user":3}`), messaging.WithEventType("audit.login")))
+	require.Eventually(t, func() bool { return len(stored(id)) == 4 }, time.Second, 10*time.Millisecond)
+
+	require.ErrorIs(t, tm.SetHandlers(uuid.New(), nil), manager.ErrTenantNotFound)
+}
@@ -0,0 +1,64 @@
+// internal/manager/limits.go
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+	"multi-tenant/internal/ratelimit"
+)
+
+// SetPublishLimits changes a tenant's publish rate limits and monthly
+// quotas, overriding its plan's; nil restores the plan's
+func (tm *TenantManager) SetPublishLimits(tenantID uuid.UUID, limits *model.PublishLimits) error {
+	if err := ratelimit.Validate(limits); err != nil {
+		return err
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, ok := tm.consumers[tenantID]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.PublishLimits = limits
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist publish limits: %w", err)
+	}
+
+	tm.limiter.SetLimits(tenantID.String(), plan.PublishLimits(tm.tenantPlans[tenantID], limits))
+	return nil
+}
+
+// PublishLimits returns the publish limits that apply to a tenant, its
+// own or its plan's and nil if neither has any, and what it published
+// this month
+func (tm *TenantManager) PublishLimits(tenantID uuid.UUID) (*model.PublishLimits, model.PublishUsage, error) {
+	if !tm.hasTenant(tenantID) {
+		return nil, model.PublishUsage{}, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return nil, model.PublishUsage{}, err
+	}
+	usage, err := tm.limiter.Usage(tenantID.String())
+	if err != nil {
+		return nil, model.PublishUsage{}, err
+	}
+	p, _ := tm.tenantPlan(tenantID)
+	return plan.PublishLimits(p, t.Settings.PublishLimits), usage, nil
+}
+
+// RunLimiter stores publish usage for the monthly quotas until ctx is
+// cancelled
+func (tm *TenantManager) RunLimiter(ctx context.Context) {
+	tm.limiter.Run(ctx, ratelimit.DefaultFlushInterval)
+}
@@ -0,0 +1,102 @@
+// internal/manager/plans.go
+package manager
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+)
+
+// SetPlans sets the plans tenants may be on. It applies to tenants added
+// afterwards; until it is called every tenant is unlimited.
+func (tm *TenantManager) SetPlans(plans *plan.Catalog) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.plans = plans
+}
+
+// Plans returns the configured plans
+func (tm *TenantManager) Plans() []model.Plan {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	return tm.plans.List()
+}
+
+// Plan returns a tenant's plan with its overrides applied
+func (tm *TenantManager) Plan(tenantID uuid.UUID) (model.Plan, error) {
+	p, ok := tm.tenantPlan(tenantID)
+	if !ok {
+		return model.Plan{}, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return p, nil
+}
+
+func (tm *TenantManager) tenantPlan(tenantID uuid.UUID) (model.Plan, bool) {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	p, ok := tm.tenantPlans[tenantID]
+	return p, ok
+}
+
+// SetPlan moves a tenant to another plan, with overrides replacing its
+// current ones. The new limits apply at once: queue limits are changed on
+// the broker first and workers above the plan's maximum are stopped.
+// Features only gate what a tenant may create, so an existing queue keeps
+// its type and priorities.
+func (tm *TenantManager) SetPlan(tenantID uuid.UUID, name string, overrides *model.PlanOverrides) error {
+	var resizes []resize
+	defer func() { applyResizes(resizes) }()
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	p, err := tm.plans.Resolve(name, overrides)
+	if err != nil {
+		return err
+	}
+	if _, ok := tm.consumers[tenantID]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+
+	// The tenant's own limits are kept, capped at the new plan's
+	old, _ := plan.QueueLimits(tm.tenantPlans[tenantID], t.Settings.QueueType, t.Settings.Limits)
+	limits, _ := plan.QueueLimits(p, t.Settings.QueueType, t.Settings.Limits)
+	if queueLimits(limits) != queueLimits(old) {
+		opts := queueOptions(t.Settings)
+		opts.Limits = queueLimits(limits)
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+		if err := tm.broker.SetQueueLimits(tenantID.String(), opts.Limits); err != nil {
+			return err
+		}
+	}
+
+	t.Settings.Plan = name
+	t.Settings.PlanOverrides = overrides
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist plan: %w", err)
+	}
+	tm.tenantPlans[tenantID] = p
+	tm.limiter.SetLimits(tenantID.String(), plan.PublishLimits(p, t.Settings.PublishLimits))
+
+	if n := t.Concurrency; p.Workers(n) < n {
+		resizes = tm.applyWorkers(tenantID, p.MaxWorkers)
+		if err := tm.storage.UpdateTenantConcurrency(tenantID.String(), p.MaxWorkers); err != nil {
+			return fmt.Errorf("failed to persist concurrency: %w", err)
+		}
+	}
+
+	log.Printf("Tenant %s moved to plan %q", tenantID, p.Name)
+	return nil
+}
@@ -0,0 +1,106 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+	"multi-tenant/internal/storage"
+)
+
+func TestPlans(t *testing.T) {
+	plans, err := plan.NewCatalog(map[string]model.Plan{
+		"free": {
+			MaxWorkers:    1,
+			PublishLimits: &model.PublishLimits{MonthlyMessages: 100},
+			QueueLimits:   &model.QueueLimits{MaxLength: 10},
+		},
+		"standard": {
+			MaxWorkers:  4,
+			QueueLimits: &model.QueueLimits{MaxLength: 1000},
+			Features:    []string{plan.FeaturePriority, plan.FeatureScheduling},
+		},
+	}, "free")
+	require.NoError(t, err)
+
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), storage.NewMemoryStore())
+	tm.SetPlans(plans)
+	defer tm.ShutdownAll()
+
+	id := uuid.New()
+	require.ErrorIs(t, tm.AddTenant(id, model.TenantSettings{MaxPriority: 5}), plan.ErrFeatureDisabled)
+	require.ErrorIs(t, tm.AddTenant(id, model.TenantSettings{Plan: "gold"}), plan.ErrUnknownPlan)
+	require.NoError(t, tm.AddTenant(id, model.TenantSettings{}))
+
+	p, err := tm.Plan(id)
+	require.NoError(t, err)
+	require.Equal(t, "free", p.Name)
+	require.ErrorIs(t, tm.SetWorkerCount(id.String(), 2), plan.ErrLimitExceeded)
+	require.ErrorIs(t, tm.SetQueueLimits(id, &model.QueueLimits{MaxLength: 50}), plan.ErrLimitExceeded)
+	require.NoError(t, tm.SetQueueLimits(id, &model.QueueLimits{MaxLength: 5}))
+	_, err = tm.Schedule(id, []byte(`{}`), messaging.WithDelay(time.Minute))
+	require.ErrorIs(t, err, plan.ErrFeatureDisabled)
+
+	limits, _, err := tm.PublishLimits(id)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), limits.MonthlyMessages, "the plan's apply")
+
+	// Upgrading lifts the limits at once; an override raises one further
+	require.NoError(t, tm.SetPlan(id, "standard", &model.PlanOverrides{MaxWorkers: 8}))
+	require.NoError(t, tm.SetWorkerCount(id.String(), 8))
+	require.NoError(t, tm.SetQueueLimits(id, &model.QueueLimits{MaxLength: 500}))
+	_, err = tm.Schedule(id, []byte(`{}`), messaging.WithDelay(time.Minute))
+	require.NoError(t, err)
+	limits, _, err = tm.PublishLimits(id)
+	require.NoError(t, err)
+	require.Nil(t, limits)
+
+	// Downgrading stops the workers above the plan's maximum
+	require.NoError(t, tm.SetPlan(id, "free", nil))
+	p, err = tm.Plan(id)
+	require.NoError(t, err)
+	require.Equal(t, 1, p.MaxWorkers)
+}
+
+func TestPruneMessages(t *testing.T) {
+	plans, err := plan.NewCatalog(map[string]model.Plan{
+		"free":     {RetentionDays: 7},
+		"standard": {},
+	}, "free")
+	require.NoError(t, err)
+
+	store := storage.NewMemoryStore()
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), store)
+	tm.SetPlans(plans)
+	defer tm.ShutdownAll()
+
+	free, standard := uuid.New(), uuid.New()
+	require.NoError(t, tm.AddTenant(free, model.TenantSettings{}))
+	require.NoError(t, tm.AddTenant(standard, model.TenantSettings{}))
+	require.NoError(t, tm.SetPlan(standard, "standard", nil))
+
+	now := time.Now()
+	for _, id := range []uuid.UUID{free, standard} {
+		for _, age := range []time.Duration{time.Hour, 8 * 24 * time.Hour} {
+			require.NoError(t, store.InsertMessage(&model.Message{
+				ID: uuid.Must(uuid.NewV7()), TenantID: id, Payload: []byte(`{}`), CreatedAt: now.Add(-age),
+			}))
+		}
+	}
+
+	n, err := tm.PruneMessages()
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n, "only the free plan's week-old message expires")
+
+	// Overrides extend a plan's retention
+	require.NoError(t, tm.SetPlan(free, "free", &model.PlanOverrides{RetentionDays: 30}))
+	n, err = tm.PruneMessages()
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
@@ -0,0 +1,66 @@
+// internal/manager/retention.go
+package manager
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultRetentionInterval is how often RunRetention deletes expired
+// messages
+const DefaultRetentionInterval = time.Hour
+
+// PruneMessages deletes stored messages older than their tenant's plan
+// retention and returns how many it deleted. Tenants whose plan keeps
+// messages are skipped.
+func (tm *TenantManager) PruneMessages() (int64, error) {
+	now := time.Now()
+
+	tm.mu.RLock()
+	cutoffs := make(map[uuid.UUID]time.Time, len(tm.tenantPlans))
+	for tenantID, p := range tm.tenantPlans {
+		if p.RetentionDays > 0 {
+			cutoffs[tenantID] = now.AddDate(0, 0, -p.RetentionDays)
+		}
+	}
+	tm.mu.RUnlock()
+
+	var total int64
+	var errs []error
+	for tenantID, before := range cutoffs {
+		n, err := tm.storage.DeleteMessagesBefore(tenantID, before)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("prune messages of tenant %s: %w", tenantID, err))
+			continue
+		}
+		total += n
+	}
+	return total, errors.Join(errs...)
+}
+
+// RunRetention deletes expired messages every DefaultRetentionInterval
+// until ctx is cancelled
+func (tm *TenantManager) RunRetention(ctx context.Context) {
+	ticker := time.NewTicker(DefaultRetentionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			n, err := tm.PruneMessages()
+			if err != nil {
+				log.Printf("Failed to prune messages: %v", err)
+			}
+			if n > 0 {
+				log.Printf("Deleted %d messages past their retention", n)
+			}
+		}
+	}
+}
@@ -0,0 +1,53 @@
+// internal/manager/scheduled.go
+package manager
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+)
+
+// Schedule holds a message for a registered tenant until deliverAt,
+// counting it against the tenant's publish limits now
+func (tm *TenantManager) Schedule(tenantID uuid.UUID, body []byte, opts ...messaging.PublishOption) (*model.ScheduledMessage, error) {
+	if !tm.hasTenant(tenantID) {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	if p, _ := tm.tenantPlan(tenantID); !p.HasFeature(plan.FeatureScheduling) {
+		return nil, fmt.Errorf("schedule for tenant %s: %w: %s", tenantID, plan.ErrFeatureDisabled, plan.FeatureScheduling)
+	}
+	// Scheduling bypasses the broker, so it is counted here
+	res, err := tm.limiter.Reserve(tenantID.String(), len(body))
+	if err != nil {
+		return nil, fmt.Errorf("schedule for tenant %s: %w", tenantID, err)
+	}
+	sm, err := tm.scheduler.Schedule(tenantID, body, messaging.NewPublishOptions(opts...))
+	if err != nil {
+		res.Cancel()
+		return nil, err
+	}
+	tm.meter.Record(tenantID, model.Usage{Published: 1})
+	return sm, nil
+}
+
+// ListScheduled returns the tenant's undelivered scheduled messages
+func (tm *TenantManager) ListScheduled(tenantID uuid.UUID) ([]model.ScheduledMessage, error) {
+	return tm.storage.ListScheduledMessages(tenantID)
+}
+
+// CancelScheduled drops an undelivered scheduled message; it returns
+// storage.ErrNotFound if the tenant has no such message
+func (tm *TenantManager) CancelScheduled(tenantID, id uuid.UUID) error {
+	return tm.storage.CancelScheduledMessage(tenantID, id)
+}
+
+// RunScheduler publishes scheduled messages as they fall due until ctx
+// is cancelled
+func (tm *TenantManager) RunScheduler(ctx context.Context) {
+	tm.scheduler.Run(ctx)
+}
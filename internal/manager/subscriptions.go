@@ -0,0 +1,125 @@
+// internal/manager/subscriptions.go
+package manager
+
+import (
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+// RequestSubscription asks to receive the source tenant's messages whose
+// event type matches pattern; it stays pending until the source approves
+func (tm *TenantManager) RequestSubscription(target, source uuid.UUID, pattern string) (*model.Subscription, error) {
+	if err := messaging.ValidateEventPattern(pattern); err != nil {
+		return nil, err
+	}
+	if source == target {
+		return nil, fmt.Errorf("%w: a tenant cannot subscribe to itself", ErrNotAllowed)
+	}
+	if _, err := tm.storage.GetTenant(source); errors.Is(err, storage.ErrNotFound) {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, source)
+	} else if err != nil {
+		return nil, err
+	}
+
+	sub := &model.Subscription{
+		ID:             uuid.New(),
+		SourceTenantID: source,
+		TargetTenantID: target,
+		Pattern:        pattern,
+		Status:         model.SubscriptionPending,
+	}
+	if err := tm.storage.CreateSubscription(sub); err != nil {
+		return nil, fmt.Errorf("failed to save subscription: %w", err)
+	}
+	log.Printf("Tenant %s requested subscription %s to %s.%s", target, sub.ID, source, pattern)
+	return sub, nil
+}
+
+// ApproveSubscription starts fanning out a pending subscription; only its
+// source tenant may approve it
+func (tm *TenantManager) ApproveSubscription(tenantID, id uuid.UUID) (*model.Subscription, error) {
+	sub, err := tm.subscriptionFor(tenantID, id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.SourceTenantID != tenantID {
+		return nil, fmt.Errorf("%w: only the source tenant can approve", ErrNotAllowed)
+	}
+	if sub.Status != model.SubscriptionPending {
+		return nil, fmt.Errorf("%w: subscription is %s", ErrInvalidTransition, sub.Status)
+	}
+
+	if err := tm.storage.UpdateSubscriptionStatus(id, model.SubscriptionApproved); err != nil {
+		return nil, err
+	}
+	sub.Status = model.SubscriptionApproved
+	tm.reloadRoutes(sub.SourceTenantID)
+
+	log.Printf("Subscription %s approved", id)
+	return sub, nil
+}
+
+// RevokeSubscription stops a subscription; either side may revoke it
+func (tm *TenantManager) RevokeSubscription(tenantID, id uuid.UUID) error {
+	sub, err := tm.subscriptionFor(tenantID, id)
+	if err != nil {
+		return err
+	}
+	if sub.Status == model.SubscriptionRevoked {
+		return nil
+	}
+
+	if err := tm.storage.UpdateSubscriptionStatus(id, model.SubscriptionRevoked); err != nil {
+		return err
+	}
+	tm.reloadRoutes(sub.SourceTenantID)
+
+	log.Printf("Subscription %s revoked by tenant %s", id, tenantID)
+	return nil
+}
+
+// ListSubscriptions returns the subscriptions the tenant is either side of
+func (tm *TenantManager) ListSubscriptions(tenantID uuid.UUID) ([]model.Subscription, error) {
+	return tm.storage.ListSubscriptions(tenantID)
+}
+
+// subscriptionFor loads a subscription the tenant is party to; others get
+// storage.ErrNotFound, so IDs do not leak between tenants
+func (tm *TenantManager) subscriptionFor(tenantID, id uuid.UUID) (*model.Subscription, error) {
+	sub, err := tm.storage.GetSubscription(id)
+	if err != nil {
+		return nil, err
+	}
+	if sub.SourceTenantID != tenantID && sub.TargetTenantID != tenantID {
+		return nil, storage.ErrNotFound
+	}
+	return sub, nil
+}
+
+// reloadRoutes rebuilds the fan-out routes of a source tenant from its
+// approved subscriptions
+func (tm *TenantManager) reloadRoutes(source uuid.UUID) {
+	subs, err := tm.storage.ListSubscriptions(source)
+	if err != nil {
+		log.Printf("Failed to load subscriptions for tenant %s: %v", source, err)
+		return
+	}
+
+	var routes []messaging.FanoutRoute
+	for _, sub := range subs {
+		if sub.SourceTenantID == source && sub.Status == model.SubscriptionApproved {
+			routes = append(routes, messaging.FanoutRoute{
+				Target:  sub.TargetTenantID.String(),
+				Pattern: sub.Pattern,
+			})
+		}
+	}
+	tm.fanout.SetRoutes(source.String(), routes)
+}
@@ -0,0 +1,81 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+func TestSubscriptionFanout(t *testing.T) {
+	store := storage.NewMemoryStore()
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), store)
+	tm.SetBatchConfig(1, 10*time.Millisecond)
+	defer tm.ShutdownAll()
+
+	source, target := uuid.New(), uuid.New()
+	require.NoError(t, tm.AddTenant(source, model.TenantSettings{}))
+	require.NoError(t, tm.AddTenant(target, model.TenantSettings{}))
+
+	stored := func(tenantID uuid.UUID) int {
+		page, err := store.ListMessagesPaginated(tenantID, "", storage.MessageFilter{})
+		require.NoError(t, err)
+		return len(page.Messages)
+	}
+
+	sub, err := tm.RequestSubscription(target, source, "order.*")
+	require.NoError(t, err)
+	require.Equal(t, model.SubscriptionPending, sub.Status)
+
+	// Only the source may approve, and nothing fans out until it does
+	_, err = tm.ApproveSubscription(target, sub.ID)
+	require.ErrorIs(t, err, manager.ErrNotAllowed)
+	require.NoError(t, tm.Publish(source, []byte(`{"n":1}`), messaging.WithEventType("order.created")))
+	require.Eventually(t, func() bool { return stored(source) == 1 }, time.Second, 10*time.Millisecond)
+
+	sub, err = tm.ApproveSubscription(source, sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.SubscriptionApproved, sub.Status)
+
+	require.NoError(t, tm.Publish(source, []byte(`{"n":2}`), messaging.WithEventType("order.created")))
+	require.NoError(t, tm.Publish(source, []byte(`{"n":3}`), messaging.WithEventType("user.created")))
+	require.Eventually(t, func() bool { return stored(target) == 1 }, time.Second, 10*time.Millisecond)
+
+	page, err := store.ListMessagesPaginated(target, "", storage.MessageFilter{})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"n":2}`, string(page.Messages[0].Payload))
+	require.Equal(t, source.String(), page.Messages[0].Headers[messaging.SourceTenantHeader])
+	require.Equal(t, messaging.RoutingKey(source.String(), "order.created"), page.Messages[0].RoutingKey)
+
+	// Either side can revoke
+	require.NoError(t, tm.RevokeSubscription(target, sub.ID))
+	_, err = tm.ApproveSubscription(source, sub.ID)
+	require.ErrorIs(t, err, manager.ErrInvalidTransition)
+	require.NoError(t, tm.Publish(source, []byte(`{"n":4}`), messaging.WithEventType("order.created")))
+	require.Eventually(t, func() bool { return stored(source) == 4 }, time.Second, 10*time.Millisecond)
+	require.Equal(t, 1, stored(target))
+
+	subs, err := tm.ListSubscriptions(source)
+	require.NoError(t, err)
+	require.Len(t, subs, 1)
+	require.Equal(t, model.SubscriptionRevoked, subs[0].Status)
+}
+
+func TestBindingCannotSelectOtherTenant(t *testing.T) {
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), storage.NewMemoryStore())
+	defer tm.ShutdownAll()
+
+	a, b := uuid.New(), uuid.New()
+	require.NoError(t, tm.AddTenant(a, model.TenantSettings{}))
+	require.NoError(t, tm.AddTenant(b, model.TenantSettings{}))
+
+	require.ErrorIs(t, tm.AddBinding(a, messaging.TenantPattern(b.String())), messaging.ErrInvalidPattern)
+	require.ErrorIs(t, tm.AddBinding(a, b.String()+".order.*"), messaging.ErrInvalidPattern)
+	require.NoError(t, tm.AddBinding(a, a.String()+".order.*"))
+}
@@ -2,43 +2,116 @@
 package manager
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
-	"github.com/streadway/amqp"
 
 	"multi-tenant/internal/consumer"
 	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/metering"
+	"multi-tenant/internal/metrics"
 	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+	"multi-tenant/internal/ratelimit"
+	"multi-tenant/internal/scheduler"
 	"multi-tenant/internal/storage"
+	"multi-tenant/internal/worker"
 )
 
+// IdempotencyKeyHeader is the message header producers may set to deduplicate
+// messages; without it the AMQP message ID is used
+const IdempotencyKeyHeader = "x-idempotency-key"
+
+var (
+	ErrTenantNotFound    = errors.New("tenant not found")
+	ErrNotAllowed        = errors.New("not allowed")
+	ErrInvalidTransition = errors.New("invalid status transition")
+	ErrNotStream         = errors.New("tenant queue is not a stream")
+	ErrInvalidWeight     = errors.New("invalid weight")
+	ErrInvalidAutoscale  = errors.New("invalid autoscale settings")
+	// ErrRejected is returned by Ingest for messages the tenant's handlers
+	// reject; retrying them would not help
+	ErrRejected = errors.New("rejected by tenant handlers")
+)
+
+// streamResumeSlack is how far before the last stored message a restarted
+// stream consumer resumes, covering messages received out of order; the
+// overlap is dropped as duplicates
+const streamResumeSlack = time.Minute
+
 type TenantManager struct {
-	rabbitConn *amqp.Connection
-	rabbit     *messaging.RabbitClient
-	storage    *storage.Storage
+	broker     messaging.Broker
+	fanout     *messaging.FanoutBroker
+	scheduler  *scheduler.Scheduler
+	limiter    *ratelimit.Limiter
+	meter      *metering.Meter
+	plans      *plan.Catalog
+	budget     *Budget // nil without a global worker budget
+	autoscaler *Autoscaler
+	handlers   *worker.Registry
+	storage    storage.Store
+
+	batchSize     int
+	flushInterval time.Duration
 
 	mu        sync.RWMutex
 	consumers map[uuid.UUID]*consumer.Consumer
+	batchers  map[uuid.UUID]*Batcher
+	routers   map[uuid.UUID]*worker.Router
+	// laneTargets outlive the consumers a Replay replaces
+	laneTargets map[uuid.UUID]*laneTarget
+	// tenantPlans are the tenants' plans with their overrides applied
+	tenantPlans map[uuid.UUID]model.Plan
 }
 
-func NewTenantManager(
-	rabbitConn *amqp.Connection,
-	rabbit *messaging.RabbitClient,
-	storage *storage.Storage,
-) *TenantManager {
+// NewTenantManager wraps broker so that publishes are held to the tenant's
+// publish limits, delayed publishes are held by the scheduler and due ones
+// are fanned out to approved subscriptions
+func NewTenantManager(broker messaging.Broker, storage storage.Store) *TenantManager {
+	fanout := messaging.NewFanoutBroker(broker)
+	sched := scheduler.New(fanout, storage)
+	limiter := ratelimit.NewLimiter(storage)
 	return &TenantManager{
-		rabbitConn: rabbitConn,
-		rabbit:     rabbit,
+		broker:     ratelimit.NewBroker(sched, limiter),
+		fanout:     fanout,
+		scheduler:  sched,
+		limiter:    limiter,
+		meter:      metering.NewMeter(storage),
+		plans:      &plan.Catalog{},
+		autoscaler: NewAutoscaler(AutoscaleConfig{}),
+		handlers:   worker.NewRegistry(),
 		storage:    storage,
 		consumers:  make(map[uuid.UUID]*consumer.Consumer),
+		batchers:   make(map[uuid.UUID]*Batcher),
+		routers:    make(map[uuid.UUID]*worker.Router),
+
+		laneTargets: make(map[uuid.UUID]*laneTarget),
+		tenantPlans: make(map[uuid.UUID]model.Plan),
 	}
 }
 
-// AddTenant creates a queue, a DB partition, and spawns the consumer
-func (tm *TenantManager) AddTenant(tenantID uuid.UUID) error {
+// SetBatchConfig sets how tenant deliveries are batched into the DB.
+// It applies to tenants added afterwards; zero values select the defaults.
+func (tm *TenantManager) SetBatchConfig(size int, flushInterval time.Duration) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	tm.batchSize = size
+	tm.flushInterval = flushInterval
+}
+
+// AddTenant creates a queue, a DB partition, and spawns the consumer.
+// Settings are saved with the tenant; for an existing tenant they must be
+// the ones it was created with, as the broker fixed them on its queue.
+// A new tenant's settings must fit its plan; an existing one is started
+// with its queue limits capped at the plan's.
+func (tm *TenantManager) AddTenant(tenantID uuid.UUID, settings model.TenantSettings) error {
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -46,52 +119,233 @@ func (tm *TenantManager) AddTenant(tenantID uuid.UUID) error {
 		return nil // already exists
 	}
 
+	if _, err := worker.NewKeyFunc(settings.Ordering); err != nil {
+		return err
+	}
+	if _, err := tm.handlers.Routes(settings.Handlers); err != nil {
+		return err
+	}
+	p, err := tm.plans.Resolve(settings.Plan, settings.PlanOverrides)
+	if err != nil {
+		return err
+	}
+	_, err = tm.storage.GetTenant(tenantID)
+	isNew := errors.Is(err, storage.ErrNotFound)
+	if err != nil && !isNew {
+		return err
+	}
+	if isNew {
+		if err := plan.CheckFeatures(p, settings); err != nil {
+			return err
+		}
+	}
+	limits, err := plan.QueueLimits(p, settings.QueueType, settings.Limits)
+	if err != nil && isNew {
+		return err
+	}
+	queueOpts := queueOptions(settings)
+	queueOpts.Limits = queueLimits(limits)
+	if err := queueOpts.Validate(); err != nil {
+		return err
+	}
+	if err := ratelimit.Validate(settings.PublishLimits); err != nil {
+		return err
+	}
+	if err := ValidateAutoscale(settings.Autoscale); err != nil {
+		return err
+	}
+
 	// Create DB partition
 	if err := tm.storage.EnsurePartition(tenantID); err != nil {
 		return err
 	}
 
-	// Declare RabbitMQ queue
-	if err := tm.rabbit.DeclareQueue(tenantID.String()); err != nil {
+	// Declare tenant queue
+	if err := tm.broker.DeclareQueue(tenantID.String(), queueOpts); err != nil {
 		return err
 	}
 
-	// Start consumer
-	c, err := consumer.StartConsumer(tm.rabbitConn, tenantID.String(), tm.handleMessage)
-	if err != nil {
+	// Restore extra bindings, which the broker may not have persisted,
+	// and the tenant's fan-out routes
+	tm.restoreBindings(tenantID)
+	tm.reloadRoutes(tenantID)
+
+	// Start consumer, batching its deliveries into the DB
+	if err := tm.startConsumer(tenantID, settings, tm.resumeOptions(tenantID, queueOpts)...); err != nil {
 		return err
 	}
-	tm.consumers[tenantID] = c
 
 	if err := tm.storage.CreateTenant(tenantID); err != nil {
 		return fmt.Errorf("failed to save tenant: %w", err)
 	}
+	if err := tm.storage.UpdateTenantSettings(tenantID, settings); err != nil {
+		return fmt.Errorf("failed to save tenant settings: %w", err)
+	}
+	tm.limiter.SetLimits(tenantID.String(), plan.PublishLimits(p, settings.PublishLimits))
+	tm.tenantPlans[tenantID] = p
+	if tm.budget != nil {
+		tm.budget.Add(tenantID, settings.Weight)
+	}
+	tm.autoscaler.Set(tenantID, settings.Autoscale)
 
 	log.Printf("Tenant %s added and consumer started", tenantID)
 	return nil
 }
 
-// RemoveTenant stops the consumer, deletes the queue, and removes from map
-func (tm *TenantManager) RemoveTenant(tenantID uuid.UUID) error {
+// startConsumer consumes the tenant queue through its handlers into a
+// new batcher. Callers must hold mu.
+func (tm *TenantManager) startConsumer(tenantID uuid.UUID, settings model.TenantSettings, opts ...messaging.ConsumeOption) error {
+	key, err := worker.NewKeyFunc(settings.Ordering)
+	if err != nil {
+		return err
+	}
+	routes, err := tm.handlers.Routes(settings.Handlers)
+	if err != nil {
+		return err
+	}
+	router := worker.NewRouter(worker.Persist{}, routes)
+
+	batcher := NewBatcher(tenantID.String(), tm.storage, tm.meter, tm.batchSize, tm.flushInterval)
+	// Quorum queues dead-letter a batch that keeps failing by themselves
+	batcher.SetRequeueFailed(queueOptions(settings).Type == messaging.QueueQuorum)
+	c, err := consumer.StartConsumer(tm.broker, tenantID.String(), key, func(tenantID string, msg messaging.Delivery) {
+		tm.handleMessage(batcher, router, tenantID, msg)
+	}, opts...)
+	if err != nil {
+		batcher.Stop()
+		return err
+	}
+	c.OnStop = batcher.Stop
+	tm.consumers[tenantID] = c
+	tm.batchers[tenantID] = batcher
+	tm.routers[tenantID] = router
+	if _, ok := tm.laneTargets[tenantID]; !ok {
+		t := &laneTarget{}
+		t.n.Store(1)
+		tm.laneTargets[tenantID] = t
+	}
+	return nil
+}
+
+// queueOptions maps tenant settings onto the broker's queue options
+func queueOptions(settings model.TenantSettings) messaging.QueueOptions {
+	return messaging.QueueOptions{
+		Type:          messaging.QueueType(settings.QueueType),
+		MaxPriority:   settings.MaxPriority,
+		DeliveryLimit: settings.DeliveryLimit,
+		Limits:        queueLimits(settings.Limits),
+	}
+}
+
+func queueLimits(limits *model.QueueLimits) messaging.QueueLimits {
+	if limits == nil {
+		return messaging.QueueLimits{}
+	}
+	return messaging.QueueLimits{
+		MaxLength:      limits.MaxLength,
+		MaxLengthBytes: limits.MaxLengthBytes,
+		MessageTTL:     time.Duration(limits.MessageTTLMS) * time.Millisecond,
+		Overflow:       messaging.OverflowPolicy(limits.Overflow),
+	}
+}
+
+// resumeOptions starts a stream queue consumer shortly before the last
+// message stored for the tenant, or at the start of the stream, since the
+// broker does not track where a stream consumer got to
+func (tm *TenantManager) resumeOptions(tenantID uuid.UUID, opts messaging.QueueOptions) []messaging.ConsumeOption {
+	if opts.Type != messaging.QueueStream {
+		return nil
+	}
+	page, err := tm.storage.ListMessagesPaginated(tenantID, "", storage.MessageFilter{Limit: 1, Order: storage.SortDesc})
+	if err != nil || len(page.Messages) == 0 {
+		return []messaging.ConsumeOption{messaging.FromOffset(messaging.OffsetFirst)}
+	}
+	last := page.Messages[0].CreatedAt
+	if at := page.Messages[0].ReceivedAt; at != nil {
+		last = *at
+	}
+	return []messaging.ConsumeOption{messaging.FromOffset(messaging.StreamOffset{Time: last.Add(-streamResumeSlack)})}
+}
+
+// Replay restarts a stream queue tenant's consumer at offset, so messages
+// the broker still holds are handled again. Those already stored within
+// the dedup window are skipped as duplicates.
+func (tm *TenantManager) Replay(tenantID uuid.UUID, offset messaging.StreamOffset) error {
+	tm.mu.RLock()
+	c, ok := tm.consumers[tenantID]
+	tm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	if queueOptions(t.Settings).Type != messaging.QueueStream {
+		return fmt.Errorf("%w: %s", ErrNotStream, tenantID)
+	}
+
+	// The old consumer's last handlers and batch flush may need mu, so it
+	// stops before mu is taken; the new one starts only once it has
+	c.Stop()
+
+	var resizes []resize
+	defer func() { applyResizes(resizes) }()
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
+	switch cur, ok := tm.consumers[tenantID]; {
+	case !ok:
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	case cur != c:
+		return fmt.Errorf("consumer of tenant %s was restarted during replay", tenantID)
+	}
+	if err := tm.startConsumer(tenantID, t.Settings, messaging.FromOffset(offset)); err != nil {
+		delete(tm.consumers, tenantID)
+		delete(tm.batchers, tenantID)
+		delete(tm.routers, tenantID)
+		delete(tm.laneTargets, tenantID)
+		return fmt.Errorf("failed to restart consumer: %w", err)
+	}
+	// The new consumer starts on one lane
+	resizes = append(resizes, tm.resizeLanes(tenantID, tm.laneTargets[tenantID].get()))
+
+	log.Printf("Tenant %s replaying stream from %+v", tenantID, offset)
+	return nil
+}
+
+// RemoveTenant removes the tenant from the manager, then stops its
+// consumer and deletes its queue and records once mu is released
+func (tm *TenantManager) RemoveTenant(tenantID uuid.UUID) error {
+	tm.mu.Lock()
 	c, exists := tm.consumers[tenantID]
 	if !exists {
+		tm.mu.Unlock()
 		return nil // nothing to remove
 	}
 
+	delete(tm.consumers, tenantID)
+	delete(tm.batchers, tenantID)
+	delete(tm.routers, tenantID)
+	delete(tm.laneTargets, tenantID)
+	tm.fanout.SetRoutes(tenantID.String(), nil)
+	tm.limiter.Remove(tenantID.String())
+	delete(tm.tenantPlans, tenantID)
+	tm.autoscaler.Remove(tenantID)
+	if tm.budget != nil {
+		tm.budget.Remove(tenantID)
+		metrics.WorkerAllocated.DeleteLabelValues(tenantID.String())
+	}
+	tm.mu.Unlock()
+
+	// The consumer's last handlers and batch flush may need mu
 	c.Stop()
 
 	// Remove queue
-	queueName := "tenant_" + tenantID.String() + "_queue"
-	_, err := tm.rabbit.GetChannel().QueueDelete(queueName, false, false, false)
-	if err != nil {
-		log.Printf("Failed to delete queue %s: %v", queueName, err)
+	if err := tm.broker.DeleteQueue(tenantID.String()); err != nil {
+		log.Printf("Failed to delete queue for tenant %s: %v", tenantID, err)
 	}
 
-	delete(tm.consumers, tenantID)
-
 	if err := tm.storage.DeleteTenant(tenantID); err != nil {
 		log.Printf("Failed to remove tenant record: %v", err)
 	}
@@ -100,20 +354,101 @@ func (tm *TenantManager) RemoveTenant(tenantID uuid.UUID) error {
 	return nil
 }
 
+func (tm *TenantManager) restoreBindings(tenantID uuid.UUID) {
+	bindings, err := tm.storage.ListBindings(tenantID)
+	if err != nil {
+		log.Printf("Failed to load bindings for tenant %s: %v", tenantID, err)
+		return
+	}
+	for _, b := range bindings {
+		if err := messaging.ValidatePattern(tenantID.String(), b.Pattern); err != nil {
+			log.Printf("Skipping binding %s for tenant %s: %v", b.Pattern, tenantID, err)
+			continue
+		}
+		if err := tm.broker.Bind(tenantID.String(), b.Pattern); err != nil {
+			log.Printf("Failed to restore binding %s for tenant %s: %v", b.Pattern, tenantID, err)
+		}
+	}
+}
+
+// AddBinding routes the tenant's own messages matching an extra topic
+// pattern, such as "<tenant>.order.*", to the tenant's queue. Other
+// tenants' messages are only delivered through approved subscriptions.
+func (tm *TenantManager) AddBinding(tenantID uuid.UUID, pattern string) error {
+	if err := messaging.ValidatePattern(tenantID.String(), pattern); err != nil {
+		return err
+	}
+	if pattern == messaging.TenantPattern(tenantID.String()) {
+		return fmt.Errorf("%w: %q is always bound", messaging.ErrInvalidPattern, pattern)
+	}
+	if !tm.hasTenant(tenantID) {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+
+	if err := tm.broker.Bind(tenantID.String(), pattern); err != nil {
+		return err
+	}
+	if err := tm.storage.AddBinding(tenantID, pattern); err != nil {
+		_ = tm.broker.Unbind(tenantID.String(), pattern)
+		return fmt.Errorf("failed to save binding: %w", err)
+	}
+	log.Printf("Tenant %s bound to %s", tenantID, pattern)
+	return nil
+}
+
+// RemoveBinding removes an extra topic pattern; it returns
+// storage.ErrNotFound if the tenant has no such binding
+func (tm *TenantManager) RemoveBinding(tenantID uuid.UUID, pattern string) error {
+	if err := tm.storage.RemoveBinding(tenantID, pattern); err != nil {
+		return err
+	}
+	if err := tm.broker.Unbind(tenantID.String(), pattern); err != nil {
+		return err
+	}
+	log.Printf("Tenant %s unbound from %s", tenantID, pattern)
+	return nil
+}
+
+// ListBindings returns the tenant's extra topic patterns
+func (tm *TenantManager) ListBindings(tenantID uuid.UUID) ([]model.Binding, error) {
+	return tm.storage.ListBindings(tenantID)
+}
+
+func (tm *TenantManager) hasTenant(tenantID uuid.UUID) bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+
+	_, ok := tm.consumers[tenantID]
+	return ok
+}
+
 // Shutdown all tenants
 func (tm *TenantManager) ShutdownAll() {
 	tm.mu.Lock()
-	defer tm.mu.Unlock()
+	consumers := tm.consumers
+	tm.consumers = make(map[uuid.UUID]*consumer.Consumer)
+	tm.mu.Unlock()
 
-	for id, c := range tm.consumers {
+	// Consumers stop after mu is released; their last handlers and batch
+	// flushes may need it
+	for id, c := range consumers {
 		c.Stop()
 		log.Printf("Stopped tenant %s", id)
 	}
-	tm.consumers = make(map[uuid.UUID]*consumer.Consumer)
+
+	// Publishes have stopped, so this stores the last usage counts
+	if err := tm.limiter.Flush(); err != nil {
+		log.Printf("Failed to store publish usage: %v", err)
+	}
+	if err := tm.meter.Flush(); err != nil {
+		log.Printf("Failed to store usage ledger: %v", err)
+	}
 }
 
-// Handle incoming message (callback from consumer)
-func (tm *TenantManager) handleMessage(tenantID string, msg amqp.Delivery) {
+// Handle incoming message (callback from consumer). It runs through the
+// tenant's handlers; messages they persist are handed to the tenant's
+// batcher, which acks them once stored, and the others are settled here.
+func (tm *TenantManager) handleMessage(batcher *Batcher, router *worker.Router, tenantID string, msg messaging.Delivery) {
 	tenantUUID, err := uuid.Parse(tenantID)
 	if err != nil {
 		log.Printf("Invalid tenant ID %s", tenantID)
@@ -121,19 +456,142 @@ func (tm *TenantManager) handleMessage(tenantID string, msg amqp.Delivery) {
 		return
 	}
 
-	m := &model.Message{
-		ID:        uuid.New(),
-		TenantID:  tenantUUID,
-		Payload:   msg.Body,
-		CreatedAt: msg.Timestamp,
+	hm := worker.NewMessage(tenantID, msg)
+	err = router.Handle(context.Background(), hm)
+	switch {
+	case errors.Is(err, worker.ErrDrop):
+		batcher.Settle(msg, true)
+		return
+	case err != nil:
+		log.Printf("Tenant %s: %s message rejected by its handlers: %v", tenantID, hm.EventType, err)
+		tm.meter.Record(tenantUUID, model.Usage{Failed: 1})
+		batcher.Settle(msg, false)
+		return
+	case hm.Stored == nil:
+		batcher.Settle(msg, true)
+		return
 	}
-	if err := tm.storage.InsertMessage(m); err != nil {
-		log.Printf("DB insert failed: %v", err)
-		msg.Nack(false, false)
+
+	stored := msg
+	stored.Body = hm.Stored
+	m, err := newMessage(tenantUUID, stored)
+	if err != nil {
+		log.Printf("Failed to build message: %v", err)
+		msg.Nack(false, true)
 		return
 	}
+	batcher.Add(msg, m)
+}
+
+// Ingest runs a message through a registered tenant's handlers and stores
+// it synchronously if they persist it, bypassing the tenant queue. It is
+// the entry point for sources that track their own progress, such as
+// Kafka offsets, and must only advance once it returns nil or an error
+// wrapping ErrRejected.
+func (tm *TenantManager) Ingest(tenantID uuid.UUID, msg messaging.Delivery) error {
+	tm.mu.RLock()
+	router, ok := tm.routers[tenantID]
+	tm.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	tm.meter.Record(tenantID, model.Usage{Published: 1})
+
+	hm := worker.NewMessage(tenantID.String(), msg)
+	err := router.Handle(context.Background(), hm)
+	switch {
+	case errors.Is(err, worker.ErrDrop):
+		return nil
+	case err != nil:
+		tm.meter.Record(tenantID, model.Usage{Failed: 1})
+		return fmt.Errorf("%w: %s message: %w", ErrRejected, hm.EventType, err)
+	case hm.Stored == nil:
+		return nil
+	}
 
-	msg.Ack(false)
+	msg.Body = hm.Stored
+	m, err := newMessage(tenantID, msg)
+	if err != nil {
+		return err
+	}
+	stored, err := tm.storage.InsertMessages([]*model.Message{m})
+	if err != nil {
+		tm.meter.Record(tenantID, model.Usage{Failed: 1})
+		return err
+	}
+	if stored == 0 {
+		metrics.MessageDuplicates.WithLabelValues(tenantID.String()).Inc()
+		return nil
+	}
+	observeLatency(tenantID.String(), m, time.Now())
+	return nil
+}
+
+// newMessage builds the stored form of a delivery with a fresh UUIDv7
+func newMessage(tenantID uuid.UUID, msg messaging.Delivery) (*model.Message, error) {
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+
+	receivedAt := time.Now().UTC()
+	m := &model.Message{
+		ID:             id,
+		TenantID:       tenantID,
+		Payload:        msg.Body,
+		MessageID:      msg.MessageID,
+		CorrelationID:  msg.CorrelationID,
+		Headers:        msg.Headers,
+		ContentType:    msg.ContentType,
+		RoutingKey:     msg.RoutingKey,
+		Redelivered:    msg.Redelivered,
+		Priority:       msg.Priority,
+		ReceivedAt:     &receivedAt,
+		CreatedAt:      receivedAt,
+		IdempotencyKey: idempotencyKey(msg),
+	}
+	// Fanned-out copies arrive keyed by queue name; they are stored under
+	// the source tenant's topic they were published to
+	if source, ok := msg.Headers[messaging.SourceTenantHeader].(string); ok && source != "" {
+		m.RoutingKey = messaging.RoutingKey(source, msg.EventType())
+	}
+	// Producers that don't stamp messages leave Timestamp zero; the
+	// message is then dated by when the broker delivered it
+	if !msg.Timestamp.IsZero() {
+		publishedAt := msg.Timestamp.UTC()
+		m.PublishedAt = &publishedAt
+		m.CreatedAt = publishedAt
+	}
+	return m, nil
+}
+
+// idempotencyKey returns the producer-supplied deduplication key of a
+// delivery: the x-idempotency-key header, falling back to the message ID
+func idempotencyKey(msg messaging.Delivery) string {
+	if key, ok := msg.Headers[IdempotencyKeyHeader].(string); ok && key != "" {
+		return key
+	}
+	if msg.MessageID != "" {
+		return msg.MessageID
+	}
+	// A stream offset identifies the message across replays
+	if offset, ok := msg.Headers[messaging.StreamOffsetHeader]; ok {
+		return fmt.Sprintf("stream:%v", offset)
+	}
+	return ""
+}
+
+// Publish sends a message to a registered tenant's queue
+func (tm *TenantManager) Publish(tenantID uuid.UUID, body []byte, opts ...messaging.PublishOption) error {
+	if !tm.hasTenant(tenantID) {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+
+	if err := tm.broker.Publish(tenantID.String(), body, opts...); err != nil {
+		return err
+	}
+	tm.meter.Record(tenantID, model.Usage{Published: 1})
+	return nil
 }
 
 // ListTenantIDs returns all currently registered tenant UUIDs
@@ -148,7 +606,12 @@ func (tm *TenantManager) ListTenantIDs() []string {
 	return ids
 }
 
+// SetWorkerCount sets how many workers handle a tenant's messages, up to
+// its plan's MaxWorkers. With a worker budget it is the most the tenant
+// may be allocated.
 func (tm *TenantManager) SetWorkerCount(tenantID string, n int) error {
+	var resizes []resize
+	defer func() { applyResizes(resizes) }()
 	tm.mu.Lock()
 	defer tm.mu.Unlock()
 
@@ -157,13 +620,15 @@ func (tm *TenantManager) SetWorkerCount(tenantID string, n int) error {
 		return err
 	}
 
-	pool, ok := tm.consumers[id]
-	if !ok {
-		return fmt.Errorf("tenant not found: %s", tenantID)
+	if _, ok := tm.consumers[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	if p := tm.tenantPlans[id]; p.Workers(n) < n {
+		return fmt.Errorf("%w: %d workers, the plan allows %d", plan.ErrLimitExceeded, n, p.MaxWorkers)
 	}
 
-	// Update the worker pool
-	pool.SetWorkerCount(n)
+	// Update the worker lanes once mu is released
+	resizes = tm.applyWorkers(id, n)
 
 	// Persist concurrency level in DB
 	if err := tm.storage.UpdateTenantConcurrency(tenantID, n); err != nil {
@@ -171,3 +636,128 @@ func (tm *TenantManager) SetWorkerCount(tenantID string, n int) error {
 	}
 	return nil
 }
+
+// SetQueueLimits changes the limits of a tenant's existing queue; nil
+// removes them, leaving the plan's. They may not exceed the plan's limits.
+// The broker applies them first, so limits it cannot change are not
+// stored.
+func (tm *TenantManager) SetQueueLimits(tenantID uuid.UUID, limits *model.QueueLimits) error {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if _, ok := tm.consumers[tenantID]; !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.Limits = limits
+	effective, err := plan.QueueLimits(tm.tenantPlans[tenantID], t.Settings.QueueType, limits)
+	if err != nil {
+		return err
+	}
+	opts := queueOptions(t.Settings)
+	opts.Limits = queueLimits(effective)
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	if err := tm.broker.SetQueueLimits(tenantID.String(), opts.Limits); err != nil {
+		return err
+	}
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist queue limits: %w", err)
+	}
+
+	log.Printf("Tenant %s queue limits set to %+v", tenantID, opts.Limits)
+	return nil
+}
+
+// laneTarget is the number of worker lanes last chosen for a tenant.
+// Lanes are resized outside TenantManager.mu, as a resize waits for them
+// to drain; mu keeps one resize of the tenant at a time.
+type laneTarget struct {
+	mu sync.Mutex
+	n  atomic.Int64
+}
+
+func (t *laneTarget) get() int {
+	return int(t.n.Load())
+}
+
+// resize is a change of a tenant's lanes chosen under TenantManager.mu,
+// to be applied once it is released
+type resize struct {
+	c       *consumer.Consumer
+	batcher *Batcher
+	target  *laneTarget
+}
+
+// resizeLanes chooses n worker lanes for a tenant and returns the resize
+// that applies them. Callers must hold mu.
+func (tm *TenantManager) resizeLanes(tenantID uuid.UUID, n int) resize {
+	t := tm.laneTargets[tenantID]
+	t.n.Store(int64(n))
+	return resize{c: tm.consumers[tenantID], batcher: tm.batchers[tenantID], target: t}
+}
+
+// apply sets the tenant's lanes to the count chosen last, so a resize
+// applied late does not undo a later choice. Batches may only be acked as
+// a whole while a single lane keeps deliveries in order, so it switches
+// to acking each before adding lanes and back only once the extra lanes
+// are drained and the batch they left open, out of delivery order, has
+// been settled.
+func (r resize) apply() {
+	r.target.mu.Lock()
+	defer r.target.mu.Unlock()
+
+	n := r.target.get()
+	if n > 1 {
+		r.batcher.SetAckEach(true)
+	}
+	was := r.c.Lanes.Lanes()
+	r.c.SetWorkerCount(n)
+	if n <= 1 {
+		if was > 1 {
+			r.batcher.Flush()
+		}
+		r.batcher.SetAckEach(false)
+	}
+}
+
+// applyResizes applies resizes in order. Callers must not hold mu.
+func applyResizes(resizes []resize) {
+	for _, r := range resizes {
+		r.apply()
+	}
+}
+
+// SetOrdering changes which key keeps a tenant's related messages in
+// order; nil restores the x-ordering-key header
+func (tm *TenantManager) SetOrdering(tenantID uuid.UUID, ordering *model.OrderingKey) error {
+	key, err := worker.NewKeyFunc(ordering)
+	if err != nil {
+		return err
+	}
+
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	c, ok := tm.consumers[tenantID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+
+	t, err := tm.storage.GetTenant(tenantID)
+	if err != nil {
+		return err
+	}
+	t.Settings.Ordering = ordering
+	if err := tm.storage.UpdateTenantSettings(tenantID, t.Settings); err != nil {
+		return fmt.Errorf("failed to persist ordering: %w", err)
+	}
+
+	c.SetKey(key)
+	return nil
+}
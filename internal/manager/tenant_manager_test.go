@@ -0,0 +1,54 @@
+package manager_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+func TestShrinkLanesSettlesOpenBatch(t *testing.T) {
+	broker, store := messaging.NewMemoryBroker(), storage.NewMemoryStore()
+	tm := manager.NewTenantManager(broker, store)
+	// The batch stays open until the lanes shrink
+	tm.SetBatchConfig(1000, time.Hour)
+
+	id := uuid.New()
+	require.NoError(t, tm.AddTenant(id, model.TenantSettings{}))
+	require.NoError(t, tm.SetWorkerCount(id.String(), 3))
+
+	// "slow" and "fast" hash to different lanes; the last delivery, on the
+	// otherwise idle lane, reaches the batch before most of the others
+	const n = 30
+	for i := range n {
+		key := "slow"
+		if i == n-1 {
+			key = "fast"
+		}
+		require.NoError(t, tm.Publish(id, []byte(fmt.Sprintf(`{"n":%d}`, i)), messaging.WithOrderingKey(key)))
+	}
+	require.Eventually(t, func() bool {
+		depth, err := broker.QueueDepth(id.String())
+		return err == nil && depth == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// Shrinking drains the lanes into the batch, out of delivery order,
+	// and settles it before acking batches as a whole again
+	require.NoError(t, tm.SetWorkerCount(id.String(), 1))
+	page, err := store.ListMessagesPaginated(id, "", storage.MessageFilter{Limit: n})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, n)
+
+	// Anything left unacked would be requeued once the consumer stops
+	tm.ShutdownAll()
+	depth, err := broker.QueueDepth(id.String())
+	require.NoError(t, err)
+	require.Zero(t, depth, "every delivery tag is settled")
+}
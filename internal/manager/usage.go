@@ -0,0 +1,35 @@
+// internal/manager/usage.go
+package manager
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/metering"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+// Usage returns the hourly usage ledger of a tenant for hours in
+// [from, to). Counts not yet flushed by RunMeter are missing from the
+// latest hour.
+func (tm *TenantManager) Usage(tenantID uuid.UUID, from, to time.Time) ([]model.UsageRecord, error) {
+	// A nil tenant ID would select every tenant's rows
+	if tenantID == uuid.Nil {
+		return nil, fmt.Errorf("%w: %s", ErrTenantNotFound, tenantID)
+	}
+	return tm.storage.ListUsage(storage.UsageFilter{TenantID: tenantID, From: from, To: to})
+}
+
+// AllUsage is Usage for every tenant, including deleted ones
+func (tm *TenantManager) AllUsage(from, to time.Time) ([]model.UsageRecord, error) {
+	return tm.storage.ListUsage(storage.UsageFilter{From: from, To: to})
+}
+
+// RunMeter adds metered usage to the ledger until ctx is cancelled
+func (tm *TenantManager) RunMeter(ctx context.Context) {
+	tm.meter.Run(ctx, metering.DefaultFlushInterval)
+}
@@ -0,0 +1,40 @@
+package manager_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/manager"
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+func TestUsageIsTenantScoped(t *testing.T) {
+	store := storage.NewMemoryStore()
+	tm := manager.NewTenantManager(messaging.NewMemoryBroker(), store)
+	defer tm.ShutdownAll()
+
+	hour := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	a, b := uuid.New(), uuid.New()
+	require.NoError(t, store.AddUsage([]model.UsageRecord{
+		{TenantID: a, Hour: hour, Usage: model.Usage{Published: 1}},
+		{TenantID: b, Hour: hour, Usage: model.Usage{Published: 2}},
+	}))
+
+	records, err := tm.Usage(a, hour, hour.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, a, records[0].TenantID)
+
+	// A nil tenant never widens to every tenant's rows
+	_, err = tm.Usage(uuid.Nil, hour, hour.Add(time.Hour))
+	require.ErrorIs(t, err, manager.ErrTenantNotFound)
+
+	records, err = tm.AllUsage(hour, hour.Add(time.Hour))
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+}
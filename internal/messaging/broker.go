@@ -0,0 +1,122 @@
+// internal/messaging/broker.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrQueueNotFound = errors.New("queue not found")
+
+// Broker is the transport behind tenant queues. Each tenant has a main
+// queue and a dead-letter queue that receives messages nacked without
+// requeue. Messages are published under the routing key
+// <tenant>.<event_type>; a tenant queue receives its own tenant's messages
+// plus those matching any extra binding patterns. RabbitClient, NATSClient
+// and MemoryBroker implement it.
+type Broker interface {
+	// DeclareQueue creates the tenant's queue and DLQ if they do not exist.
+	// Options are fixed when the queue is created; brokers that cannot
+	// honour them return ErrUnsupported.
+	DeclareQueue(tenantID string, opts QueueOptions) error
+	// SetQueueLimits replaces the limits of an existing tenant queue
+	// without redeclaring it; the other options stay as declared
+	SetQueueLimits(tenantID string, limits QueueLimits) error
+	// DeleteQueue removes the tenant's main queue
+	DeleteQueue(tenantID string) error
+	// Bind routes messages matching an extra topic pattern to the tenant
+	// queue; brokers without topic routing return ErrUnsupported
+	Bind(tenantID, pattern string) error
+	Unbind(tenantID, pattern string) error
+	Publish(tenantID string, body []byte, opts ...PublishOption) error
+	// Consume starts delivering the tenant's messages; they must be acked
+	// or nacked through the Delivery. Stream queues can be read from an
+	// earlier offset with FromOffset.
+	Consume(tenantID string, opts ...ConsumeOption) (Subscription, error)
+	// QueueDepth returns the number of messages ready for delivery, or
+	// for stream queues the number retained
+	QueueDepth(tenantID string) (int, error)
+	// DeadLetterDepth returns the number of messages in the tenant's DLQ
+	DeadLetterDepth(tenantID string) (int, error)
+	Close() error
+}
+
+var (
+	_ Broker = (*RabbitClient)(nil)
+	_ Broker = (*NATSClient)(nil)
+	_ Broker = (*MemoryBroker)(nil)
+)
+
+// Subscription is an active consumer on a tenant queue
+type Subscription interface {
+	// Deliveries is closed when the subscription ends
+	Deliveries() <-chan Delivery
+	// Cancel stops the subscription; unacked deliveries are requeued
+	Cancel() error
+}
+
+// Acknowledger settles deliveries by tag, like an AMQP channel
+type Acknowledger interface {
+	Ack(tag uint64, multiple bool) error
+	Nack(tag uint64, multiple, requeue bool) error
+}
+
+// Delivery is a message received from a tenant queue
+type Delivery struct {
+	Body          []byte
+	MessageID     string
+	CorrelationID string
+	ContentType   string
+	Headers       map[string]interface{}
+	RoutingKey    string
+	Timestamp     time.Time
+	Redelivered   bool
+	Priority      uint8
+
+	// DeliveryTag increases monotonically per subscription
+	DeliveryTag  uint64
+	Acknowledger Acknowledger
+}
+
+// Ack acknowledges this delivery, or with multiple every unsettled delivery
+// of the subscription up to and including it
+func (d Delivery) Ack(multiple bool) error {
+	if d.Acknowledger == nil {
+		return fmt.Errorf("delivery not initialized")
+	}
+	return d.Acknowledger.Ack(d.DeliveryTag, multiple)
+}
+
+// EventType returns the event type of the delivery: the part of its
+// routing key after the tenant, or for fanned-out copies the
+// EventTypeHeader header
+func (d Delivery) EventType() string {
+	if eventType, ok := d.Headers[EventTypeHeader].(string); ok && eventType != "" {
+		return eventType
+	}
+	if _, eventType, ok := strings.Cut(d.RoutingKey, "."); ok && eventType != "" {
+		return eventType
+	}
+	return DefaultEventType
+}
+
+// Nack rejects this delivery (or all up to it with multiple), either
+// requeueing it or sending it to the dead-letter queue
+func (d Delivery) Nack(multiple, requeue bool) error {
+	if d.Acknowledger == nil {
+		return fmt.Errorf("delivery not initialized")
+	}
+	return d.Acknowledger.Nack(d.DeliveryTag, multiple, requeue)
+}
+
+// QueueName is the name of a tenant's main queue
+func QueueName(tenantID string) string {
+	return fmt.Sprintf("tenant_%s_queue", tenantID)
+}
+
+// DLQName is the name of a tenant's dead-letter queue
+func DLQName(tenantID string) string {
+	return fmt.Sprintf("tenant_%s_dlq", tenantID)
+}
@@ -0,0 +1,325 @@
+// internal/messaging/brokertest/brokertest.go
+
+// Package brokertest is a conformance suite for messaging.Broker
+// implementations, run against the in-memory broker and embedded NATS.
+package brokertest
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+)
+
+// Run exercises the behaviour every Broker must share. Each test works on
+// a fresh tenant ID, so one broker may be shared across runs.
+func Run(t *testing.T, b messaging.Broker) {
+	t.Run("PublishConsume", func(t *testing.T) { testPublishConsume(t, b) })
+	t.Run("AckMultiple", func(t *testing.T) { testAckMultiple(t, b) })
+	t.Run("DeadLetter", func(t *testing.T) { testDeadLetter(t, b) })
+	t.Run("RequeueOnCancel", func(t *testing.T) { testRequeueOnCancel(t, b) })
+	t.Run("DeleteQueue", func(t *testing.T) { testDeleteQueue(t, b) })
+	t.Run("Bindings", func(t *testing.T) { testBindings(t, b) })
+	t.Run("SourceTenantCopy", func(t *testing.T) { testSourceTenantCopy(t, b) })
+	t.Run("Priority", func(t *testing.T) { testPriority(t, b) })
+	t.Run("DeliveryLimit", func(t *testing.T) { testDeliveryLimit(t, b) })
+	t.Run("StreamReplay", func(t *testing.T) { testStreamReplay(t, b) })
+	t.Run("QueueLimits", func(t *testing.T) { testQueueLimits(t, b) })
+}
+
+// Receive waits for the next delivery on sub
+func Receive(t *testing.T, sub messaging.Subscription) messaging.Delivery {
+	t.Helper()
+	select {
+	case d, ok := <-sub.Deliveries():
+		require.True(t, ok, "subscription closed")
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for delivery")
+		return messaging.Delivery{}
+	}
+}
+
+func declare(t *testing.T, b messaging.Broker) string {
+	tenantID := uuid.NewString()
+	require.NoError(t, b.DeclareQueue(tenantID, messaging.QueueOptions{}))
+	require.NoError(t, b.DeclareQueue(tenantID, messaging.QueueOptions{}), "declaring twice is a no-op")
+	return tenantID
+}
+
+func consume(t *testing.T, b messaging.Broker, tenantID string) messaging.Subscription {
+	sub, err := b.Consume(tenantID)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = sub.Cancel() })
+	return sub
+}
+
+func testPublishConsume(t *testing.T, b messaging.Broker) {
+	require.ErrorIs(t, b.Publish(uuid.NewString(), []byte(`{}`)), messaging.ErrQueueNotFound)
+
+	tenantID := declare(t, b)
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		require.NoError(t, b.Publish(tenantID, []byte(body), messaging.WithMessageID(body)))
+	}
+	depth, err := b.QueueDepth(tenantID)
+	require.NoError(t, err)
+	require.Equal(t, 3, depth)
+
+	sub := consume(t, b, tenantID)
+	for _, body := range []string{`{"n":1}`, `{"n":2}`, `{"n":3}`} {
+		d := Receive(t, sub)
+		require.Equal(t, body, string(d.Body), "FIFO order")
+		require.Equal(t, body, d.MessageID)
+		require.Equal(t, "application/json", d.ContentType)
+		require.Equal(t, messaging.RoutingKey(tenantID, ""), d.RoutingKey)
+		require.False(t, d.Timestamp.IsZero())
+		require.False(t, d.Redelivered)
+		require.NoError(t, d.Ack(false))
+	}
+
+	depth, err = b.QueueDepth(tenantID)
+	require.NoError(t, err)
+	require.Zero(t, depth)
+}
+
+func testAckMultiple(t *testing.T, b messaging.Broker) {
+	tenantID := declare(t, b)
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":1}`)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":2}`)))
+
+	sub := consume(t, b, tenantID)
+	d1 := Receive(t, sub)
+	d2 := Receive(t, sub)
+	require.NoError(t, d2.Ack(true))
+	require.Error(t, d1.Ack(false), "d1 was settled by the multiple ack")
+}
+
+func testDeadLetter(t *testing.T, b messaging.Broker) {
+	tenantID := declare(t, b)
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":1}`)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":2}`)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":3}`)))
+
+	sub := consume(t, b, tenantID)
+	Receive(t, sub)
+	d2 := Receive(t, sub)
+	require.NoError(t, d2.Nack(true, false))
+
+	// A requeued nack comes back redelivered
+	d3 := Receive(t, sub)
+	require.NoError(t, d3.Nack(false, true))
+	d3 = Receive(t, sub)
+	require.Equal(t, `{"n":3}`, string(d3.Body))
+	require.True(t, d3.Redelivered)
+	require.NoError(t, d3.Ack(false))
+
+	dead, err := b.DeadLetterDepth(tenantID)
+	require.NoError(t, err)
+	require.Equal(t, 2, dead)
+}
+
+func testRequeueOnCancel(t *testing.T, b messaging.Broker) {
+	tenantID := declare(t, b)
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":1}`)))
+
+	sub, err := b.Consume(tenantID)
+	require.NoError(t, err)
+	d := Receive(t, sub)
+	require.NoError(t, sub.Cancel())
+	for range sub.Deliveries() {
+		// drain until closed
+	}
+
+	sub = consume(t, b, tenantID)
+	d = Receive(t, sub)
+	require.Equal(t, `{"n":1}`, string(d.Body))
+	require.True(t, d.Redelivered)
+	require.NoError(t, d.Ack(false))
+}
+
+func testDeleteQueue(t *testing.T, b messaging.Broker) {
+	tenantID := declare(t, b)
+	require.NoError(t, b.DeleteQueue(tenantID))
+	_, err := b.QueueDepth(tenantID)
+	require.ErrorIs(t, err, messaging.ErrQueueNotFound)
+	require.ErrorIs(t, b.Publish(tenantID, []byte(`{}`)), messaging.ErrQueueNotFound)
+}
+
+func testBindings(t *testing.T, b messaging.Broker) {
+	source, target := declare(t, b), declare(t, b)
+	pattern := source + ".order.*"
+	if err := b.Bind(target, pattern); errors.Is(err, messaging.ErrUnsupported) {
+		t.Skip("broker has no topic routing")
+	} else {
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, b.Publish(source, []byte(`{"n":1}`), messaging.WithEventType("order.created")))
+	require.NoError(t, b.Publish(source, []byte(`{"n":2}`), messaging.WithEventType("user.created")))
+
+	sub := consume(t, b, target)
+	d := Receive(t, sub)
+	require.Equal(t, `{"n":1}`, string(d.Body), "only the matching event fans out")
+	require.Equal(t, source+".order.created", d.RoutingKey)
+	require.NoError(t, d.Ack(false))
+
+	depth, err := b.QueueDepth(source)
+	require.NoError(t, err)
+	require.Equal(t, 2, depth, "the source queue keeps its own copies")
+
+	require.NoError(t, b.Unbind(target, pattern))
+	require.NoError(t, b.Publish(source, []byte(`{"n":3}`), messaging.WithEventType("order.paid")))
+	depth, err = b.QueueDepth(target)
+	require.NoError(t, err)
+	require.Zero(t, depth)
+}
+
+func testSourceTenantCopy(t *testing.T, b messaging.Broker) {
+	source, target := declare(t, b), declare(t, b)
+	require.NoError(t, b.Publish(target, []byte(`{"n":1}`),
+		messaging.WithEventType("order.created"), messaging.WithSourceTenant(source)))
+
+	sub := consume(t, b, target)
+	d := Receive(t, sub)
+	require.Equal(t, source, d.Headers[messaging.SourceTenantHeader])
+	require.Equal(t, messaging.QueueName(target), d.RoutingKey)
+	require.Equal(t, "order.created", d.EventType(), "copies keep their event type")
+	require.NoError(t, d.Ack(false))
+
+	depth, err := b.QueueDepth(source)
+	require.NoError(t, err)
+	require.Zero(t, depth, "a copy only reaches the addressed queue")
+}
+
+func testPriority(t *testing.T, b messaging.Broker) {
+	tenantID := uuid.NewString()
+	err := b.DeclareQueue(tenantID, messaging.QueueOptions{MaxPriority: 5})
+	if errors.Is(err, messaging.ErrUnsupported) {
+		t.Skip("broker has no priority queues")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = b.DeleteQueue(tenantID) })
+
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":1}`)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":2}`), messaging.WithPriority(3)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":3}`), messaging.WithPriority(9)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":4}`), messaging.WithPriority(3)))
+
+	sub := consume(t, b, tenantID)
+	var got []string
+	for range 4 {
+		d := Receive(t, sub)
+		got = append(got, string(d.Body))
+		require.NoError(t, d.Ack(false))
+	}
+	require.Equal(t, []string{`{"n":3}`, `{"n":2}`, `{"n":4}`, `{"n":1}`}, got,
+		"highest first, capped at MaxPriority, FIFO within a priority")
+}
+
+func testDeliveryLimit(t *testing.T, b messaging.Broker) {
+	tenantID := uuid.NewString()
+	require.ErrorIs(t, b.DeclareQueue(tenantID, messaging.QueueOptions{DeliveryLimit: 2}), messaging.ErrInvalidQueueOptions)
+	require.NoError(t, b.DeclareQueue(tenantID, messaging.QueueOptions{Type: messaging.QueueQuorum, DeliveryLimit: 2}))
+	t.Cleanup(func() { _ = b.DeleteQueue(tenantID) })
+	require.NoError(t, b.Publish(tenantID, []byte(`{"poison":true}`)))
+
+	// Returned twice within the limit, then dead-lettered on the third
+	sub := consume(t, b, tenantID)
+	for i := range 3 {
+		d := Receive(t, sub)
+		require.Equal(t, i > 0, d.Redelivered)
+		require.NoError(t, d.Nack(false, true))
+	}
+
+	require.Eventually(t, func() bool {
+		dead, err := b.DeadLetterDepth(tenantID)
+		return err == nil && dead == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	select {
+	case d := <-sub.Deliveries():
+		t.Fatalf("dead-lettered message redelivered: %s", d.Body)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+func testStreamReplay(t *testing.T, b messaging.Broker) {
+	tenantID := uuid.NewString()
+	err := b.DeclareQueue(tenantID, messaging.QueueOptions{Type: messaging.QueueStream})
+	if errors.Is(err, messaging.ErrUnsupported) {
+		t.Skip("broker has no stream queues")
+	}
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = b.DeleteQueue(tenantID) })
+
+	for i := range 3 {
+		require.NoError(t, b.Publish(tenantID, []byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+
+	// Acked messages stay in the stream for the next reader
+	for range 2 {
+		sub, err := b.Consume(tenantID, messaging.FromOffset(messaging.OffsetFirst))
+		require.NoError(t, err)
+		for i := range 3 {
+			d := Receive(t, sub)
+			require.Equal(t, fmt.Sprintf(`{"n":%d}`, i), string(d.Body))
+			require.NoError(t, d.Ack(false))
+		}
+		require.NoError(t, sub.Cancel())
+	}
+
+	sub := consume(t, b, tenantID)
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":3}`)))
+	require.Equal(t, `{"n":3}`, string(Receive(t, sub).Body), "new readers start at next")
+
+	replay, err := b.Consume(tenantID, messaging.FromOffset(messaging.StreamOffset{Offset: 2}))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = replay.Cancel() })
+	require.Equal(t, `{"n":2}`, string(Receive(t, replay).Body))
+
+	depth, err := b.QueueDepth(tenantID)
+	require.NoError(t, err)
+	require.Equal(t, 4, depth)
+
+	classic := declare(t, b)
+	_, err = b.Consume(classic, messaging.FromOffset(messaging.OffsetFirst))
+	require.ErrorIs(t, err, messaging.ErrUnsupported)
+}
+
+func testQueueLimits(t *testing.T, b messaging.Broker) {
+	tenantID := uuid.NewString()
+	limits := messaging.QueueLimits{MaxLength: 2, Overflow: messaging.OverflowRejectPublish}
+	require.NoError(t, b.DeclareQueue(tenantID, messaging.QueueOptions{Limits: limits}))
+	t.Cleanup(func() { _ = b.DeleteQueue(tenantID) })
+
+	for i := range 2 {
+		require.NoError(t, b.Publish(tenantID, []byte(fmt.Sprintf(`{"n":%d}`, i))))
+	}
+	require.ErrorIs(t, b.Publish(tenantID, []byte(`{"n":2}`)), messaging.ErrQueueFull)
+	depth, err := b.QueueDepth(tenantID)
+	require.NoError(t, err)
+	require.Equal(t, 2, depth)
+
+	require.ErrorIs(t, b.SetQueueLimits(tenantID, messaging.QueueLimits{Overflow: "drop-tail"}), messaging.ErrInvalidQueueOptions)
+	err = b.SetQueueLimits(tenantID, messaging.QueueLimits{MaxLength: 3, Overflow: messaging.OverflowDropHead})
+	if errors.Is(err, messaging.ErrUnsupported) {
+		t.Skip("broker cannot change queue limits")
+	}
+	require.NoError(t, err)
+
+	// The queue keeps its messages and drops the oldest for new ones
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":3}`)))
+	require.NoError(t, b.Publish(tenantID, []byte(`{"n":4}`)))
+	depth, err = b.QueueDepth(tenantID)
+	require.NoError(t, err)
+	require.Equal(t, 3, depth)
+
+	sub := consume(t, b, tenantID)
+	d := Receive(t, sub)
+	require.Equal(t, `{"n":1}`, string(d.Body))
+	require.NoError(t, d.Ack(false))
+}
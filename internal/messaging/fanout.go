@@ -0,0 +1,77 @@
+// internal/messaging/fanout.go
+package messaging
+
+import (
+	"log"
+	"sync"
+)
+
+// FanoutRoute copies a source tenant's messages whose event type matches
+// Pattern into the Target tenant's queue
+type FanoutRoute struct {
+	Target  string
+	Pattern string
+}
+
+// FanoutBroker decorates a Broker so that publishing to a tenant also
+// publishes a copy to every tenant subscribed to the message's event type.
+// Copies are marked with WithSourceTenant and never fanned out again. It
+// works over any Broker, including those without topic bindings.
+type FanoutBroker struct {
+	Broker
+
+	mu     sync.RWMutex
+	routes map[string][]FanoutRoute // by source tenant
+}
+
+func NewFanoutBroker(b Broker) *FanoutBroker {
+	return &FanoutBroker{
+		Broker: b,
+		routes: make(map[string][]FanoutRoute),
+	}
+}
+
+// SetRoutes replaces the routes of a source tenant
+func (f *FanoutBroker) SetRoutes(source string, routes []FanoutRoute) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(routes) == 0 {
+		delete(f.routes, source)
+		return
+	}
+	f.routes[source] = append([]FanoutRoute(nil), routes...)
+}
+
+// Publish publishes to tenantID, then copies the message to each matching
+// subscriber. A failed copy is logged rather than failing a publish that
+// already succeeded, which the caller might otherwise retry.
+func (f *FanoutBroker) Publish(tenantID string, body []byte, opts ...PublishOption) error {
+	if err := f.Broker.Publish(tenantID, body, opts...); err != nil {
+		return err
+	}
+
+	o := NewPublishOptions(opts...)
+	if o.SourceTenant != "" {
+		return nil
+	}
+	eventType := o.EventType
+	if eventType == "" {
+		eventType = DefaultEventType
+	}
+
+	f.mu.RLock()
+	routes := f.routes[tenantID]
+	f.mu.RUnlock()
+
+	copyOpts := append(opts[:len(opts):len(opts)], WithSourceTenant(tenantID))
+	for _, r := range routes {
+		if !TopicMatch(r.Pattern, eventType) {
+			continue
+		}
+		if err := f.Broker.Publish(r.Target, body, copyOpts...); err != nil {
+			log.Printf("[Fanout] Failed to copy %s message to tenant %s: %v", RoutingKey(tenantID, eventType), r.Target, err)
+		}
+	}
+	return nil
+}
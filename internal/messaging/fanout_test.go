@@ -0,0 +1,49 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/messaging/brokertest"
+)
+
+func TestFanoutBroker(t *testing.T) {
+	b := messaging.NewFanoutBroker(messaging.NewMemoryBroker())
+	defer b.Close()
+
+	source, target, other := uuid.NewString(), uuid.NewString(), uuid.NewString()
+	for _, id := range []string{source, target, other} {
+		require.NoError(t, b.DeclareQueue(id, messaging.QueueOptions{}))
+	}
+	b.SetRoutes(source, []messaging.FanoutRoute{{Target: target, Pattern: "order.*"}})
+	// A copy must not cascade into the target's own subscribers
+	b.SetRoutes(target, []messaging.FanoutRoute{{Target: other, Pattern: "#"}})
+
+	require.NoError(t, b.Publish(source, []byte(`{"n":1}`), messaging.WithEventType("order.created"), messaging.WithMessageID("m1")))
+	require.NoError(t, b.Publish(source, []byte(`{"n":2}`), messaging.WithEventType("user.created")))
+
+	sub, err := b.Consume(target)
+	require.NoError(t, err)
+	defer sub.Cancel()
+	d := brokertest.Receive(t, sub)
+	require.Equal(t, `{"n":1}`, string(d.Body))
+	require.Equal(t, "m1", d.MessageID)
+	require.Equal(t, source, d.Headers[messaging.SourceTenantHeader])
+	require.NoError(t, d.Ack(false))
+
+	for tenant, want := range map[string]int{source: 2, target: 0, other: 0} {
+		depth, err := b.QueueDepth(tenant)
+		require.NoError(t, err)
+		require.Equal(t, want, depth)
+	}
+
+	// Routes can be withdrawn
+	b.SetRoutes(source, nil)
+	require.NoError(t, b.Publish(source, []byte(`{"n":3}`), messaging.WithEventType("order.paid")))
+	depth, err := b.QueueDepth(target)
+	require.NoError(t, err)
+	require.Zero(t, depth)
+}
@@ -0,0 +1,589 @@
+// internal/messaging/memory.go
+package messaging
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBroker is an in-process Broker for tests and local development.
+// Like RabbitMQ, messages are routed to every queue with a matching topic
+// binding, each tenant queue is FIFO (or ordered by priority, then FIFO,
+// when declared with MaxPriority) with competing consumers, deliveries
+// cancelled while unacked are requeued as redelivered, and a Nack without
+// requeue moves the message to the tenant's DLQ. Quorum queues count
+// returns in the x-delivery-count header and dead-letter messages past
+// their delivery limit; stream queues keep every message within their
+// limits and give each subscription its own offset. Queue limits are
+// enforced on publish and expired messages are removed lazily.
+type MemoryBroker struct {
+	mu     sync.Mutex
+	queues map[string]*memQueue
+}
+
+type memQueue struct {
+	bindings    map[string]struct{}
+	queueType   QueueType
+	maxPriority uint8
+	limit       int // delivery limit of quorum queues
+	limits      QueueLimits
+	ready       []Delivery // highest priority first
+	log         []Delivery // stream queues only, by offset
+	logBase     int        // offset of log[0]
+	dlq         []Delivery
+	subs        map[*memSubscription]struct{}
+	cond        *sync.Cond // signalled when ready grows or a subscription ends
+}
+
+// priority is the effective priority of d in q
+func (q *memQueue) priority(d Delivery) uint8 {
+	return min(d.Priority, q.maxPriority)
+}
+
+// enqueueLocked adds d behind the ready messages of the same or higher
+// priority, or with head in front of those of the same priority. Stream
+// queues append it to the log instead. Callers must hold broker.mu.
+func (q *memQueue) enqueueLocked(d Delivery, head bool) {
+	if q.queueType == QueueStream {
+		d.Headers = withHeader(d.Headers, StreamOffsetHeader, int64(q.logBase+len(q.log)))
+		q.log = append(q.log, d)
+		q.trimLocked()
+		q.cond.Broadcast()
+		return
+	}
+
+	p := q.priority(d)
+	i := sort.Search(len(q.ready), func(i int) bool {
+		if head {
+			return q.priority(q.ready[i]) <= p
+		}
+		return q.priority(q.ready[i]) < p
+	})
+	q.ready = append(q.ready, Delivery{})
+	copy(q.ready[i+1:], q.ready[i:])
+	q.ready[i] = d
+	q.cond.Broadcast()
+}
+
+// publishLocked enqueues a newly published message, applying the queue
+// limits first. Callers must hold broker.mu.
+func (q *memQueue) publishLocked(d Delivery) error {
+	if q.queueType == QueueStream {
+		q.enqueueLocked(d, false)
+		return nil
+	}
+
+	q.expireLocked()
+	if q.fullLocked(d) {
+		switch q.limits.overflow() {
+		case OverflowRejectPublish:
+			return ErrQueueFull
+		case OverflowDeadLetter:
+			q.deadLetterLocked(d)
+			return nil
+		}
+		for len(q.ready) > 0 && q.fullLocked(d) {
+			q.deadLetterLocked(q.ready[0])
+			q.ready = q.ready[1:]
+		}
+	}
+	q.enqueueLocked(d, false)
+	return nil
+}
+
+// fullLocked reports whether adding d would exceed the queue's length
+// limits. Callers must hold broker.mu.
+func (q *memQueue) fullLocked(d Delivery) bool {
+	if q.limits.MaxLength > 0 && int64(len(q.ready))+1 > q.limits.MaxLength {
+		return true
+	}
+	return q.limits.MaxLengthBytes > 0 && bodyBytes(q.ready)+int64(len(d.Body)) > q.limits.MaxLengthBytes
+}
+
+// overLimitLocked reports whether the queue already exceeds its length
+// limits. Callers must hold broker.mu.
+func (q *memQueue) overLimitLocked() bool {
+	if q.limits.MaxLength > 0 && int64(len(q.ready)) > q.limits.MaxLength {
+		return true
+	}
+	return q.limits.MaxLengthBytes > 0 && bodyBytes(q.ready) > q.limits.MaxLengthBytes
+}
+
+// expireLocked dead-letters ready messages older than the message TTL.
+// Callers must hold broker.mu.
+func (q *memQueue) expireLocked() {
+	if q.limits.MessageTTL == 0 {
+		return
+	}
+	cutoff := time.Now().Add(-q.limits.MessageTTL)
+	kept := q.ready[:0]
+	for _, d := range q.ready {
+		if d.Timestamp.After(cutoff) {
+			kept = append(kept, d)
+		} else {
+			q.deadLetterLocked(d)
+		}
+	}
+	clear(q.ready[len(kept):])
+	q.ready = kept
+}
+
+// trimLocked drops the oldest stream messages beyond the byte limit or
+// retention period, advancing logBase. Callers must hold broker.mu.
+func (q *memQueue) trimLocked() {
+	var cutoff time.Time
+	if q.limits.MessageTTL > 0 {
+		cutoff = time.Now().Add(-q.limits.MessageTTL)
+	}
+	size := bodyBytes(q.log)
+	n := 0
+	for n < len(q.log) {
+		over := q.limits.MaxLengthBytes > 0 && size > q.limits.MaxLengthBytes
+		if !over && !q.log[n].Timestamp.Before(cutoff) {
+			break
+		}
+		size -= int64(len(q.log[n].Body))
+		n++
+	}
+	q.log = q.log[n:]
+	q.logBase += n
+}
+
+// deadLetterLocked moves deliveries to the DLQ; streams just drop them.
+// Callers must hold broker.mu.
+func (q *memQueue) deadLetterLocked(ds ...Delivery) {
+	if q.queueType == QueueStream {
+		return
+	}
+	for _, d := range ds {
+		d.DeliveryTag, d.Acknowledger = 0, nil
+		q.dlq = append(q.dlq, d)
+	}
+}
+
+func bodyBytes(ds []Delivery) int64 {
+	var n int64
+	for _, d := range ds {
+		n += int64(len(d.Body))
+	}
+	return n
+}
+
+// withHeader returns a copy of h with key set, leaving h untouched as
+// copies routed to other queues share it
+func withHeader(h map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	out := make(map[string]interface{}, len(h)+1)
+	for k, v := range h {
+		out[k] = v
+	}
+	out[key] = value
+	return out
+}
+
+func NewMemoryBroker() *MemoryBroker {
+	return &MemoryBroker{queues: make(map[string]*memQueue)}
+}
+
+// DeclareQueue creates the tenant queue; redeclaring an existing queue
+// keeps its original options
+func (b *MemoryBroker) DeclareQueue(tenantID string, opts QueueOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, ok := b.queues[tenantID]; !ok {
+		b.queues[tenantID] = &memQueue{
+			bindings:    map[string]struct{}{TenantPattern(tenantID): {}},
+			queueType:   opts.queueType(),
+			maxPriority: opts.MaxPriority,
+			limit:       opts.deliveryLimit(),
+			limits:      opts.Limits,
+			subs:        make(map[*memSubscription]struct{}),
+			cond:        sync.NewCond(&b.mu),
+		}
+	}
+	return nil
+}
+
+// SetQueueLimits replaces the queue limits. Like a RabbitMQ policy, a
+// lower limit with the drop-head overflow applies to the messages already
+// queued.
+func (b *MemoryBroker) SetQueueLimits(tenantID string, limits QueueLimits) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return fmt.Errorf("set limits of %s: %w", QueueName(tenantID), ErrQueueNotFound)
+	}
+	if err := limits.validate(q.queueType); err != nil {
+		return err
+	}
+	q.limits = limits
+
+	if q.queueType == QueueStream {
+		q.trimLocked()
+		return nil
+	}
+	q.expireLocked()
+	if limits.overflow() == OverflowDropHead {
+		for len(q.ready) > 0 && q.overLimitLocked() {
+			q.deadLetterLocked(q.ready[0])
+			q.ready = q.ready[1:]
+		}
+	}
+	return nil
+}
+
+func (b *MemoryBroker) DeleteQueue(tenantID string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return nil
+	}
+	for s := range q.subs {
+		s.cancelLocked()
+	}
+	delete(b.queues, tenantID)
+	return nil
+}
+
+func (b *MemoryBroker) Bind(tenantID, pattern string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return fmt.Errorf("bind %s to %s: %w", pattern, QueueName(tenantID), ErrQueueNotFound)
+	}
+	q.bindings[pattern] = struct{}{}
+	return nil
+}
+
+func (b *MemoryBroker) Unbind(tenantID, pattern string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return fmt.Errorf("unbind %s from %s: %w", pattern, QueueName(tenantID), ErrQueueNotFound)
+	}
+	delete(q.bindings, pattern)
+	return nil
+}
+
+// Publish copies the message into every queue bound to its routing key.
+// Unlike RabbitMQ, which drops unroutable messages, it fails when no queue
+// matches.
+func (b *MemoryBroker) Publish(tenantID string, body []byte, opts ...PublishOption) error {
+	o := NewPublishOptions(opts...)
+	if o.Delayed() {
+		return errDelayed(tenantID)
+	}
+	routingKey := o.routingKey(tenantID)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	d := Delivery{
+		Body:        append([]byte(nil), body...),
+		MessageID:   o.MessageID,
+		ContentType: "application/json",
+		Headers:     o.headers(),
+		RoutingKey:  routingKey,
+		Timestamp:   time.Now().UTC(),
+		Priority:    o.Priority,
+	}
+	if o.SourceTenant != "" {
+		q, ok := b.queues[tenantID]
+		if !ok {
+			return fmt.Errorf("failed to publish to queue %s: %w", routingKey, ErrQueueNotFound)
+		}
+		if err := q.publishLocked(d); err != nil {
+			return fmt.Errorf("failed to publish to queue %s: %w", routingKey, err)
+		}
+		return nil
+	}
+
+	// Like a confirmed RabbitMQ publish, the message fails if any queue it
+	// is routed to rejects it, although the other queues keep their copy
+	var rejected error
+	routed := false
+	for _, q := range b.queues {
+		for pattern := range q.bindings {
+			if TopicMatch(pattern, routingKey) {
+				if err := q.publishLocked(d); err != nil {
+					rejected = err
+				}
+				routed = true
+				break
+			}
+		}
+	}
+	if !routed {
+		return fmt.Errorf("failed to publish %s: %w", routingKey, ErrQueueNotFound)
+	}
+	if rejected != nil {
+		return fmt.Errorf("failed to publish %s: %w", routingKey, rejected)
+	}
+	return nil
+}
+
+func (b *MemoryBroker) Consume(tenantID string, opts ...ConsumeOption) (Subscription, error) {
+	o := NewConsumeOptions(opts...)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return nil, fmt.Errorf("tenant %s: failed to start consuming: %w", tenantID, ErrQueueNotFound)
+	}
+	if o.Offset != nil && q.queueType != QueueStream {
+		return nil, fmt.Errorf("tenant %s: consume from offset: %w", tenantID, ErrUnsupported)
+	}
+
+	s := &memSubscription{
+		broker:  b,
+		queue:   q,
+		out:     make(chan Delivery),
+		done:    make(chan struct{}),
+		unacked: make(map[uint64]Delivery),
+	}
+	if q.queueType == QueueStream {
+		offset := OffsetNext
+		if o.Offset != nil {
+			offset = *o.Offset
+		}
+		s.cursor = q.seekLocked(offset)
+	}
+	q.subs[s] = struct{}{}
+	go s.dispatch()
+	return s, nil
+}
+
+func (b *MemoryBroker) QueueDepth(tenantID string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return 0, fmt.Errorf("inspect queue for %s: %w", tenantID, ErrQueueNotFound)
+	}
+	if q.queueType == QueueStream {
+		q.trimLocked()
+		return len(q.log), nil
+	}
+	q.expireLocked()
+	return len(q.ready), nil
+}
+
+// seekLocked returns the offset a stream subscription starting at o
+// reads first. Callers must hold broker.mu.
+func (q *memQueue) seekLocked(o StreamOffset) int {
+	q.trimLocked()
+	switch {
+	case o.Position == "first":
+		return q.logBase
+	case o.Position == "last":
+		return q.logBase + max(len(q.log)-1, 0)
+	case o.Position == "next":
+		return q.logBase + len(q.log)
+	case !o.Time.IsZero():
+		return q.logBase + sort.Search(len(q.log), func(i int) bool { return !q.log[i].Timestamp.Before(o.Time) })
+	}
+	return int(min(max(o.Offset, int64(q.logBase)), int64(q.logBase+len(q.log))))
+}
+
+func (b *MemoryBroker) DeadLetterDepth(tenantID string) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return 0, fmt.Errorf("inspect DLQ for %s: %w", tenantID, ErrQueueNotFound)
+	}
+	return len(q.dlq), nil
+}
+
+// DeadLetters returns a copy of the messages in the tenant's DLQ
+func (b *MemoryBroker) DeadLetters(tenantID string) []Delivery {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	q, ok := b.queues[tenantID]
+	if !ok {
+		return nil
+	}
+	return append([]Delivery(nil), q.dlq...)
+}
+
+// Close cancels every subscription; queued messages are discarded
+func (b *MemoryBroker) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for _, q := range b.queues {
+		for s := range q.subs {
+			s.cancelLocked()
+		}
+	}
+	b.queues = make(map[string]*memQueue)
+	return nil
+}
+
+type memSubscription struct {
+	broker *MemoryBroker
+	queue  *memQueue
+	out    chan Delivery
+	done   chan struct{}
+
+	// guarded by broker.mu
+	nextTag   uint64
+	unacked   map[uint64]Delivery
+	cursor    int // next offset of a stream subscription
+	cancelled bool
+}
+
+func (s *memSubscription) Deliveries() <-chan Delivery {
+	return s.out
+}
+
+func (s *memSubscription) Cancel() error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	s.cancelLocked()
+	return nil
+}
+
+// cancelLocked ends the subscription and requeues its unacked deliveries.
+// Callers must hold broker.mu.
+func (s *memSubscription) cancelLocked() {
+	if s.cancelled {
+		return
+	}
+	s.cancelled = true
+	s.requeueLocked(s.settleLocked(^uint64(0), true))
+	delete(s.queue.subs, s)
+	close(s.done)
+	s.queue.cond.Broadcast()
+}
+
+// dispatch hands ready messages to the subscriber one at a time
+func (s *memSubscription) dispatch() {
+	defer close(s.out)
+
+	b, q := s.broker, s.queue
+	stream := q.queueType == QueueStream
+	for {
+		b.mu.Lock()
+		for !s.cancelled && ((stream && s.cursor >= q.logBase+len(q.log)) || (!stream && len(q.ready) == 0)) {
+			q.cond.Wait()
+		}
+		if s.cancelled {
+			b.mu.Unlock()
+			return
+		}
+
+		var d Delivery
+		if stream {
+			// Messages trimmed from the log are skipped
+			s.cursor = max(s.cursor, q.logBase)
+			d = q.log[s.cursor-q.logBase]
+			s.cursor++
+		} else {
+			q.expireLocked()
+			if len(q.ready) == 0 {
+				b.mu.Unlock()
+				continue
+			}
+			d = q.ready[0]
+			q.ready = q.ready[1:]
+		}
+		s.nextTag++
+		d.DeliveryTag = s.nextTag
+		d.Acknowledger = s
+		s.unacked[d.DeliveryTag] = d
+		b.mu.Unlock()
+
+		select {
+		case s.out <- d:
+		case <-s.done:
+			// Cancel already requeued d along with the other unacked
+			return
+		}
+	}
+}
+
+func (s *memSubscription) Ack(tag uint64, multiple bool) error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	if len(s.settleLocked(tag, multiple)) == 0 && !multiple {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	return nil
+}
+
+func (s *memSubscription) Nack(tag uint64, multiple, requeue bool) error {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	settled := s.settleLocked(tag, multiple)
+	if len(settled) == 0 && !multiple {
+		return fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	if requeue {
+		s.requeueLocked(settled)
+		return nil
+	}
+	s.queue.deadLetterLocked(settled...)
+	return nil
+}
+
+// settleLocked removes and returns the unacked deliveries matching tag,
+// in delivery order. Callers must hold broker.mu.
+func (s *memSubscription) settleLocked(tag uint64, multiple bool) []Delivery {
+	var settled []Delivery
+	for t, d := range s.unacked {
+		if t == tag || (multiple && t < tag) {
+			settled = append(settled, d)
+			delete(s.unacked, t)
+		}
+	}
+	sort.Slice(settled, func(i, j int) bool { return settled[i].DeliveryTag < settled[j].DeliveryTag })
+	return settled
+}
+
+// requeueLocked puts deliveries back at the head of their priority in
+// the queue, marked as redelivered; quorum queues dead-letter those past
+// the delivery limit, and streams keep them in the log regardless.
+// Callers must hold broker.mu.
+func (s *memSubscription) requeueLocked(ds []Delivery) {
+	q := s.queue
+	if q.queueType == QueueStream {
+		return
+	}
+	for i := len(ds) - 1; i >= 0; i-- {
+		d := ds[i]
+		if q.limit > 0 {
+			count, _ := d.Headers[DeliveryCountHeader].(int64)
+			d.Headers = withHeader(d.Headers, DeliveryCountHeader, count+1)
+			if int(count+1) > q.limit {
+				q.deadLetterLocked(d)
+				continue
+			}
+		}
+		d.DeliveryTag, d.Acknowledger = 0, nil
+		d.Redelivered = true
+		q.enqueueLocked(d, true)
+	}
+}
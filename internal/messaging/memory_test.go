@@ -0,0 +1,15 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/messaging/brokertest"
+)
+
+func TestMemoryBroker(t *testing.T) {
+	b := messaging.NewMemoryBroker()
+	defer b.Close()
+
+	brokertest.Run(t, b)
+}
@@ -0,0 +1,516 @@
+// internal/messaging/nats.go
+package messaging
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+const (
+	// natsConsumer is the durable pull consumer shared by a tenant's subscriptions
+	natsConsumer = "workers"
+	// natsFetchBatch and natsFetchWait bound a single pull request
+	natsFetchBatch = 100
+	natsFetchWait  = time.Second
+	natsTimeout    = 5 * time.Second
+)
+
+// NATSClient is the JetStream implementation of Broker. Each tenant gets a
+// work-queue stream named like its RabbitMQ queue with one durable pull
+// consumer, plus a second stream that serves as its DLQ. A subject can
+// only feed one stream, so extra bindings are not supported; the routing
+// key travels in a header instead. Queue limits become the stream's
+// limits, which also count delivered messages not yet acked; messages
+// dropped by them or expired are discarded rather than dead-lettered.
+type NATSClient struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+	URL  string
+}
+
+func NewNATSClient(url string) (*NATSClient, error) {
+	conn, err := nats.Connect(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to NATS: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to create JetStream context: %w", err)
+	}
+
+	return &NATSClient{
+		conn: conn,
+		js:   js,
+		URL:  url,
+	}, nil
+}
+
+func natsSubject(tenantID string) string {
+	return fmt.Sprintf("tenant.%s.queue", tenantID)
+}
+
+func natsDLQSubject(tenantID string) string {
+	return fmt.Sprintf("tenant.%s.dlq", tenantID)
+}
+
+// DeclareQueue creates the tenant's streams and durable consumer. Streams
+// are strictly ordered, so priority queues are not supported, and the
+// work queue retention rules out replayable stream queues. Quorum queues
+// keep their delivery limit in the consumer metadata.
+func (n *NATSClient) DeclareQueue(tenantID string, opts QueueOptions) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+	if opts.MaxPriority > 0 {
+		return fmt.Errorf("declare %s with priorities: %w", QueueName(tenantID), ErrUnsupported)
+	}
+	if opts.queueType() == QueueStream {
+		return fmt.Errorf("declare %s as a stream queue: %w", QueueName(tenantID), ErrUnsupported)
+	}
+	if opts.Limits.Overflow == OverflowDeadLetter {
+		return fmt.Errorf("declare %s to dead-letter on overflow: %w", QueueName(tenantID), ErrUnsupported)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	// 1. DLQ
+	_, err := n.js.CreateOrUpdateStream(ctx, jetstream.StreamConfig{
+		Name:     DLQName(tenantID),
+		Subjects: []string{natsDLQSubject(tenantID)},
+		Storage:  jetstream.FileStorage,
+	})
+	if err != nil {
+		return fmt.Errorf("declare DLQ: %w", err)
+	}
+
+	// 2. Main stream; acked messages are removed like from a queue
+	cfg := jetstream.StreamConfig{
+		Name:      QueueName(tenantID),
+		Subjects:  []string{natsSubject(tenantID)},
+		Retention: jetstream.WorkQueuePolicy,
+		Storage:   jetstream.FileStorage,
+	}
+	setStreamLimits(&cfg, opts.Limits)
+	_, err = n.js.CreateOrUpdateStream(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("declare main queue: %w", err)
+	}
+
+	var metadata map[string]string
+	if limit := opts.deliveryLimit(); limit > 0 {
+		metadata = map[string]string{deliveryLimitMetadata: strconv.Itoa(limit)}
+	}
+	_, err = n.js.CreateOrUpdateConsumer(ctx, QueueName(tenantID), jetstream.ConsumerConfig{
+		Durable:   natsConsumer,
+		AckPolicy: jetstream.AckExplicitPolicy,
+		Metadata:  metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("declare consumer: %w", err)
+	}
+
+	log.Printf("[NATS] Streams declared for tenant %s", tenantID)
+	return nil
+}
+
+// SetQueueLimits updates the limits of the tenant's main stream
+func (n *NATSClient) SetQueueLimits(tenantID string, limits QueueLimits) error {
+	if err := limits.validate(QueueClassic); err != nil {
+		return err
+	}
+	if limits.Overflow == OverflowDeadLetter {
+		return fmt.Errorf("set %s to dead-letter on overflow: %w", QueueName(tenantID), ErrUnsupported)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	stream, err := n.js.Stream(ctx, QueueName(tenantID))
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) {
+			err = ErrQueueNotFound
+		}
+		return fmt.Errorf("set limits of %s: %w", QueueName(tenantID), err)
+	}
+	cfg := stream.CachedInfo().Config
+	setStreamLimits(&cfg, limits)
+	if _, err := n.js.UpdateStream(ctx, cfg); err != nil {
+		return fmt.Errorf("set limits of %s: %w", QueueName(tenantID), err)
+	}
+	return nil
+}
+
+// setStreamLimits maps queue limits onto a stream config; -1 clears the
+// server's message and byte limits
+func setStreamLimits(cfg *jetstream.StreamConfig, limits QueueLimits) {
+	cfg.MaxMsgs, cfg.MaxBytes = -1, -1
+	if limits.MaxLength > 0 {
+		cfg.MaxMsgs = limits.MaxLength
+	}
+	if limits.MaxLengthBytes > 0 {
+		cfg.MaxBytes = limits.MaxLengthBytes
+	}
+	cfg.MaxAge = limits.MessageTTL
+	cfg.Discard = jetstream.DiscardOld
+	if limits.overflow() == OverflowRejectPublish {
+		cfg.Discard = jetstream.DiscardNew
+	}
+}
+
+// DeleteQueue removes the tenant's main stream and its consumer
+func (n *NATSClient) DeleteQueue(tenantID string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	err := n.js.DeleteStream(ctx, QueueName(tenantID))
+	if err != nil && !errors.Is(err, jetstream.ErrStreamNotFound) {
+		return fmt.Errorf("delete queue %s: %w", QueueName(tenantID), err)
+	}
+	return nil
+}
+
+const (
+	// routingKeyHeader carries the <tenant>.<event_type> routing key
+	routingKeyHeader = "Routing-Key"
+	// priorityHeader carries the message priority so it survives the
+	// round trip, although streams deliver in order regardless
+	priorityHeader = "Priority"
+	// deliveryLimitMetadata is the consumer metadata key holding a quorum
+	// queue's delivery limit
+	deliveryLimitMetadata = "delivery_limit"
+	// natsErrStoreFailed is the JetStream error code of a message the
+	// stream refused to store
+	natsErrStoreFailed jetstream.ErrorCode = 10077
+)
+
+func (n *NATSClient) Bind(tenantID, pattern string) error {
+	return fmt.Errorf("bind %s: %w", pattern, ErrUnsupported)
+}
+
+func (n *NATSClient) Unbind(tenantID, pattern string) error {
+	return fmt.Errorf("unbind %s: %w", pattern, ErrUnsupported)
+}
+
+// Publish stores a message in the tenant stream. The message ID doubles
+// as the JetStream Nats-Msg-Id, so the server also drops duplicates
+// published within its duplicate window.
+func (n *NATSClient) Publish(tenantID string, body []byte, opts ...PublishOption) error {
+	o := NewPublishOptions(opts...)
+	if o.Delayed() {
+		return errDelayed(tenantID)
+	}
+
+	msg := nats.NewMsg(natsSubject(tenantID))
+	msg.Header.Set("Content-Type", "application/json")
+	msg.Header.Set(routingKeyHeader, o.routingKey(tenantID))
+	if o.MessageID != "" {
+		msg.Header.Set(nats.MsgIdHdr, o.MessageID)
+	}
+	if o.Priority > 0 {
+		msg.Header.Set(priorityHeader, strconv.Itoa(int(o.Priority)))
+	}
+	for k, v := range o.headers() {
+		msg.Header.Set(k, fmt.Sprint(v))
+	}
+	msg.Data = body
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	if _, err := n.js.PublishMsg(ctx, msg); err != nil {
+		var apiErr *jetstream.APIError
+		switch {
+		case errors.Is(err, jetstream.ErrNoStreamResponse):
+			err = ErrQueueNotFound
+		case errors.As(err, &apiErr) && apiErr.ErrorCode == natsErrStoreFailed && strings.HasPrefix(apiErr.Description, "maximum"):
+			// A DiscardNew stream at its message or byte limit
+			err = ErrQueueFull
+		}
+		return fmt.Errorf("failed to publish to queue %s: %w", QueueName(tenantID), err)
+	}
+	return nil
+}
+
+// Consume pulls from the tenant's durable consumer. Deliveries left
+// unacked when the subscription is cancelled are nacked for redelivery.
+func (n *NATSClient) Consume(tenantID string, opts ...ConsumeOption) (Subscription, error) {
+	if NewConsumeOptions(opts...).Offset != nil {
+		return nil, fmt.Errorf("tenant %s: consume from offset: %w", tenantID, ErrUnsupported)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	cons, err := n.js.Consumer(ctx, QueueName(tenantID), natsConsumer)
+	if err != nil {
+		if errors.Is(err, jetstream.ErrStreamNotFound) || errors.Is(err, jetstream.ErrConsumerNotFound) {
+			err = ErrQueueNotFound
+		}
+		return nil, fmt.Errorf("tenant %s: failed to start consuming: %w", tenantID, err)
+	}
+
+	sub := &natsSubscription{
+		client:   n,
+		tenantID: tenantID,
+		out:      make(chan Delivery),
+		done:     make(chan struct{}),
+		unacked:  make(map[uint64]jetstream.Msg),
+	}
+	if v, ok := cons.CachedInfo().Config.Metadata[deliveryLimitMetadata]; ok {
+		sub.deliveryLimit, _ = strconv.Atoi(v)
+	}
+	go sub.pull(cons)
+	return sub, nil
+}
+
+// QueueDepth returns the number of messages not yet delivered to a consumer
+func (n *NATSClient) QueueDepth(tenantID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	cons, err := n.js.Consumer(ctx, QueueName(tenantID), natsConsumer)
+	if err == nil {
+		var info *jetstream.ConsumerInfo
+		if info, err = cons.Info(ctx); err == nil {
+			return int(info.NumPending), nil
+		}
+	}
+	if errors.Is(err, jetstream.ErrStreamNotFound) || errors.Is(err, jetstream.ErrConsumerNotFound) {
+		err = ErrQueueNotFound
+	}
+	return 0, fmt.Errorf("inspect queue for %s: %w", tenantID, err)
+}
+
+// DeadLetterDepth returns the number of messages in the tenant DLQ stream
+func (n *NATSClient) DeadLetterDepth(tenantID string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	stream, err := n.js.Stream(ctx, DLQName(tenantID))
+	if err == nil {
+		var info *jetstream.StreamInfo
+		if info, err = stream.Info(ctx); err == nil {
+			return int(info.State.Msgs), nil
+		}
+	}
+	if errors.Is(err, jetstream.ErrStreamNotFound) {
+		err = ErrQueueNotFound
+	}
+	return 0, fmt.Errorf("inspect DLQ for %s: %w", tenantID, err)
+}
+
+// Close drains the connection so pending acks reach the server
+func (n *NATSClient) Close() error {
+	return n.conn.Drain()
+}
+
+type natsSubscription struct {
+	client   *NATSClient
+	tenantID string
+	out      chan Delivery
+	done     chan struct{}
+
+	// deliveryLimit, if set, dead-letters requeued messages returned
+	// more often, as quorum queues do
+	deliveryLimit int
+
+	mu        sync.Mutex
+	nextTag   uint64
+	unacked   map[uint64]jetstream.Msg
+	cancelled bool
+}
+
+func (s *natsSubscription) Deliveries() <-chan Delivery {
+	return s.out
+}
+
+func (s *natsSubscription) Cancel() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.cancelled {
+		return nil
+	}
+	s.cancelled = true
+	close(s.done)
+
+	var firstErr error
+	for tag, msg := range s.unacked {
+		if err := msg.Nak(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.unacked, tag)
+	}
+	return firstErr
+}
+
+// pull fetches batches from the consumer and hands them out one at a time
+func (s *natsSubscription) pull(cons jetstream.Consumer) {
+	defer close(s.out)
+
+	for {
+		select {
+		case <-s.done:
+			return
+		default:
+		}
+
+		batch, err := cons.Fetch(natsFetchBatch, jetstream.FetchMaxWait(natsFetchWait))
+		if err != nil {
+			log.Printf("[NATS] Tenant %s: fetch failed, ending subscription: %v", s.tenantID, err)
+			return
+		}
+		for msg := range batch.Messages() {
+			s.deliver(msg)
+		}
+		if err := batch.Error(); err != nil && !errors.Is(err, nats.ErrTimeout) {
+			log.Printf("[NATS] Tenant %s: fetch failed, ending subscription: %v", s.tenantID, err)
+			return
+		}
+	}
+}
+
+// deliver tracks msg under a new tag and passes it on, or hands it back to
+// the server if the subscription was cancelled meanwhile
+func (s *natsSubscription) deliver(msg jetstream.Msg) {
+	s.mu.Lock()
+	if s.cancelled {
+		s.mu.Unlock()
+		_ = msg.Nak()
+		return
+	}
+	s.nextTag++
+	tag := s.nextTag
+	s.unacked[tag] = msg
+	s.mu.Unlock()
+
+	d := Delivery{
+		Body:         msg.Data(),
+		ContentType:  msg.Headers().Get("Content-Type"),
+		MessageID:    msg.Headers().Get(nats.MsgIdHdr),
+		Headers:      make(map[string]interface{}),
+		RoutingKey:   msg.Headers().Get(routingKeyHeader),
+		DeliveryTag:  tag,
+		Acknowledger: s,
+	}
+	for k, v := range msg.Headers() {
+		if k != "Content-Type" && k != nats.MsgIdHdr && k != routingKeyHeader && k != priorityHeader && len(v) > 0 {
+			d.Headers[k] = v[0]
+		}
+	}
+	if p, err := strconv.ParseUint(msg.Headers().Get(priorityHeader), 10, 8); err == nil {
+		d.Priority = uint8(p)
+	}
+	if meta, err := msg.Metadata(); err == nil {
+		d.Timestamp = meta.Timestamp.UTC()
+		d.Redelivered = meta.NumDelivered > 1
+	}
+
+	select {
+	case s.out <- d:
+	case <-s.done:
+		// Cancel already nacked msg along with the other unacked
+	}
+}
+
+func (s *natsSubscription) Ack(tag uint64, multiple bool) error {
+	settled, err := s.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+	for _, msg := range settled {
+		if err := msg.Ack(); err != nil {
+			return fmt.Errorf("ack: %w", err)
+		}
+	}
+	return nil
+}
+
+// Nack requeues through a JetStream NAK, or dead-letters by copying the
+// message to the DLQ stream before acking it off the work queue
+func (s *natsSubscription) Nack(tag uint64, multiple, requeue bool) error {
+	settled, err := s.settle(tag, multiple)
+	if err != nil {
+		return err
+	}
+	for _, msg := range settled {
+		if requeue && !s.overLimit(msg) {
+			if err := msg.Nak(); err != nil {
+				return fmt.Errorf("nack: %w", err)
+			}
+			continue
+		}
+		if err := s.deadLetter(msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// overLimit reports whether returning msg once more exceeds the delivery
+// limit
+func (s *natsSubscription) overLimit(msg jetstream.Msg) bool {
+	if s.deliveryLimit == 0 {
+		return false
+	}
+	meta, err := msg.Metadata()
+	return err == nil && int(meta.NumDelivered) > s.deliveryLimit
+}
+
+func (s *natsSubscription) deadLetter(msg jetstream.Msg) error {
+	dead := nats.NewMsg(natsDLQSubject(s.tenantID))
+	dead.Data = msg.Data()
+	for k, v := range msg.Headers() {
+		// The original ID must not be deduplicated against the DLQ stream
+		if k != nats.MsgIdHdr {
+			dead.Header[k] = v
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), natsTimeout)
+	defer cancel()
+
+	if _, err := s.client.js.PublishMsg(ctx, dead); err != nil {
+		// Leave it for redelivery rather than lose it
+		_ = msg.Nak()
+		return fmt.Errorf("dead-letter to %s: %w", DLQName(s.tenantID), err)
+	}
+	return msg.Ack()
+}
+
+// settle removes and returns the unacked messages matching tag, in
+// delivery order
+func (s *natsSubscription) settle(tag uint64, multiple bool) ([]jetstream.Msg, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var tags []uint64
+	for t := range s.unacked {
+		if t == tag || (multiple && t < tag) {
+			tags = append(tags, t)
+		}
+	}
+	if len(tags) == 0 && !multiple {
+		return nil, fmt.Errorf("unknown delivery tag %d", tag)
+	}
+	sort.Slice(tags, func(i, j int) bool { return tags[i] < tags[j] })
+
+	settled := make([]jetstream.Msg, 0, len(tags))
+	for _, t := range tags {
+		settled = append(settled, s.unacked[t])
+		delete(s.unacked, t)
+	}
+	return settled, nil
+}
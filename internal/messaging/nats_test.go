@@ -0,0 +1,33 @@
+package messaging_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/messaging/brokertest"
+)
+
+func TestNATSClient(t *testing.T) {
+	ns, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      -1,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	require.NoError(t, err)
+	go ns.Start()
+	defer ns.Shutdown()
+	require.True(t, ns.ReadyForConnections(5*time.Second), "embedded NATS did not start")
+
+	c, err := messaging.NewNATSClient(ns.ClientURL())
+	require.NoError(t, err)
+	defer c.Close()
+
+	brokertest.Run(t, c)
+}
@@ -0,0 +1,132 @@
+// internal/messaging/options.go
+package messaging
+
+import (
+	"fmt"
+	"time"
+)
+
+// OrderingKeyHeader carries the key that orders related messages; see
+// WithOrderingKey
+const OrderingKeyHeader = "x-ordering-key"
+
+// PublishOptions are the optional properties of a published message
+type PublishOptions struct {
+	// MessageID doubles as the idempotency key consumers deduplicate on
+	MessageID string
+	// EventType is the second part of the routing key, <tenant>.<event_type>
+	EventType string
+	// SourceTenant marks a copy fanned out from another tenant; see
+	// WithSourceTenant
+	SourceTenant string
+	// DeliverAt holds the message back until the given time. Brokers
+	// cannot do this themselves; it needs a scheduler in front of them.
+	DeliverAt time.Time
+	// Priority orders the message within a priority queue; see
+	// QueueOptions.MaxPriority
+	Priority uint8
+	// OrderingKey is sent in the OrderingKeyHeader header
+	OrderingKey string
+}
+
+type PublishOption func(*PublishOptions)
+
+// NewPublishOptions applies opts over the zero options
+func NewPublishOptions(opts ...PublishOption) PublishOptions {
+	var o PublishOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// WithMessageID sets the message ID, which consumers use as the
+// idempotency key when no x-idempotency-key header is present
+func WithMessageID(id string) PublishOption {
+	return func(o *PublishOptions) {
+		o.MessageID = id
+	}
+}
+
+// WithSourceTenant publishes a copy of another tenant's message. The copy
+// goes straight to the tenant queue, bypassing topic bindings and fan-out,
+// and carries the source tenant in the SourceTenantHeader header.
+func WithSourceTenant(tenantID string) PublishOption {
+	return func(o *PublishOptions) {
+		o.SourceTenant = tenantID
+	}
+}
+
+// routingKey is the key a message is published under: the tenant's topic,
+// or for fanned-out copies the queue name, as with the default exchange
+func (o PublishOptions) routingKey(tenantID string) string {
+	if o.SourceTenant != "" {
+		return QueueName(tenantID)
+	}
+	return RoutingKey(tenantID, o.EventType)
+}
+
+// headers returns the message headers implied by the options
+func (o PublishOptions) headers() map[string]interface{} {
+	if o.SourceTenant == "" && o.OrderingKey == "" {
+		return nil
+	}
+	h := make(map[string]interface{}, 3)
+	if o.SourceTenant != "" {
+		h[SourceTenantHeader] = o.SourceTenant
+		eventType := o.EventType
+		if eventType == "" {
+			eventType = DefaultEventType
+		}
+		h[EventTypeHeader] = eventType
+	}
+	if o.OrderingKey != "" {
+		h[OrderingKeyHeader] = o.OrderingKey
+	}
+	return h
+}
+
+// WithDeliverAt delays delivery until t; past times deliver immediately
+func WithDeliverAt(t time.Time) PublishOption {
+	return func(o *PublishOptions) {
+		o.DeliverAt = t
+	}
+}
+
+// WithDelay delays delivery by d from now
+func WithDelay(d time.Duration) PublishOption {
+	return WithDeliverAt(time.Now().Add(d))
+}
+
+// Delayed reports whether the message is due in the future
+func (o PublishOptions) Delayed() bool {
+	return o.DeliverAt.After(time.Now())
+}
+
+// errDelayed is returned by brokers handed a message that is not yet due
+func errDelayed(tenantID string) error {
+	return fmt.Errorf("publish to %s: delayed delivery needs the scheduler: %w", QueueName(tenantID), ErrUnsupported)
+}
+
+// WithPriority sets the message priority. Priorities above the queue's
+// MaxPriority count as MaxPriority; queues without one ignore it.
+func WithPriority(p uint8) PublishOption {
+	return func(o *PublishOptions) {
+		o.Priority = p
+	}
+}
+
+// WithOrderingKey sets the key consumers use to process related messages
+// in order, such as an order ID
+func WithOrderingKey(key string) PublishOption {
+	return func(o *PublishOptions) {
+		o.OrderingKey = key
+	}
+}
+
+// WithEventType sets the event type the message is routed by
+func WithEventType(eventType string) PublishOption {
+	return func(o *PublishOptions) {
+		o.EventType = eventType
+	}
+}
@@ -0,0 +1,224 @@
+// internal/messaging/queue.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrInvalidQueueOptions = errors.New("invalid queue options")
+	// ErrQueueFull is returned when a reject-publish queue is at its limit
+	ErrQueueFull = errors.New("queue full")
+)
+
+// QueueType selects how a tenant queue stores and redelivers messages
+type QueueType string
+
+const (
+	// QueueClassic is a single-node queue; failed messages are requeued
+	// or dead-lettered as the consumer decides
+	QueueClassic QueueType = "classic"
+	// QueueQuorum is a replicated queue that dead-letters a message once
+	// it has been returned more than DeliveryLimit times
+	QueueQuorum QueueType = "quorum"
+	// QueueStream is an append-only log; acked messages are kept, so
+	// consumers can replay them from an offset with FromOffset
+	QueueStream QueueType = "stream"
+)
+
+// DefaultDeliveryLimit applies to quorum queues declared without one
+const DefaultDeliveryLimit = 20
+
+// DeliveryCountHeader counts how often a quorum queue message has been
+// returned to the queue
+const DeliveryCountHeader = "x-delivery-count"
+
+// StreamOffsetHeader carries a stream message's offset on delivery
+const StreamOffsetHeader = "x-stream-offset"
+
+// QueueOptions configure a tenant queue when it is declared
+type QueueOptions struct {
+	// Type defaults to QueueClassic
+	Type QueueType
+	// MaxPriority makes the queue deliver messages with a higher
+	// WithPriority first, for priorities 0..MaxPriority; zero keeps it
+	// FIFO. Only classic queues have priorities.
+	MaxPriority uint8
+	// DeliveryLimit is the number of returns after which a quorum queue
+	// dead-letters a message; zero selects DefaultDeliveryLimit
+	DeliveryLimit int
+	// Limits bound the queue size and message age; unlike the other
+	// options they can be changed later with SetQueueLimits
+	Limits QueueLimits
+}
+
+// OverflowPolicy decides what happens to a message published to a queue
+// at its MaxLength or MaxLengthBytes
+type OverflowPolicy string
+
+const (
+	// OverflowDropHead removes the oldest ready message to make room. It
+	// is dead-lettered where the queue has a DLQ, as RabbitMQ does for
+	// every message a queue drops, and discarded on NATS.
+	OverflowDropHead OverflowPolicy = "drop-head"
+	// OverflowRejectPublish refuses the new message with ErrQueueFull.
+	// RabbitClient learns of it through publisher confirms.
+	OverflowRejectPublish OverflowPolicy = "reject-publish"
+	// OverflowDeadLetter moves the new message straight to the DLQ. Only
+	// classic queues support it.
+	OverflowDeadLetter OverflowPolicy = "dead-letter"
+)
+
+// QueueLimits bound a tenant queue so a runaway producer cannot exhaust
+// the broker. Zero values leave a limit unset.
+type QueueLimits struct {
+	// MaxLength is the number of ready messages; streams have no limit
+	// by count
+	MaxLength int64
+	// MaxLengthBytes is the total body size of ready messages, or of the
+	// retained log for streams
+	MaxLengthBytes int64
+	// MessageTTL expires ready messages, dead-lettering them like
+	// OverflowDropHead; for streams it is the retention period
+	MessageTTL time.Duration
+	// Overflow defaults to OverflowDropHead
+	Overflow OverflowPolicy
+}
+
+// IsZero reports whether no limit is set
+func (l QueueLimits) IsZero() bool {
+	return l == QueueLimits{}
+}
+
+func (l QueueLimits) overflow() OverflowPolicy {
+	if l.Overflow == "" {
+		return OverflowDropHead
+	}
+	return l.Overflow
+}
+
+// rejectsPublish reports whether a queue at these limits refuses new
+// messages rather than dropping old ones
+func (l QueueLimits) rejectsPublish() bool {
+	if l.MaxLength == 0 && l.MaxLengthBytes == 0 {
+		return false
+	}
+	return l.Overflow == OverflowRejectPublish || l.Overflow == OverflowDeadLetter
+}
+
+// validate checks the limits fit a queue of type t
+func (l QueueLimits) validate(t QueueType) error {
+	if l.MaxLength < 0 || l.MaxLengthBytes < 0 || l.MessageTTL < 0 {
+		return fmt.Errorf("%w: negative queue limit", ErrInvalidQueueOptions)
+	}
+	if l.MessageTTL > 0 && l.MessageTTL < time.Millisecond {
+		return fmt.Errorf("%w: message TTL below 1ms", ErrInvalidQueueOptions)
+	}
+	switch l.Overflow {
+	case "", OverflowDropHead, OverflowRejectPublish, OverflowDeadLetter:
+	default:
+		return fmt.Errorf("%w: unknown overflow policy %q", ErrInvalidQueueOptions, l.Overflow)
+	}
+	switch {
+	case t == QueueStream && (l.MaxLength > 0 || l.Overflow != ""):
+		return fmt.Errorf("%w: stream queues are only limited by bytes and age", ErrInvalidQueueOptions)
+	case t != QueueClassic && l.Overflow == OverflowDeadLetter:
+		return fmt.Errorf("%w: %s queues cannot dead-letter on overflow", ErrInvalidQueueOptions, t)
+	}
+	return nil
+}
+
+// Validate checks the options fit the queue type
+func (o QueueOptions) Validate() error {
+	switch o.Type {
+	case "", QueueClassic, QueueQuorum, QueueStream:
+	default:
+		return fmt.Errorf("%w: unknown queue type %q", ErrInvalidQueueOptions, o.Type)
+	}
+	if o.MaxPriority > 0 && o.queueType() != QueueClassic {
+		return fmt.Errorf("%w: %s queues have no priorities", ErrInvalidQueueOptions, o.Type)
+	}
+	if o.DeliveryLimit < 0 || (o.DeliveryLimit > 0 && o.Type != QueueQuorum) {
+		return fmt.Errorf("%w: delivery limit needs a quorum queue", ErrInvalidQueueOptions)
+	}
+	return o.Limits.validate(o.queueType())
+}
+
+func (o QueueOptions) queueType() QueueType {
+	if o.Type == "" {
+		return QueueClassic
+	}
+	return o.Type
+}
+
+// deliveryLimit is the effective limit of a quorum queue, or 0 for none
+func (o QueueOptions) deliveryLimit() int {
+	switch {
+	case o.queueType() != QueueQuorum:
+		return 0
+	case o.DeliveryLimit == 0:
+		return DefaultDeliveryLimit
+	}
+	return o.DeliveryLimit
+}
+
+// StreamOffset is where a stream consumer starts reading: one of the
+// named positions "first", "last" (the latest chunk) and "next" (only new
+// messages), an absolute offset, or the first message stored at or after
+// a time
+type StreamOffset struct {
+	Position string
+	Offset   int64
+	Time     time.Time
+}
+
+var (
+	OffsetFirst = StreamOffset{Position: "first"}
+	OffsetLast  = StreamOffset{Position: "last"}
+	OffsetNext  = StreamOffset{Position: "next"}
+)
+
+// ParseStreamOffset reads a named position, a non-negative offset or an
+// RFC3339 time
+func ParseStreamOffset(s string) (StreamOffset, error) {
+	switch s {
+	case "first", "last", "next":
+		return StreamOffset{Position: s}, nil
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil && n >= 0 {
+		return StreamOffset{Offset: n}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return StreamOffset{Time: t}, nil
+	}
+	return StreamOffset{}, fmt.Errorf("%w: invalid stream offset %q", ErrInvalidQueueOptions, s)
+}
+
+// ConsumeOptions are the optional settings of a subscription
+type ConsumeOptions struct {
+	// Offset, if set, starts a stream queue subscription there rather
+	// than at "next"
+	Offset *StreamOffset
+}
+
+type ConsumeOption func(*ConsumeOptions)
+
+// NewConsumeOptions applies opts over the zero options
+func NewConsumeOptions(opts ...ConsumeOption) ConsumeOptions {
+	var o ConsumeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// FromOffset starts a stream queue subscription at offset; other queue
+// types reject it with ErrUnsupported
+func FromOffset(offset StreamOffset) ConsumeOption {
+	return func(o *ConsumeOptions) {
+		o.Offset = &offset
+	}
+}
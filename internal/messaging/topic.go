@@ -0,0 +1,114 @@
+// internal/messaging/topic.go
+package messaging
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Exchange is the topic exchange all tenant messages are published to
+const Exchange = "tenant.events"
+
+// SourceTenantHeader names the tenant a fanned-out copy originates from
+const SourceTenantHeader = "x-source-tenant"
+
+// EventTypeHeader carries the event type of a fanned-out copy, whose
+// routing key is the target's queue name
+const EventTypeHeader = "x-event-type"
+
+// DefaultEventType is used in the routing key when a message has none
+const DefaultEventType = "default"
+
+var (
+	ErrInvalidPattern = errors.New("invalid binding pattern")
+	ErrUnsupported    = errors.New("not supported by this broker")
+)
+
+// RoutingKey is the topic a tenant's message is published under:
+// <tenant>.<event_type>
+func RoutingKey(tenantID, eventType string) string {
+	if eventType == "" {
+		eventType = DefaultEventType
+	}
+	return tenantID + "." + eventType
+}
+
+// TenantPattern is the binding every tenant queue gets, matching all of
+// the tenant's own events
+func TenantPattern(tenantID string) string {
+	return tenantID + ".#"
+}
+
+// ValidateEventType checks that an event type is one or more dot-separated
+// words without wildcards
+func ValidateEventType(eventType string) error {
+	for _, w := range strings.Split(eventType, ".") {
+		if w == "" || strings.ContainsAny(w, "*#") {
+			return fmt.Errorf("invalid event type %q", eventType)
+		}
+	}
+	return nil
+}
+
+// ValidatePattern checks an extra binding pattern for the tenant's queue.
+// The first word must be the tenant's own ID, so a binding never selects
+// another tenant's events; those only arrive through approved
+// subscriptions. Later words may be "*" (one word) or "#" (zero or more).
+func ValidatePattern(tenantID, pattern string) error {
+	first, rest, _ := strings.Cut(pattern, ".")
+	if first != tenantID {
+		return fmt.Errorf("%w: %q must start with the tenant ID %s", ErrInvalidPattern, pattern, tenantID)
+	}
+	if rest != "" && !validPatternWords(rest) {
+		return fmt.Errorf("%w: %q", ErrInvalidPattern, pattern)
+	}
+	return nil
+}
+
+// ValidateEventPattern checks a pattern over event types, such as
+// "order.*" or "#"
+func ValidateEventPattern(pattern string) error {
+	if !validPatternWords(pattern) {
+		return fmt.Errorf("%w: %q", ErrInvalidPattern, pattern)
+	}
+	return nil
+}
+
+func validPatternWords(pattern string) bool {
+	for _, w := range strings.Split(pattern, ".") {
+		if w == "" || (w != "*" && w != "#" && strings.ContainsAny(w, "*#")) {
+			return false
+		}
+	}
+	return true
+}
+
+// TopicMatch reports whether an AMQP topic pattern matches a routing key
+func TopicMatch(pattern, key string) bool {
+	return matchWords(strings.Split(pattern, "."), strings.Split(key, "."))
+}
+
+func matchWords(pattern, key []string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case "#":
+			for i := 0; i <= len(key); i++ {
+				if matchWords(pattern[1:], key[i:]) {
+					return true
+				}
+			}
+			return false
+		case "*":
+			if len(key) == 0 {
+				return false
+			}
+		default:
+			if len(key) == 0 || key[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, key = pattern[1:], key[1:]
+	}
+	return len(key) == 0
+}
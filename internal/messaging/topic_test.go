@@ -0,0 +1,40 @@
+package messaging_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+)
+
+func TestTopicMatch(t *testing.T) {
+	cases := []struct {
+		pattern, key string
+		match        bool
+	}{
+		{"t1.#", "t1.default", true},
+		{"t1.#", "t1", true},
+		{"t1.#", "t2.default", false},
+		{"t1.order.*", "t1.order.created", true},
+		{"t1.order.*", "t1.order", false},
+		{"t1.order.*", "t1.order.created.v2", false},
+		{"t1.*.created", "t1.user.created", true},
+		{"t1.#.created", "t1.a.b.created", true},
+		{"t1.#.created", "t1.created", true},
+		{"t1.#.created", "t1.a.deleted", false},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.match, messaging.TopicMatch(c.pattern, c.key), "%s ~ %s", c.pattern, c.key)
+	}
+}
+
+func TestValidatePattern(t *testing.T) {
+	const tenant = "0b6f3c58-5a54-4b7e-9d3c-2b1f0a3e6c11"
+	const other = "5d1e9a7c-3f2b-4c8d-a6e0-7b9c1d2e3f40"
+	require.NoError(t, messaging.ValidatePattern(tenant, tenant+".order.*"))
+	require.NoError(t, messaging.ValidatePattern(tenant, tenant+".#"))
+	for _, p := range []string{"#", "*.order", tenant + "..x", tenant + ".ord*", other + ".#", other + ".order.*"} {
+		require.ErrorIs(t, messaging.ValidatePattern(tenant, p), messaging.ErrInvalidPattern, p)
+	}
+}
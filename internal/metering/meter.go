@@ -0,0 +1,107 @@
+// internal/metering/meter.go
+package metering
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+// DefaultFlushInterval is how often Run writes counts to the ledger
+const DefaultFlushInterval = 10 * time.Second
+
+// LedgerStore keeps the hourly usage ledger; storage.Store implements it
+type LedgerStore interface {
+	AddUsage(records []model.UsageRecord) error
+}
+
+type key struct {
+	tenantID uuid.UUID
+	hour     time.Time
+}
+
+// Meter counts per-tenant usage in memory and adds it to the ledger by
+// the hour. Stored messages are metered by the store itself, so a Meter
+// only needs the published and failed counts.
+type Meter struct {
+	// Now is the clock; tests may replace it
+	Now func() time.Time
+
+	store LedgerStore
+
+	mu      sync.Mutex
+	pending map[key]model.Usage
+}
+
+func NewMeter(store LedgerStore) *Meter {
+	return &Meter{
+		Now:     time.Now,
+		store:   store,
+		pending: make(map[key]model.Usage),
+	}
+}
+
+// Record adds u to the tenant's usage for the current hour
+func (m *Meter) Record(tenantID uuid.UUID, u model.Usage) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	k := key{tenantID, m.Now().UTC().Truncate(time.Hour)}
+	p := m.pending[k]
+	p.Add(u)
+	m.pending[k] = p
+}
+
+// Flush adds the counts recorded since the last flush to the ledger. On
+// error they are kept for the next flush.
+func (m *Meter) Flush() error {
+	m.mu.Lock()
+	pending := m.pending
+	m.pending = make(map[key]model.Usage)
+	m.mu.Unlock()
+
+	if len(pending) == 0 {
+		return nil
+	}
+	records := make([]model.UsageRecord, 0, len(pending))
+	for k, u := range pending {
+		records = append(records, model.UsageRecord{TenantID: k.tenantID, Hour: k.hour, Usage: u})
+	}
+	if err := m.store.AddUsage(records); err != nil {
+		m.mu.Lock()
+		for k, u := range pending {
+			p := m.pending[k]
+			p.Add(u)
+			m.pending[k] = p
+		}
+		m.mu.Unlock()
+		return fmt.Errorf("store usage: %w", err)
+	}
+	return nil
+}
+
+// Run flushes every interval until ctx is cancelled, then once more
+func (m *Meter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := m.Flush(); err != nil {
+				log.Printf("[metering] %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := m.Flush(); err != nil {
+				log.Printf("[metering] %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package metering_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/metering"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+// flakyStore fails while fail is set and otherwise keeps what it is given
+type flakyStore struct {
+	fail    bool
+	records []model.UsageRecord
+}
+
+func (s *flakyStore) AddUsage(records []model.UsageRecord) error {
+	if s.fail {
+		return errors.New("database unavailable")
+	}
+	s.records = append(s.records, records...)
+	return nil
+}
+
+func TestMeterFlush(t *testing.T) {
+	store := storage.NewMemoryStore()
+	m := metering.NewMeter(store)
+	now := time.Date(2024, time.March, 10, 12, 30, 0, 0, time.UTC)
+	m.Now = func() time.Time { return now }
+
+	tenantID := uuid.New()
+	m.Record(tenantID, model.Usage{Published: 1})
+	m.Record(tenantID, model.Usage{Published: 1, Failed: 2})
+	now = now.Add(time.Hour)
+	m.Record(tenantID, model.Usage{Published: 5})
+	require.NoError(t, m.Flush())
+	require.NoError(t, m.Flush(), "nothing left to flush")
+
+	hour := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	records, err := store.ListUsage(storage.UsageFilter{TenantID: tenantID, From: hour, To: hour.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.Equal(t, model.Usage{Published: 2, Failed: 2}, records[0].Usage)
+	require.Equal(t, int64(5), records[1].Published)
+}
+
+func TestMeterFlushRetries(t *testing.T) {
+	store := &flakyStore{fail: true}
+	m := metering.NewMeter(store)
+
+	tenantID := uuid.New()
+	m.Record(tenantID, model.Usage{Published: 1})
+	require.Error(t, m.Flush())
+
+	// The failed counts are kept and merged with later ones
+	m.Record(tenantID, model.Usage{Failed: 1})
+	store.fail = false
+	require.NoError(t, m.Flush())
+	require.Len(t, store.records, 1)
+	require.Equal(t, model.Usage{Published: 1, Failed: 1}, store.records[0].Usage)
+}
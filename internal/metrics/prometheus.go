@@ -24,20 +24,112 @@ var (
 		[]string{"tenant"},
 	)
 
+	WorkerAllocated = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "worker_budget_allocated",
+			Help: "Workers allocated to each tenant from the global worker budget",
+		},
+		[]string{"tenant"},
+	)
+
+	AutoscalerTarget = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "autoscaler_target_workers",
+			Help: "Workers the autoscaler last set for each tenant",
+		},
+		[]string{"tenant"},
+	)
+
+	AutoscalerDecisions = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "autoscaler_decisions_total",
+			Help: "Total number of autoscaler worker changes per tenant (direction=up or down)",
+		},
+		[]string{"tenant", "direction"},
+	)
+
+	ProcessingRate = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_processing_rate",
+			Help: "Messages handled per second per tenant over the last autoscaler interval",
+		},
+		[]string{"tenant"},
+	)
+
+	EstimatedLatency = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "tenant_estimated_latency_seconds",
+			Help: "Time a message waits per tenant, the larger of the backlog's drain time and the measured latency",
+		},
+		[]string{"tenant"},
+	)
+
 	QueueDepth = prometheus.NewGaugeVec(
 		prometheus.GaugeOpts{
 			Name: "queue_depth",
-			Help: "Current RabbitMQ queue depth per tenant",
+			Help: "Current broker queue depth per tenant",
+		},
+		[]string{"tenant"},
+	)
+
+	MessageDuplicates = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "messages_duplicates_total",
+			Help: "Total number of duplicate deliveries acked without being stored",
+		},
+		[]string{"tenant"},
+	)
+
+	MessageLatency = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "message_latency_seconds",
+			Help:    "Time from producer publish until the message was received from the broker (stage=queue) or stored (stage=end_to_end)",
+			Buckets: prometheus.ExponentialBuckets(0.005, 2, 14),
+		},
+		[]string{"tenant", "stage"},
+	)
+
+	DBWait = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "db_wait_seconds",
+			Help:    "Time a tenant's database operation waited for its tenant and shared connection limits",
+			Buckets: prometheus.ExponentialBuckets(0.0005, 2, 14),
 		},
 		[]string{"tenant"},
 	)
+
+	KafkaConsumerLag = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "kafka_consumer_lag",
+			Help: "Records behind the partition high watermark as of the tenant's latest consumed record",
+		},
+		[]string{"tenant"},
+	)
+
+	KafkaRecordsSkipped = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "kafka_records_skipped_total",
+			Help: "Total number of Kafka records committed without being stored",
+		},
+		[]string{"reason"},
+	)
 )
 
 // Init registers metrics with Prometheus
 func Init() {
 	prometheus.MustRegister(WorkerProcessed)
 	prometheus.MustRegister(WorkerActive)
+	prometheus.MustRegister(WorkerAllocated)
+	prometheus.MustRegister(AutoscalerTarget)
+	prometheus.MustRegister(AutoscalerDecisions)
+	prometheus.MustRegister(ProcessingRate)
+	prometheus.MustRegister(EstimatedLatency)
 	prometheus.MustRegister(QueueDepth)
+	prometheus.MustRegister(MessageDuplicates)
+	prometheus.MustRegister(MessageLatency)
+	prometheus.MustRegister(DBWait)
+	prometheus.MustRegister(KafkaConsumerLag)
+	prometheus.MustRegister(KafkaRecordsSkipped)
 }
 
 // Handler returns the Prometheus metrics HTTP handler
@@ -0,0 +1,9 @@
+ALTER TABLE messages
+    DROP COLUMN IF EXISTS message_id,
+    DROP COLUMN IF EXISTS correlation_id,
+    DROP COLUMN IF EXISTS headers,
+    DROP COLUMN IF EXISTS content_type,
+    DROP COLUMN IF EXISTS routing_key,
+    DROP COLUMN IF EXISTS redelivered,
+    DROP COLUMN IF EXISTS published_at,
+    DROP COLUMN IF EXISTS processed_at;
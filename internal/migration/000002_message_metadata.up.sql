@@ -0,0 +1,9 @@
+ALTER TABLE messages
+    ADD COLUMN message_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN correlation_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN headers JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN content_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN routing_key TEXT NOT NULL DEFAULT '',
+    ADD COLUMN redelivered BOOLEAN NOT NULL DEFAULT false,
+    ADD COLUMN published_at TIMESTAMPTZ,
+    ADD COLUMN processed_at TIMESTAMPTZ;
@@ -0,0 +1,9 @@
+CREATE TABLE message_dedup (
+    tenant_id UUID NOT NULL,
+    idempotency_key TEXT NOT NULL,
+    message_id UUID NOT NULL,
+    seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (tenant_id, idempotency_key)
+);
+
+CREATE INDEX message_dedup_seen_at_idx ON message_dedup (seen_at);
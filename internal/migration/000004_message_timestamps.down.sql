@@ -0,0 +1,4 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS stored_at;
+ALTER TABLE messages ADD COLUMN IF NOT EXISTS processed_at TIMESTAMPTZ;
+UPDATE messages SET processed_at = received_at;
+ALTER TABLE messages DROP COLUMN IF EXISTS received_at;
@@ -0,0 +1,8 @@
+-- received_at is when the broker delivered a message to a consumer, which
+-- is what processed_at recorded; carry old rows over before dropping it
+ALTER TABLE messages ADD COLUMN received_at TIMESTAMPTZ;
+UPDATE messages SET received_at = processed_at;
+ALTER TABLE messages DROP COLUMN processed_at;
+-- Rows stored before this migration have no known stored time and stay NULL
+ALTER TABLE messages ADD COLUMN stored_at TIMESTAMPTZ;
+ALTER TABLE messages ALTER COLUMN stored_at SET DEFAULT now();
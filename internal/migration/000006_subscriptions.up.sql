@@ -0,0 +1,12 @@
+CREATE TABLE subscriptions (
+    id UUID PRIMARY KEY,
+    source_tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    target_tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    pattern TEXT NOT NULL,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'revoked')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX subscriptions_source_idx ON subscriptions (source_tenant_id, status);
+CREATE INDEX subscriptions_target_idx ON subscriptions (target_tenant_id);
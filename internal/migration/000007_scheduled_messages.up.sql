@@ -0,0 +1,14 @@
+CREATE TABLE scheduled_messages (
+    id UUID PRIMARY KEY,
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    payload JSONB NOT NULL,
+    message_id TEXT NOT NULL DEFAULT '',
+    event_type TEXT NOT NULL DEFAULT '',
+    deliver_at TIMESTAMPTZ NOT NULL,
+    -- set while a scheduler instance is publishing the message
+    claimed_until TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX scheduled_messages_deliver_at_idx ON scheduled_messages (deliver_at);
+CREATE INDEX scheduled_messages_tenant_idx ON scheduled_messages (tenant_id, deliver_at);
@@ -0,0 +1,5 @@
+ALTER TABLE scheduled_messages DROP COLUMN priority;
+
+ALTER TABLE messages DROP COLUMN priority;
+
+ALTER TABLE tenants DROP COLUMN settings;
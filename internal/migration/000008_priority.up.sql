@@ -0,0 +1,5 @@
+ALTER TABLE tenants ADD COLUMN settings JSONB NOT NULL DEFAULT '{}';
+
+ALTER TABLE messages ADD COLUMN priority SMALLINT NOT NULL DEFAULT 0;
+
+ALTER TABLE scheduled_messages ADD COLUMN priority SMALLINT NOT NULL DEFAULT 0;
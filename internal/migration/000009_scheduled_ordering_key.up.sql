@@ -0,0 +1 @@
+ALTER TABLE scheduled_messages ADD COLUMN ordering_key TEXT NOT NULL DEFAULT '';
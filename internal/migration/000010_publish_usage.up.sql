@@ -0,0 +1,8 @@
+CREATE TABLE publish_usage (
+    tenant_id UUID NOT NULL REFERENCES tenants(id) ON DELETE CASCADE,
+    -- first day of the month the usage counts against
+    period DATE NOT NULL,
+    messages BIGINT NOT NULL DEFAULT 0,
+    bytes BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, period)
+);
@@ -0,0 +1,12 @@
+-- Rows outlive their tenant so deleted tenants can still be billed
+CREATE TABLE usage_ledger (
+    tenant_id UUID NOT NULL,
+    hour TIMESTAMPTZ NOT NULL,
+    published BIGINT NOT NULL DEFAULT 0,
+    processed BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
+    bytes_stored BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (tenant_id, hour)
+);
+
+CREATE INDEX usage_ledger_hour_idx ON usage_ledger (hour);
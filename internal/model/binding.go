@@ -0,0 +1,15 @@
+// internal/model/binding.go
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Binding is an extra topic pattern routed to a tenant's queue
+type Binding struct {
+	TenantID  uuid.UUID `json:"tenant_id" db:"tenant_id"`
+	Pattern   string    `json:"pattern" db:"pattern"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,22 @@
+// internal/model/handler.go
+package model
+
+import "encoding/json"
+
+// HandlerRoute runs a chain of handlers, in order, on the messages whose
+// event type matches EventTypes. A tenant's routes are tried in order and
+// the first match wins.
+type HandlerRoute struct {
+	// EventTypes is a pattern over event types, such as "order.*" or "#"
+	EventTypes string        `json:"event_types" example:"order.*"`
+	Handlers   []HandlerSpec `json:"handlers"`
+}
+
+// HandlerSpec configures one handler of a chain
+type HandlerSpec struct {
+	// Type names a registered handler: persist, webhook, transform,
+	// validate or drop
+	Type string `json:"type" example:"webhook"`
+	// Config is the handler's own configuration, if it takes any
+	Config json.RawMessage `json:"config,omitempty" swaggertype:"object"`
+}
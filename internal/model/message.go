@@ -2,14 +2,35 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Message struct {
-	ID        uuid.UUID `db:"id"`
-	TenantID  uuid.UUID `db:"tenant_id"`
-	Payload   []byte    `db:"payload"`
-	CreatedAt time.Time `db:"created_at"`
+	ID       uuid.UUID       `db:"id" json:"id"`
+	TenantID uuid.UUID       `db:"tenant_id" json:"tenant_id"`
+	Payload  json.RawMessage `db:"payload" json:"payload"`
+
+	// Delivery metadata captured from the broker
+	MessageID     string                 `db:"message_id" json:"message_id,omitempty"`
+	CorrelationID string                 `db:"correlation_id" json:"correlation_id,omitempty"`
+	Headers       map[string]interface{} `db:"headers" json:"headers,omitempty"`
+	ContentType   string                 `db:"content_type" json:"content_type,omitempty"`
+	RoutingKey    string                 `db:"routing_key" json:"routing_key,omitempty"`
+	Redelivered   bool                   `db:"redelivered" json:"redelivered"`
+	Priority      uint8                  `db:"priority" json:"priority"`
+
+	// Timeline: set by the producer, on broker delivery, and on DB insert.
+	// CreatedAt is PublishedAt when the producer set it, else ReceivedAt.
+	PublishedAt *time.Time `db:"published_at" json:"published_at,omitempty"`
+	ReceivedAt  *time.Time `db:"received_at" json:"received_at,omitempty"`
+	StoredAt    *time.Time `db:"stored_at" json:"stored_at,omitempty"`
+
+	// IdempotencyKey deduplicates redeliveries; it is tracked in
+	// message_dedup rather than on the message row
+	IdempotencyKey string `db:"-" json:"-"`
+
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
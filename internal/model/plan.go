@@ -0,0 +1,48 @@
+// internal/model/plan.go
+package model
+
+import "slices"
+
+// Plan bundles the limits and features a tenant is entitled to. Zero
+// values leave a limit unset.
+type Plan struct {
+	// Name is the plan's key in the configuration
+	Name string `json:"name" yaml:"-" example:"standard"`
+	// MaxWorkers caps a tenant's concurrency
+	MaxWorkers int `json:"max_workers,omitempty" yaml:"max_workers" example:"5"`
+	// PublishLimits apply to tenants without their own
+	PublishLimits *PublishLimits `json:"publish_limits,omitempty" yaml:"publish_limits"`
+	// QueueLimits cap the tenant queue; tenants may set lower limits. The
+	// message TTL is how long messages are retained in the queue, or in
+	// the log of a stream queue. Overflow is left to the tenant.
+	QueueLimits *QueueLimits `json:"queue_limits,omitempty" yaml:"queue_limits"`
+	// RetentionDays is how long stored messages are kept; older ones are
+	// deleted. Zero keeps them.
+	RetentionDays int `json:"retention_days,omitempty" yaml:"retention_days" example:"30"`
+	// Features lists what the plan enables beyond plain queues
+	Features []string `json:"features" yaml:"features" example:"priority,scheduling"`
+}
+
+// PlanOverrides change a tenant's plan for that tenant alone; set values
+// replace the plan's. Publish limits are overridden by
+// TenantSettings.PublishLimits.
+type PlanOverrides struct {
+	MaxWorkers    int          `json:"max_workers,omitempty" example:"20"`
+	QueueLimits   *QueueLimits `json:"queue_limits,omitempty"`
+	RetentionDays int          `json:"retention_days,omitempty" example:"90"`
+	// Features, if not nil, replaces the plan's feature list
+	Features []string `json:"features,omitempty"`
+}
+
+// HasFeature reports whether the plan enables feature
+func (p Plan) HasFeature(feature string) bool {
+	return slices.Contains(p.Features, feature)
+}
+
+// Workers caps a requested worker count at MaxWorkers
+func (p Plan) Workers(n int) int {
+	if p.MaxWorkers > 0 && n > p.MaxWorkers {
+		return p.MaxWorkers
+	}
+	return n
+}
@@ -0,0 +1,23 @@
+// internal/model/scheduled.go
+package model
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScheduledMessage is a message held back until DeliverAt, when the
+// scheduler publishes it to the tenant queue
+type ScheduledMessage struct {
+	ID          uuid.UUID       `json:"id" db:"id"`
+	TenantID    uuid.UUID       `json:"tenant_id" db:"tenant_id"`
+	Payload     json.RawMessage `json:"payload" db:"payload"`
+	MessageID   string          `json:"message_id" db:"message_id"`
+	EventType   string          `json:"event_type,omitempty" db:"event_type"`
+	Priority    uint8           `json:"priority,omitempty" db:"priority"`
+	OrderingKey string          `json:"ordering_key,omitempty" db:"ordering_key"`
+	DeliverAt   time.Time       `json:"deliver_at" db:"deliver_at"`
+	CreatedAt   time.Time       `json:"created_at" db:"created_at"`
+}
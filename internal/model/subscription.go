@@ -0,0 +1,28 @@
+// internal/model/subscription.go
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Subscription statuses. A target tenant requests a subscription, the
+// source tenant approves it, and either side may revoke it.
+const (
+	SubscriptionPending  = "pending"
+	SubscriptionApproved = "approved"
+	SubscriptionRevoked  = "revoked"
+)
+
+// Subscription copies a source tenant's messages whose event type matches
+// Pattern into the target tenant's queue while approved
+type Subscription struct {
+	ID             uuid.UUID `json:"id" db:"id"`
+	SourceTenantID uuid.UUID `json:"source_tenant_id" db:"source_tenant_id"`
+	TargetTenantID uuid.UUID `json:"target_tenant_id" db:"target_tenant_id"`
+	Pattern        string    `json:"pattern" db:"pattern"`
+	Status         string    `json:"status" db:"status"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at" db:"updated_at"`
+}
@@ -8,8 +8,93 @@ import (
 )
 
 type Tenant struct {
-	ID          uuid.UUID `db:"id"`
-	Name        string    `json:"name"`
-	Concurrency int       `json:"concurrency"`
-	CreatedAt   time.Time `db:"created_at"`
+	ID          uuid.UUID      `db:"id"`
+	Name        string         `json:"name"`
+	Concurrency int            `json:"concurrency"`
+	Settings    TenantSettings `db:"settings" json:"settings"`
+	CreatedAt   time.Time      `db:"created_at"`
+}
+
+// TenantSettings are per-tenant options stored as JSONB on the tenant row
+type TenantSettings struct {
+	// MaxPriority makes the tenant queue a priority queue with levels
+	// 0..MaxPriority; zero keeps it FIFO. Brokers fix it when the queue
+	// is declared, so it is set on tenant creation only.
+	MaxPriority uint8 `json:"max_priority,omitempty"`
+	// QueueType is classic (the default), quorum or stream; like
+	// MaxPriority it is fixed on creation
+	QueueType string `json:"queue_type,omitempty" example:"quorum"`
+	// DeliveryLimit is how often a quorum queue redelivers a failing
+	// message before dead-lettering it; zero selects the broker default
+	DeliveryLimit int `json:"delivery_limit,omitempty"`
+	// Ordering selects the key that keeps related messages in order when
+	// the tenant runs several workers; nil uses the x-ordering-key header
+	Ordering *OrderingKey `json:"ordering,omitempty"`
+	// Limits bound the tenant queue; unlike the options above they can be
+	// changed on an existing queue
+	Limits *QueueLimits `json:"limits,omitempty"`
+	// PublishLimits cap how fast and how much the tenant may publish,
+	// overriding its plan's; they are set by an administrator
+	PublishLimits *PublishLimits `json:"publish_limits,omitempty"`
+	// Plan names the tenant's plan, set by an administrator; empty selects
+	// the default plan
+	Plan string `json:"plan,omitempty" example:"standard"`
+	// PlanOverrides adjust the plan for this tenant; they are set by an
+	// administrator
+	PlanOverrides *PlanOverrides `json:"plan_overrides,omitempty"`
+	// Weight is the tenant's share of a global worker budget relative to
+	// other tenants; zero counts as 1. It is set by an administrator.
+	Weight int `json:"weight,omitempty" example:"2"`
+	// Autoscale adjusts the tenant's workers to its backlog; nil uses the
+	// server's defaults
+	Autoscale *Autoscale `json:"autoscale,omitempty"`
+	// Handlers pick the chain of handlers each message runs through by
+	// its event type; messages no route matches are stored, as are all
+	// of them without routes
+	Handlers []HandlerRoute `json:"handlers,omitempty"`
+}
+
+// Autoscale configures a tenant's autoscaling. Zero values take the
+// server's defaults.
+type Autoscale struct {
+	Enabled    bool `json:"enabled"`
+	MinWorkers int  `json:"min_workers,omitempty" example:"1"`
+	MaxWorkers int  `json:"max_workers,omitempty" example:"10"`
+	// TargetLatencyMS is how long messages may wait before workers are
+	// added; they are removed once it drops below half of that
+	TargetLatencyMS int64 `json:"target_latency_ms,omitempty" example:"5000"`
+}
+
+// PublishLimits are a tenant's publish rate limits and monthly quotas.
+// Zero values leave a limit unset. The rates allow bursts of one
+// second's worth.
+type PublishLimits struct {
+	MessagesPerSecond float64 `json:"messages_per_second,omitempty" yaml:"messages_per_second" example:"100"`
+	BytesPerSecond    float64 `json:"bytes_per_second,omitempty" yaml:"bytes_per_second" example:"1048576"`
+	// MonthlyMessages and MonthlyBytes cap publishes per calendar month
+	// (UTC)
+	MonthlyMessages int64 `json:"monthly_messages,omitempty" yaml:"monthly_messages" example:"1000000"`
+	MonthlyBytes    int64 `json:"monthly_bytes,omitempty" yaml:"monthly_bytes" example:"10737418240"`
+}
+
+// QueueLimits cap a tenant queue so one tenant cannot exhaust the broker.
+// Zero values leave a limit unset.
+type QueueLimits struct {
+	MaxLength      int64 `json:"max_length,omitempty" yaml:"max_length" example:"100000"`
+	MaxLengthBytes int64 `json:"max_length_bytes,omitempty" yaml:"max_length_bytes" example:"104857600"`
+	// MessageTTLMS expires queued messages to the DLQ; for stream queues
+	// it is the retention period
+	MessageTTLMS int64 `json:"message_ttl_ms,omitempty" yaml:"message_ttl_ms" example:"86400000"`
+	// Overflow is what happens to a message published to a full queue:
+	// drop-head (the default) dead-letters the oldest, reject-publish
+	// refuses the new one and dead-letter dead-letters the new one
+	Overflow string `json:"overflow,omitempty" yaml:"overflow" example:"reject-publish"`
+}
+
+// OrderingKey locates a message's ordering key, either in a header or at
+// a dot-separated JSON path into the payload such as $.order.id. Messages
+// with the same key are processed one at a time, in delivery order.
+type OrderingKey struct {
+	Header   string `json:"header,omitempty" example:"x-ordering-key"`
+	JSONPath string `json:"json_path,omitempty" example:"$.order_id"`
 }
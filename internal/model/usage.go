@@ -0,0 +1,47 @@
+// internal/model/usage.go
+package model
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PublishUsage is what a tenant published in a calendar month, counted
+// against its monthly quotas
+type PublishUsage struct {
+	TenantID uuid.UUID `json:"tenant_id"`
+	// Period is the first day of the month (UTC)
+	Period   time.Time `json:"period"`
+	Messages int64     `json:"messages"`
+	Bytes    int64     `json:"bytes"`
+}
+
+// Usage is what a tenant was metered for
+type Usage struct {
+	// Published counts messages accepted for the tenant, including
+	// scheduled and Kafka-ingested ones
+	Published int64 `json:"published"`
+	// Processed counts messages stored, excluding duplicates
+	Processed int64 `json:"processed"`
+	// Failed counts deliveries that could not be stored, once per attempt
+	Failed int64 `json:"failed"`
+	// BytesStored is the payload size of the processed messages
+	BytesStored int64 `json:"bytes_stored"`
+}
+
+// Add adds o to u
+func (u *Usage) Add(o Usage) {
+	u.Published += o.Published
+	u.Processed += o.Processed
+	u.Failed += o.Failed
+	u.BytesStored += o.BytesStored
+}
+
+// UsageRecord is a tenant's usage in the hour starting at Hour (UTC),
+// one row of the usage ledger
+type UsageRecord struct {
+	TenantID uuid.UUID `json:"tenant_id"`
+	Hour     time.Time `json:"hour"`
+	Usage
+}
@@ -0,0 +1,206 @@
+// internal/plan/plan.go
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/ratelimit"
+)
+
+var (
+	ErrUnknownPlan = errors.New("unknown plan")
+	ErrInvalidPlan = errors.New("invalid plan")
+	// ErrFeatureDisabled is returned for settings or calls that need a
+	// feature the tenant's plan does not include
+	ErrFeatureDisabled = errors.New("feature not included in plan")
+	// ErrLimitExceeded is returned for settings above the plan's limits
+	ErrLimitExceeded = errors.New("exceeds plan limit")
+)
+
+// Features a plan can enable
+const (
+	FeaturePriority   = "priority"
+	FeatureQuorum     = "quorum"
+	FeatureStream     = "stream"
+	FeatureScheduling = "scheduling"
+)
+
+// AllFeatures are enabled by the implicit plan of a Catalog without plans
+var AllFeatures = []string{FeaturePriority, FeatureQuorum, FeatureStream, FeatureScheduling}
+
+// Catalog holds the configured plans. Without any, every tenant is on an
+// implicit unlimited plan with all features, as before plans existed.
+type Catalog struct {
+	plans       map[string]model.Plan
+	defaultPlan string
+}
+
+// NewCatalog checks the plans and that defaultPlan is one of them;
+// tenants that name no plan are on defaultPlan
+func NewCatalog(plans map[string]model.Plan, defaultPlan string) (*Catalog, error) {
+	c := &Catalog{plans: make(map[string]model.Plan, len(plans)), defaultPlan: defaultPlan}
+	for name, p := range plans {
+		p.Name = name
+		if err := validate(p); err != nil {
+			return nil, fmt.Errorf("plan %q: %w", name, err)
+		}
+		c.plans[name] = p
+	}
+	if len(c.plans) == 0 {
+		if defaultPlan != "" {
+			return nil, fmt.Errorf("%w: default plan %q", ErrUnknownPlan, defaultPlan)
+		}
+		return c, nil
+	}
+	if _, ok := c.plans[defaultPlan]; !ok {
+		return nil, fmt.Errorf("%w: default plan %q", ErrUnknownPlan, defaultPlan)
+	}
+	return c, nil
+}
+
+func validate(p model.Plan) error {
+	if p.MaxWorkers < 0 {
+		return fmt.Errorf("%w: negative max workers", ErrInvalidPlan)
+	}
+	if p.RetentionDays < 0 {
+		return fmt.Errorf("%w: negative retention", ErrInvalidPlan)
+	}
+	if err := ratelimit.Validate(p.PublishLimits); err != nil {
+		return err
+	}
+	if q := p.QueueLimits; q != nil {
+		if q.MaxLength < 0 || q.MaxLengthBytes < 0 || q.MessageTTLMS < 0 {
+			return fmt.Errorf("%w: negative queue limit", ErrInvalidPlan)
+		}
+		if q.Overflow != "" {
+			return fmt.Errorf("%w: overflow is chosen by the tenant", ErrInvalidPlan)
+		}
+	}
+	for _, f := range p.Features {
+		if !slices.Contains(AllFeatures, f) {
+			return fmt.Errorf("%w: unknown feature %q", ErrInvalidPlan, f)
+		}
+	}
+	return nil
+}
+
+// List returns the configured plans by name
+func (c *Catalog) List() []model.Plan {
+	plans := make([]model.Plan, 0, len(c.plans))
+	for _, p := range c.plans {
+		plans = append(plans, p)
+	}
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Name < plans[j].Name })
+	return plans
+}
+
+// Resolve returns the plan a tenant is on with its overrides applied; an
+// empty name selects the default plan
+func (c *Catalog) Resolve(name string, overrides *model.PlanOverrides) (model.Plan, error) {
+	var p model.Plan
+	switch {
+	case len(c.plans) == 0 && name == "":
+		p = model.Plan{Features: AllFeatures}
+	case name == "":
+		p = c.plans[c.defaultPlan]
+	default:
+		var ok bool
+		if p, ok = c.plans[name]; !ok {
+			return model.Plan{}, fmt.Errorf("%w: %q", ErrUnknownPlan, name)
+		}
+	}
+	if overrides == nil {
+		return p, nil
+	}
+
+	if overrides.MaxWorkers != 0 {
+		p.MaxWorkers = overrides.MaxWorkers
+	}
+	if overrides.QueueLimits != nil {
+		p.QueueLimits = overrides.QueueLimits
+	}
+	if overrides.RetentionDays != 0 {
+		p.RetentionDays = overrides.RetentionDays
+	}
+	if overrides.Features != nil {
+		p.Features = overrides.Features
+	}
+	if err := validate(p); err != nil {
+		return model.Plan{}, fmt.Errorf("overrides: %w", err)
+	}
+	return p, nil
+}
+
+// CheckFeatures checks that the plan includes the features a new tenant's
+// queue needs
+func CheckFeatures(p model.Plan, settings model.TenantSettings) error {
+	need := func(feature string) error {
+		if !p.HasFeature(feature) {
+			return fmt.Errorf("%w: %s", ErrFeatureDisabled, feature)
+		}
+		return nil
+	}
+	if settings.MaxPriority > 0 {
+		if err := need(FeaturePriority); err != nil {
+			return err
+		}
+	}
+	switch settings.QueueType {
+	case "quorum":
+		return need(FeatureQuorum)
+	case "stream":
+		return need(FeatureStream)
+	}
+	return nil
+}
+
+// QueueLimits returns the limits a tenant queue of queueType is declared
+// with: the tenant's own where set, else the plan's. Along with them it
+// returns an ErrLimitExceeded error if the tenant's are above the plan's,
+// in which case the plan's apply. Stream queues take no length limit.
+func QueueLimits(p model.Plan, queueType string, requested *model.QueueLimits) (*model.QueueLimits, error) {
+	var caps model.QueueLimits
+	if p.QueueLimits != nil {
+		caps = *p.QueueLimits
+	}
+	if queueType == "stream" {
+		caps.MaxLength = 0
+	}
+	var limits model.QueueLimits
+	if requested != nil {
+		limits = *requested
+	}
+
+	var err error
+	clamp := func(name string, v *int64, limit int64) {
+		switch {
+		case limit == 0:
+		case *v == 0:
+			*v = limit
+		case *v > limit:
+			*v = limit
+			err = fmt.Errorf("%w: %s above %d", ErrLimitExceeded, name, limit)
+		}
+	}
+	clamp("max_length", &limits.MaxLength, caps.MaxLength)
+	clamp("max_length_bytes", &limits.MaxLengthBytes, caps.MaxLengthBytes)
+	clamp("message_ttl_ms", &limits.MessageTTLMS, caps.MessageTTLMS)
+
+	if limits == (model.QueueLimits{}) {
+		return nil, err
+	}
+	return &limits, err
+}
+
+// PublishLimits returns the publish limits that apply to a tenant: its
+// own if an administrator set them, else the plan's
+func PublishLimits(p model.Plan, own *model.PublishLimits) *model.PublishLimits {
+	if own != nil {
+		return own
+	}
+	return p.PublishLimits
+}
@@ -0,0 +1,88 @@
+package plan_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/plan"
+)
+
+func testCatalog(t *testing.T) *plan.Catalog {
+	c, err := plan.NewCatalog(map[string]model.Plan{
+		"free": {
+			MaxWorkers:  1,
+			QueueLimits: &model.QueueLimits{MaxLength: 1000, MessageTTLMS: 60000},
+		},
+		"enterprise": {
+			MaxWorkers: 50,
+			Features:   plan.AllFeatures,
+		},
+	}, "free")
+	require.NoError(t, err)
+	return c
+}
+
+func TestCatalogResolve(t *testing.T) {
+	c := testCatalog(t)
+
+	p, err := c.Resolve("", nil)
+	require.NoError(t, err)
+	require.Equal(t, "free", p.Name)
+	require.Equal(t, 1, p.Workers(3))
+
+	p, err = c.Resolve("free", &model.PlanOverrides{MaxWorkers: 4, Features: []string{plan.FeatureScheduling}})
+	require.NoError(t, err)
+	require.Equal(t, 4, p.MaxWorkers)
+	require.True(t, p.HasFeature(plan.FeatureScheduling))
+	require.Equal(t, int64(1000), p.QueueLimits.MaxLength, "not overridden")
+
+	_, err = c.Resolve("gold", nil)
+	require.ErrorIs(t, err, plan.ErrUnknownPlan)
+	_, err = c.Resolve("free", &model.PlanOverrides{Features: []string{"teleport"}})
+	require.ErrorIs(t, err, plan.ErrInvalidPlan)
+
+	_, err = plan.NewCatalog(map[string]model.Plan{"free": {}}, "standard")
+	require.ErrorIs(t, err, plan.ErrUnknownPlan)
+
+	// Without plans every tenant is unlimited
+	empty, err := plan.NewCatalog(nil, "")
+	require.NoError(t, err)
+	p, err = empty.Resolve("", nil)
+	require.NoError(t, err)
+	require.Equal(t, 8, p.Workers(8))
+	require.NoError(t, plan.CheckFeatures(p, model.TenantSettings{QueueType: "stream"}))
+}
+
+func TestPlanEnforcement(t *testing.T) {
+	c := testCatalog(t)
+	free, err := c.Resolve("free", nil)
+	require.NoError(t, err)
+
+	require.ErrorIs(t, plan.CheckFeatures(free, model.TenantSettings{MaxPriority: 5}), plan.ErrFeatureDisabled)
+	require.ErrorIs(t, plan.CheckFeatures(free, model.TenantSettings{QueueType: "quorum"}), plan.ErrFeatureDisabled)
+	require.NoError(t, plan.CheckFeatures(free, model.TenantSettings{}))
+
+	// Unset limits take the plan's, lower ones are kept, higher ones are
+	// refused and capped
+	limits, err := plan.QueueLimits(free, "classic", nil)
+	require.NoError(t, err)
+	require.Equal(t, model.QueueLimits{MaxLength: 1000, MessageTTLMS: 60000}, *limits)
+
+	limits, err = plan.QueueLimits(free, "classic", &model.QueueLimits{MaxLength: 10, Overflow: "reject-publish"})
+	require.NoError(t, err)
+	require.Equal(t, model.QueueLimits{MaxLength: 10, MessageTTLMS: 60000, Overflow: "reject-publish"}, *limits)
+
+	limits, err = plan.QueueLimits(free, "classic", &model.QueueLimits{MaxLength: 5000})
+	require.ErrorIs(t, err, plan.ErrLimitExceeded)
+	require.Equal(t, int64(1000), limits.MaxLength)
+
+	limits, err = plan.QueueLimits(free, "stream", nil)
+	require.NoError(t, err)
+	require.Zero(t, limits.MaxLength, "streams have no length limit")
+
+	own := &model.PublishLimits{MessagesPerSecond: 5}
+	require.Same(t, own, plan.PublishLimits(free, own))
+	require.Nil(t, plan.PublishLimits(free, nil))
+}
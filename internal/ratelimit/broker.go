@@ -0,0 +1,34 @@
+// internal/ratelimit/broker.go
+package ratelimit
+
+import (
+	"fmt"
+
+	"multi-tenant/internal/messaging"
+)
+
+// Broker decorates a Broker so every publish is counted against the
+// tenant's limits first
+type Broker struct {
+	messaging.Broker
+
+	limiter *Limiter
+}
+
+func NewBroker(b messaging.Broker, l *Limiter) *Broker {
+	return &Broker{Broker: b, limiter: l}
+}
+
+// Publish refuses the message with a *LimitError when the tenant is over
+// its rate or quota. A publish the broker fails is not counted.
+func (b *Broker) Publish(tenantID string, body []byte, opts ...messaging.PublishOption) error {
+	res, err := b.limiter.Reserve(tenantID, len(body))
+	if err != nil {
+		return fmt.Errorf("publish for tenant %s: %w", tenantID, err)
+	}
+	if err := b.Broker.Publish(tenantID, body, opts...); err != nil {
+		res.Cancel()
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+// internal/ratelimit/bucket.go
+package ratelimit
+
+import (
+	"math"
+	"time"
+)
+
+// bucket is a token bucket refilled at rate tokens per second up to one
+// second's worth. A request larger than the bucket only needs it full and
+// leaves it in debt, so large messages are slowed down rather than
+// refused forever.
+type bucket struct {
+	rate     float64
+	capacity float64
+	tokens   float64
+	last     time.Time
+}
+
+func newBucket(rate float64, now time.Time) *bucket {
+	capacity := math.Max(rate, 1)
+	return &bucket{rate: rate, capacity: capacity, tokens: capacity, last: now}
+}
+
+func (b *bucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last).Seconds(); elapsed > 0 {
+		b.tokens = math.Min(b.capacity, b.tokens+elapsed*b.rate)
+		b.last = now
+	}
+}
+
+// wait returns how long until n tokens can be taken, or 0 if they can
+// be taken now
+func (b *bucket) wait(now time.Time, n float64) time.Duration {
+	b.refill(now)
+	need := math.Min(n, b.capacity)
+	if b.tokens >= need {
+		return 0
+	}
+	return time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+}
+
+func (b *bucket) take(n float64) {
+	b.tokens -= n
+}
+
+// give returns n tokens taken by a request that did not go through
+func (b *bucket) give(n float64) {
+	b.tokens = math.Min(b.capacity, b.tokens+n)
+}
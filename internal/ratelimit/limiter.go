@@ -0,0 +1,361 @@
+// internal/ratelimit/limiter.go
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+var (
+	ErrRateLimited   = errors.New("publish rate limit exceeded")
+	ErrQuotaExceeded = errors.New("monthly publish quota exceeded")
+	ErrInvalidLimits = errors.New("invalid publish limits")
+)
+
+// DefaultFlushInterval is how often Run writes usage counts to the store
+const DefaultFlushInterval = 5 * time.Second
+
+// LimitError is returned for a refused publish; it wraps ErrRateLimited
+// or ErrQuotaExceeded
+type LimitError struct {
+	Err error
+	// RetryAfter is when the publish would be allowed
+	RetryAfter time.Duration
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%v, retry after %s", e.Err, e.RetryAfter.Round(time.Millisecond))
+}
+
+func (e *LimitError) Unwrap() error {
+	return e.Err
+}
+
+// UsageStore keeps the monthly publish counts; storage.Store implements it
+type UsageStore interface {
+	AddPublishUsage(tenantID uuid.UUID, period time.Time, messages, bytes int64) error
+	GetPublishUsage(tenantID uuid.UUID, period time.Time) (model.PublishUsage, error)
+}
+
+// Limiter enforces per-tenant publish rate limits and monthly quotas.
+// Rates are enforced per process. Usage is counted in memory and added to
+// the store by Run; every flush makes the next quota check reload the
+// month so far, so replicas see each other's usage within a flush
+// interval.
+type Limiter struct {
+	// Now is the clock; tests may replace it
+	Now func() time.Time
+
+	store UsageStore
+
+	mu      sync.Mutex
+	tenants map[string]*tenantState
+}
+
+type tenantState struct {
+	mu       sync.Mutex
+	limits   model.PublishLimits
+	messages *bucket // nil without a message rate
+	bytes    *bucket // nil without a byte rate
+
+	period       time.Time // month that used counts
+	loaded       bool      // whether used includes the stored usage
+	usedMessages int64
+	usedBytes    int64
+	pending      map[time.Time]usage // counted but not yet stored, by month
+}
+
+type usage struct {
+	messages, bytes int64
+}
+
+func NewLimiter(store UsageStore) *Limiter {
+	return &Limiter{
+		store:   store,
+		Now:     time.Now,
+		tenants: make(map[string]*tenantState),
+	}
+}
+
+// Validate checks publish limits; nil is valid and means no limits
+func Validate(limits *model.PublishLimits) error {
+	if limits == nil {
+		return nil
+	}
+	if limits.MessagesPerSecond < 0 || limits.BytesPerSecond < 0 || limits.MonthlyMessages < 0 || limits.MonthlyBytes < 0 {
+		return fmt.Errorf("%w: limits must not be negative", ErrInvalidLimits)
+	}
+	return nil
+}
+
+// monthStart returns the first instant of t's month in UTC
+func monthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (l *Limiter) tenant(tenantID string) *tenantState {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t, ok := l.tenants[tenantID]
+	if !ok {
+		t = &tenantState{pending: make(map[time.Time]usage)}
+		l.tenants[tenantID] = t
+	}
+	return t
+}
+
+// SetLimits replaces a tenant's limits; nil removes them. Rate buckets
+// whose rate is unchanged keep their tokens.
+func (l *Limiter) SetLimits(tenantID string, limits *model.PublishLimits) {
+	var lim model.PublishLimits
+	if limits != nil {
+		lim = *limits
+	}
+	now := l.Now()
+
+	t := l.tenant(tenantID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if lim.MessagesPerSecond != t.limits.MessagesPerSecond {
+		t.messages = nil
+		if lim.MessagesPerSecond > 0 {
+			t.messages = newBucket(lim.MessagesPerSecond, now)
+		}
+	}
+	if lim.BytesPerSecond != t.limits.BytesPerSecond {
+		t.bytes = nil
+		if lim.BytesPerSecond > 0 {
+			t.bytes = newBucket(lim.BytesPerSecond, now)
+		}
+	}
+	t.limits = lim
+	t.loaded = false
+}
+
+// Remove forgets a tenant, dropping usage not yet stored
+func (l *Limiter) Remove(tenantID string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.tenants, tenantID)
+}
+
+// Reservation is a publish counted by Reserve
+type Reservation struct {
+	t        *tenantState
+	period   time.Time
+	size     int64
+	messages *bucket
+	bytes    *bucket
+	canceled bool
+}
+
+// Cancel takes back a reserved publish that did not go through, returning
+// its rate tokens and its share of the quota. It is a no-op after the
+// first call.
+func (r *Reservation) Cancel() {
+	t := r.t
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if r.canceled {
+		return
+	}
+	r.canceled = true
+
+	// Buckets replaced by SetLimits since started afresh
+	if r.messages != nil && r.messages == t.messages {
+		r.messages.give(1)
+	}
+	if r.bytes != nil && r.bytes == t.bytes {
+		r.bytes.give(float64(r.size))
+	}
+	if t.period.Equal(r.period) {
+		t.usedMessages--
+		t.usedBytes -= r.size
+	}
+	// Goes negative if the publish was already flushed, taking it back
+	// from the store on the next flush
+	p := t.pending[r.period]
+	p.messages--
+	p.bytes -= r.size
+	t.pending[r.period] = p
+}
+
+// Allow counts a publish of size bytes against the tenant's limits, or
+// returns a *LimitError without counting it. Use Reserve for publishes
+// that may still fail.
+func (l *Limiter) Allow(tenantID string, size int) error {
+	_, err := l.Reserve(tenantID, size)
+	return err
+}
+
+// Reserve counts a publish of size bytes against the tenant's limits, or
+// returns a *LimitError without counting it. The caller cancels the
+// reservation if the publish then fails. If the month's usage cannot be
+// read the quota is not enforced until it can.
+func (l *Limiter) Reserve(tenantID string, size int) (*Reservation, error) {
+	now := l.Now()
+	period := monthStart(now)
+
+	t := l.tenant(tenantID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.period.Equal(period) {
+		t.period, t.loaded = period, false
+		t.usedMessages, t.usedBytes = 0, 0
+	}
+
+	lim := t.limits
+	if lim.MonthlyMessages > 0 || lim.MonthlyBytes > 0 {
+		if !t.loaded {
+			if err := l.load(tenantID, t); err != nil {
+				log.Printf("[ratelimit] Failed to load usage of tenant %s: %v", tenantID, err)
+			}
+		}
+		if (lim.MonthlyMessages > 0 && t.usedMessages+1 > lim.MonthlyMessages) ||
+			(lim.MonthlyBytes > 0 && t.usedBytes+int64(size) > lim.MonthlyBytes) {
+			return nil, &LimitError{Err: ErrQuotaExceeded, RetryAfter: period.AddDate(0, 1, 0).Sub(now)}
+		}
+	}
+
+	var wait time.Duration
+	if t.messages != nil {
+		wait = max(wait, t.messages.wait(now, 1))
+	}
+	if t.bytes != nil {
+		wait = max(wait, t.bytes.wait(now, float64(size)))
+	}
+	if wait > 0 {
+		return nil, &LimitError{Err: ErrRateLimited, RetryAfter: wait}
+	}
+	if t.messages != nil {
+		t.messages.take(1)
+	}
+	if t.bytes != nil {
+		t.bytes.take(float64(size))
+	}
+
+	t.usedMessages++
+	t.usedBytes += int64(size)
+	p := t.pending[period]
+	p.messages++
+	p.bytes += int64(size)
+	t.pending[period] = p
+	return &Reservation{t: t, period: period, size: int64(size), messages: t.messages, bytes: t.bytes}, nil
+}
+
+// load sets the month's usage to the stored usage plus what is not yet
+// stored. Callers must hold t.mu.
+func (l *Limiter) load(tenantID string, t *tenantState) error {
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return err
+	}
+	stored, err := l.store.GetPublishUsage(id, t.period)
+	if err != nil {
+		return err
+	}
+	p := t.pending[t.period]
+	t.usedMessages = stored.Messages + p.messages
+	t.usedBytes = stored.Bytes + p.bytes
+	t.loaded = true
+	return nil
+}
+
+// Usage returns what the tenant published this month, including usage
+// not yet stored
+func (l *Limiter) Usage(tenantID string) (model.PublishUsage, error) {
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return model.PublishUsage{}, err
+	}
+	period := monthStart(l.Now())
+	u, err := l.store.GetPublishUsage(id, period)
+	if err != nil {
+		return model.PublishUsage{}, fmt.Errorf("read usage of tenant %s: %w", tenantID, err)
+	}
+
+	t := l.tenant(tenantID)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	p := t.pending[period]
+	u.Messages += p.messages
+	u.Bytes += p.bytes
+	return u, nil
+}
+
+// Flush adds the usage counted since the last flush to the store. Counts
+// that fail to store are kept for the next flush. Quotas are checked
+// against the stored usage again afterwards, picking up what other
+// replicas flushed.
+func (l *Limiter) Flush() error {
+	l.mu.Lock()
+	tenants := make(map[string]*tenantState, len(l.tenants))
+	for id, t := range l.tenants {
+		tenants[id] = t
+	}
+	l.mu.Unlock()
+
+	var errs []error
+	for tenantID, t := range tenants {
+		t.mu.Lock()
+		pending := t.pending
+		t.pending = make(map[time.Time]usage)
+		t.mu.Unlock()
+
+		id, err := uuid.Parse(tenantID)
+		if err != nil {
+			continue
+		}
+		for period, u := range pending {
+			if err := l.store.AddPublishUsage(id, period, u.messages, u.bytes); err != nil {
+				errs = append(errs, fmt.Errorf("store usage of tenant %s: %w", tenantID, err))
+				t.mu.Lock()
+				p := t.pending[period]
+				p.messages += u.messages
+				p.bytes += u.bytes
+				t.pending[period] = p
+				t.mu.Unlock()
+			}
+		}
+
+		t.mu.Lock()
+		t.loaded = false
+		t.mu.Unlock()
+	}
+	return errors.Join(errs...)
+}
+
+// Run flushes usage every interval until ctx is cancelled, then once more
+func (l *Limiter) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			if err := l.Flush(); err != nil {
+				log.Printf("[ratelimit] %v", err)
+			}
+			return
+		case <-ticker.C:
+			if err := l.Flush(); err != nil {
+				log.Printf("[ratelimit] %v", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package ratelimit_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/ratelimit"
+	"multi-tenant/internal/storage"
+)
+
+func TestLimiterRate(t *testing.T) {
+	l := ratelimit.NewLimiter(storage.NewMemoryStore())
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	l.Now = func() time.Time { return now }
+
+	tenantID := uuid.NewString()
+	l.SetLimits(tenantID, &model.PublishLimits{MessagesPerSecond: 2, BytesPerSecond: 100})
+
+	// A second's burst, then refused until tokens refill
+	require.NoError(t, l.Allow(tenantID, 10))
+	require.NoError(t, l.Allow(tenantID, 10))
+	var limitErr *ratelimit.LimitError
+	require.ErrorAs(t, l.Allow(tenantID, 10), &limitErr)
+	require.ErrorIs(t, limitErr, ratelimit.ErrRateLimited)
+	require.Equal(t, 500*time.Millisecond, limitErr.RetryAfter)
+
+	// A message above the byte burst waits for a full bucket and leaves
+	// it in debt
+	now = now.Add(time.Second)
+	require.NoError(t, l.Allow(tenantID, 250))
+	now = now.Add(time.Second)
+	require.ErrorIs(t, l.Allow(tenantID, 1), ratelimit.ErrRateLimited)
+	now = now.Add(2 * time.Second)
+	require.NoError(t, l.Allow(tenantID, 1))
+
+	l.SetLimits(tenantID, nil)
+	for range 10 {
+		require.NoError(t, l.Allow(tenantID, 1000))
+	}
+}
+
+func TestLimiterMonthlyQuota(t *testing.T) {
+	store := storage.NewMemoryStore()
+	id := uuid.New()
+	require.NoError(t, store.CreateTenant(id))
+	now := time.Date(2024, time.March, 31, 23, 0, 0, 0, time.UTC)
+
+	l := ratelimit.NewLimiter(store)
+	l.Now = func() time.Time { return now }
+	limits := &model.PublishLimits{MonthlyMessages: 3}
+	l.SetLimits(id.String(), limits)
+	require.NoError(t, l.Allow(id.String(), 1))
+	require.NoError(t, l.Allow(id.String(), 1))
+	require.NoError(t, l.Flush())
+
+	// Another instance picks up the stored usage
+	other := ratelimit.NewLimiter(store)
+	other.Now = l.Now
+	other.SetLimits(id.String(), limits)
+	require.NoError(t, other.Allow(id.String(), 1))
+	var limitErr *ratelimit.LimitError
+	err := other.Allow(id.String(), 1)
+	require.True(t, errors.As(err, &limitErr), "got %v", err)
+	require.ErrorIs(t, err, ratelimit.ErrQuotaExceeded)
+	require.Equal(t, time.Hour, limitErr.RetryAfter, "until the next month")
+
+	usage, err := other.Usage(id.String())
+	require.NoError(t, err)
+	require.Equal(t, int64(3), usage.Messages)
+
+	// The first instance sees it after the next flushes
+	require.NoError(t, other.Flush())
+	require.NoError(t, l.Flush())
+	require.ErrorIs(t, l.Allow(id.String(), 1), ratelimit.ErrQuotaExceeded)
+
+	now = now.Add(time.Hour)
+	require.NoError(t, other.Allow(id.String(), 1))
+}
+
+type failingBroker struct {
+	messaging.Broker
+}
+
+func (failingBroker) Publish(string, []byte, ...messaging.PublishOption) error {
+	return messaging.ErrQueueFull
+}
+
+func TestBrokerRefundsFailedPublish(t *testing.T) {
+	store := storage.NewMemoryStore()
+	id := uuid.New()
+	require.NoError(t, store.CreateTenant(id))
+
+	l := ratelimit.NewLimiter(store)
+	now := time.Date(2024, time.March, 10, 12, 0, 0, 0, time.UTC)
+	l.Now = func() time.Time { return now }
+	l.SetLimits(id.String(), &model.PublishLimits{MessagesPerSecond: 1, MonthlyMessages: 1})
+
+	// The refused publish leaves the token and quota to the next one
+	b := ratelimit.NewBroker(failingBroker{}, l)
+	require.ErrorIs(t, b.Publish(id.String(), []byte(`{}`)), messaging.ErrQueueFull)
+	require.NoError(t, l.Allow(id.String(), 2))
+
+	// A publish already flushed is taken back from the store
+	now = now.Add(time.Second)
+	l.SetLimits(id.String(), &model.PublishLimits{MonthlyMessages: 2})
+	res, err := l.Reserve(id.String(), 2)
+	require.NoError(t, err)
+	require.NoError(t, l.Flush())
+	res.Cancel()
+	res.Cancel()
+	require.NoError(t, l.Flush())
+
+	usage, err := l.Usage(id.String())
+	require.NoError(t, err)
+	require.Equal(t, int64(1), usage.Messages)
+	require.Equal(t, int64(2), usage.Bytes)
+}
@@ -0,0 +1,150 @@
+// internal/scheduler/scheduler.go
+
+// Package scheduler provides delayed delivery on top of any Broker by
+// holding messages in the store until they are due.
+package scheduler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+const (
+	DefaultPollInterval = time.Second
+	// claimBatch and claimLease bound one round of publishing; a message
+	// not published within the lease is claimed again
+	claimBatch = 100
+	claimLease = 30 * time.Second
+)
+
+// Scheduler decorates a Broker: publishes with a future DeliverAt are
+// stored, and Run publishes them through the wrapped broker once due.
+// Several instances may poll the same store; claims keep them apart.
+type Scheduler struct {
+	messaging.Broker
+
+	store        storage.Store
+	PollInterval time.Duration
+}
+
+func New(b messaging.Broker, store storage.Store) *Scheduler {
+	return &Scheduler{
+		Broker:       b,
+		store:        store,
+		PollInterval: DefaultPollInterval,
+	}
+}
+
+// Publish schedules delayed messages and publishes the rest right away
+func (s *Scheduler) Publish(tenantID string, body []byte, opts ...messaging.PublishOption) error {
+	o := messaging.NewPublishOptions(opts...)
+	if !o.Delayed() || o.SourceTenant != "" {
+		return s.Broker.Publish(tenantID, body, opts...)
+	}
+
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return fmt.Errorf("invalid tenant ID %s: %w", tenantID, err)
+	}
+	_, err = s.Schedule(id, body, o)
+	return err
+}
+
+// Schedule stores a message for delivery at o.DeliverAt. Without a
+// message ID the scheduled ID is used, so a redelivery after a lost claim
+// is deduplicated like any retried publish.
+func (s *Scheduler) Schedule(tenantID uuid.UUID, body []byte, o messaging.PublishOptions) (*model.ScheduledMessage, error) {
+	if !json.Valid(body) {
+		return nil, errors.New("payload must be valid JSON")
+	}
+	id, err := uuid.NewV7()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate message ID: %w", err)
+	}
+
+	m := &model.ScheduledMessage{
+		ID:          id,
+		TenantID:    tenantID,
+		Payload:     body,
+		MessageID:   o.MessageID,
+		EventType:   o.EventType,
+		Priority:    o.Priority,
+		OrderingKey: o.OrderingKey,
+		DeliverAt:   o.DeliverAt.UTC(),
+	}
+	if m.MessageID == "" {
+		m.MessageID = id.String()
+	}
+	if err := s.store.ScheduleMessage(m); err != nil {
+		return nil, fmt.Errorf("failed to schedule message: %w", err)
+	}
+	return m, nil
+}
+
+// Run publishes due messages every PollInterval until ctx is cancelled
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.PollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.PublishDue()
+		}
+	}
+}
+
+// PublishDue publishes every message due now and returns how many
+func (s *Scheduler) PublishDue() int {
+	published := 0
+	for {
+		msgs, err := s.store.ClaimDueMessages(claimBatch, claimLease)
+		if err != nil {
+			log.Printf("[Scheduler] Failed to claim due messages: %v", err)
+			return published
+		}
+
+		for _, m := range msgs {
+			if s.publish(m) {
+				published++
+			}
+		}
+		if len(msgs) < claimBatch {
+			return published
+		}
+	}
+}
+
+// publish sends one due message; on failure it stays claimed and is
+// retried when the lease runs out
+func (s *Scheduler) publish(m model.ScheduledMessage) bool {
+	err := s.Broker.Publish(m.TenantID.String(), m.Payload,
+		messaging.WithMessageID(m.MessageID),
+		messaging.WithEventType(m.EventType),
+		messaging.WithPriority(m.Priority),
+		messaging.WithOrderingKey(m.OrderingKey),
+	)
+	if errors.Is(err, messaging.ErrQueueNotFound) {
+		log.Printf("[Scheduler] Dropping message %s: tenant %s has no queue", m.ID, m.TenantID)
+	} else if err != nil {
+		log.Printf("[Scheduler] Failed to publish message %s, retrying in %s: %v", m.ID, claimLease, err)
+		return false
+	}
+
+	if err := s.store.CompleteScheduledMessage(m.ID); err != nil {
+		log.Printf("[Scheduler] Failed to complete message %s: %v", m.ID, err)
+	}
+	return err == nil
+}
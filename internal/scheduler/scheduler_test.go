@@ -0,0 +1,64 @@
+package scheduler_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/scheduler"
+	"multi-tenant/internal/storage"
+)
+
+func TestScheduler(t *testing.T) {
+	broker := messaging.NewMemoryBroker()
+	store := storage.NewMemoryStore()
+	s := scheduler.New(broker, store)
+
+	tenantID := uuid.New()
+	require.NoError(t, store.CreateTenant(tenantID))
+	require.NoError(t, s.DeclareQueue(tenantID.String(), messaging.QueueOptions{}))
+	depth := func() int {
+		n, err := s.QueueDepth(tenantID.String())
+		require.NoError(t, err)
+		return n
+	}
+
+	// Brokers refuse delayed messages on their own
+	require.ErrorIs(t, broker.Publish(tenantID.String(), []byte(`{}`), messaging.WithDelay(time.Hour)), messaging.ErrUnsupported)
+
+	// Undelayed messages pass straight through
+	require.NoError(t, s.Publish(tenantID.String(), []byte(`{"n":0}`)))
+	require.Equal(t, 1, depth())
+
+	require.NoError(t, s.Publish(tenantID.String(), []byte(`{"n":1}`), messaging.WithDelay(time.Hour)))
+	soon, err := s.Schedule(tenantID, []byte(`{"n":2}`), messaging.NewPublishOptions(
+		messaging.WithDeliverAt(time.Now().Add(50*time.Millisecond)),
+		messaging.WithEventType("reminder"),
+	))
+	require.NoError(t, err)
+	require.Equal(t, soon.ID.String(), soon.MessageID)
+	cancelled, err := s.Schedule(tenantID, []byte(`{"n":3}`), messaging.NewPublishOptions(messaging.WithDelay(time.Millisecond)))
+	require.NoError(t, err)
+	require.NoError(t, store.CancelScheduledMessage(tenantID, cancelled.ID))
+
+	require.Zero(t, s.PublishDue(), "nothing due yet")
+	time.Sleep(60 * time.Millisecond)
+	require.Equal(t, 1, s.PublishDue())
+	require.Equal(t, 2, depth())
+
+	sub, err := s.Consume(tenantID.String())
+	require.NoError(t, err)
+	defer sub.Cancel()
+	<-sub.Deliveries()
+	d := <-sub.Deliveries()
+	require.Equal(t, `{"n":2}`, string(d.Body))
+	require.Equal(t, soon.MessageID, d.MessageID)
+	require.Equal(t, messaging.RoutingKey(tenantID.String(), "reminder"), d.RoutingKey)
+
+	pending, err := store.ListScheduledMessages(tenantID)
+	require.NoError(t, err)
+	require.Len(t, pending, 1, "the hour-delayed message is still held")
+}
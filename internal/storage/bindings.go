@@ -0,0 +1,55 @@
+// internal/storage/bindings.go
+package storage
+
+import (
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+// AddBinding records an extra topic pattern for a tenant; adding an
+// existing pattern is a no-op
+func (s *Storage) AddBinding(tenantID uuid.UUID, pattern string) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO tenant_bindings (tenant_id, pattern) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, tenantID, pattern)
+	return err
+}
+
+// RemoveBinding deletes a tenant's topic pattern, or returns ErrNotFound
+func (s *Storage) RemoveBinding(tenantID uuid.UUID, pattern string) error {
+	res, err := s.DB.Exec(`DELETE FROM tenant_bindings WHERE tenant_id = $1 AND pattern = $2`, tenantID, pattern)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListBindings returns a tenant's extra topic patterns, oldest first
+func (s *Storage) ListBindings(tenantID uuid.UUID) ([]model.Binding, error) {
+	rows, err := s.DB.Query(`
+		SELECT tenant_id, pattern, created_at FROM tenant_bindings
+		WHERE tenant_id = $1
+		ORDER BY created_at, pattern
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	bindings := []model.Binding{}
+	for rows.Next() {
+		var b model.Binding
+		if err := rows.Scan(&b.TenantID, &b.Pattern, &b.CreatedAt); err != nil {
+			return nil, err
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
@@ -0,0 +1,108 @@
+// internal/storage/cursor.go
+package storage
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the decoded form of an opaque pagination cursor.
+// Message IDs are UUIDv7, so ordering by ID is chronological.
+// Search cursors additionally carry the relevance rank of the boundary row.
+type Cursor struct {
+	ID       uuid.UUID `json:"id"`
+	Order    SortOrder `json:"o"`
+	Rank     *float64  `json:"r,omitempty"`
+	Backward bool      `json:"b,omitempty"`
+}
+
+// Encode returns the opaque, URL-safe form of the cursor
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a cursor produced by Cursor.Encode
+func DecodeCursor(s string) (Cursor, error) {
+	var c Cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return c, ErrInvalidCursor
+	}
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == uuid.Nil {
+		return c, ErrInvalidCursor
+	}
+	if c.Order, err = ParseSortOrder(string(c.Order)); err != nil {
+		return c, ErrInvalidCursor
+	}
+	return c, nil
+}
+
+// MessagePage is one page of a cursor-paginated listing.
+// HasMore reports whether further messages exist in the direction the
+// page was fetched (forwards for NextCursor, backwards for PrevCursor).
+type MessagePage struct {
+	Messages   []model.Message `json:"data"`
+	NextCursor string          `json:"next_cursor"`
+	PrevCursor string          `json:"prev_cursor"`
+	HasMore    bool            `json:"has_more"`
+}
+
+// newMessagePage builds the page and its cursors from rows fetched with
+// limit+1, in scan order. Backward pages are scanned in reverse and are
+// flipped back into display order here. ranks is nil unless the rows were
+// ordered by relevance, in which case it holds one rank per row.
+func newMessagePage(rows []model.Message, ranks []float64, limit int, order SortOrder, cur *Cursor) *MessagePage {
+	backward := cur != nil && cur.Backward
+
+	page := &MessagePage{HasMore: len(rows) > limit}
+	if page.HasMore {
+		rows = rows[:limit]
+		if ranks != nil {
+			ranks = ranks[:limit]
+		}
+	}
+	if backward {
+		for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+			rows[i], rows[j] = rows[j], rows[i]
+			if ranks != nil {
+				ranks[i], ranks[j] = ranks[j], ranks[i]
+			}
+		}
+	}
+	page.Messages = rows
+	if len(rows) == 0 {
+		return page
+	}
+
+	boundary := func(i int, backward bool) string {
+		c := Cursor{ID: rows[i].ID, Order: order, Backward: backward}
+		if ranks != nil {
+			c.Rank = &ranks[i]
+		}
+		return c.Encode()
+	}
+
+	first, last := 0, len(rows)-1
+	if backward {
+		if page.HasMore {
+			page.PrevCursor = boundary(first, true)
+		}
+		page.NextCursor = boundary(last, false)
+	} else {
+		if page.HasMore {
+			page.NextCursor = boundary(last, false)
+		}
+		if cur != nil {
+			page.PrevCursor = boundary(first, true)
+		}
+	}
+	return page
+}
@@ -0,0 +1,55 @@
+// internal/storage/filter.go
+package storage
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	DefaultPageSize = 10
+	MaxPageSize     = 100
+)
+
+// SortOrder is the direction messages are listed in
+type SortOrder string
+
+const (
+	SortAsc  SortOrder = "asc"
+	SortDesc SortOrder = "desc"
+)
+
+// ParseSortOrder validates a sort direction, defaulting to ascending
+func ParseSortOrder(s string) (SortOrder, error) {
+	switch SortOrder(s) {
+	case "", SortAsc:
+		return SortAsc, nil
+	case SortDesc:
+		return SortDesc, nil
+	default:
+		return "", fmt.Errorf("invalid sort order %q", s)
+	}
+}
+
+// MessageFilter narrows a message listing.
+// Zero values mean "no constraint"; Payload entries are matched as string
+// values of top-level JSON fields.
+type MessageFilter struct {
+	From    time.Time // inclusive lower bound on created_at
+	To      time.Time // exclusive upper bound on created_at
+	Limit   int
+	Order   SortOrder
+	Payload map[string]string
+}
+
+// PageSize returns the effective limit, bounded to [1, MaxPageSize]
+func (f MessageFilter) PageSize() int {
+	switch {
+	case f.Limit <= 0:
+		return DefaultPageSize
+	case f.Limit > MaxPageSize:
+		return MaxPageSize
+	default:
+		return f.Limit
+	}
+}
@@ -0,0 +1,143 @@
+// internal/storage/isolation.go
+package storage
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/metrics"
+	"multi-tenant/internal/model"
+)
+
+// IsolatedStore decorates a Store so one busy tenant cannot take every
+// database connection. Message and scheduled-message operations hold a
+// slot of their tenant's semaphore and, with a pool size, of a shared one
+// sized to the pool minus the reserved connections; the reserved
+// connections stay free for tenant management, the scheduler and usage
+// accounting. How long each
+// operation waited is exported per tenant as db_wait_seconds.
+type IsolatedStore struct {
+	Store
+
+	shared    chan struct{} // nil without a pool size
+	perTenant int
+
+	mu      sync.Mutex
+	tenants map[uuid.UUID]chan struct{}
+}
+
+// NewIsolatedStore limits tenant operations on s to poolSize-reserved at a
+// time, at least one, and perTenant at a time for each tenant. poolSize
+// <= 0 leaves out the shared limit and perTenant <= 0 the per-tenant one.
+func NewIsolatedStore(s Store, poolSize, reserved, perTenant int) *IsolatedStore {
+	is := &IsolatedStore{
+		Store:     s,
+		perTenant: perTenant,
+		tenants:   make(map[uuid.UUID]chan struct{}),
+	}
+	if poolSize > 0 {
+		is.shared = make(chan struct{}, max(poolSize-reserved, 1))
+	}
+	return is
+}
+
+// acquire blocks until the tenant may run a database operation and
+// returns the function that ends it
+func (s *IsolatedStore) acquire(tenantID uuid.UUID) func() {
+	start := time.Now()
+	sem := s.semaphore(tenantID)
+	if sem != nil {
+		sem <- struct{}{}
+	}
+	if s.shared != nil {
+		s.shared <- struct{}{}
+	}
+	metrics.DBWait.WithLabelValues(tenantID.String()).Observe(time.Since(start).Seconds())
+
+	return func() {
+		if s.shared != nil {
+			<-s.shared
+		}
+		if sem != nil {
+			<-sem
+		}
+	}
+}
+
+func (s *IsolatedStore) semaphore(tenantID uuid.UUID) chan struct{} {
+	if s.perTenant <= 0 {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sem, ok := s.tenants[tenantID]
+	if !ok {
+		sem = make(chan struct{}, s.perTenant)
+		s.tenants[tenantID] = sem
+	}
+	return sem
+}
+
+// DeleteTenant also forgets the tenant's semaphore; operations still
+// holding it release the one they acquired
+func (s *IsolatedStore) DeleteTenant(id uuid.UUID) error {
+	if err := s.Store.DeleteTenant(id); err != nil {
+		return err
+	}
+	s.mu.Lock()
+	delete(s.tenants, id)
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *IsolatedStore) ScheduleMessage(m *model.ScheduledMessage) error {
+	defer s.acquire(m.TenantID)()
+	return s.Store.ScheduleMessage(m)
+}
+
+func (s *IsolatedStore) ListScheduledMessages(tenantID uuid.UUID) ([]model.ScheduledMessage, error) {
+	defer s.acquire(tenantID)()
+	return s.Store.ListScheduledMessages(tenantID)
+}
+
+func (s *IsolatedStore) CancelScheduledMessage(tenantID, id uuid.UUID) error {
+	defer s.acquire(tenantID)()
+	return s.Store.CancelScheduledMessage(tenantID, id)
+}
+
+func (s *IsolatedStore) InsertMessage(m *model.Message) error {
+	defer s.acquire(m.TenantID)()
+	return s.Store.InsertMessage(m)
+}
+
+// InsertMessages counts the batch against the tenant of its first
+// message; batches never mix tenants
+func (s *IsolatedStore) InsertMessages(msgs []*model.Message) (int, error) {
+	if len(msgs) == 0 {
+		return s.Store.InsertMessages(msgs)
+	}
+	defer s.acquire(msgs[0].TenantID)()
+	return s.Store.InsertMessages(msgs)
+}
+
+func (s *IsolatedStore) GetMessage(tenantID, id uuid.UUID) (*model.Message, error) {
+	defer s.acquire(tenantID)()
+	return s.Store.GetMessage(tenantID, id)
+}
+
+func (s *IsolatedStore) ListMessagesPaginated(tenantID uuid.UUID, cursor string, filter MessageFilter) (*MessagePage, error) {
+	defer s.acquire(tenantID)()
+	return s.Store.ListMessagesPaginated(tenantID, cursor, filter)
+}
+
+func (s *IsolatedStore) SearchMessages(tenantID uuid.UUID, cursor string, q SearchQuery) (*MessagePage, error) {
+	defer s.acquire(tenantID)()
+	return s.Store.SearchMessages(tenantID, cursor, q)
+}
+
+func (s *IsolatedStore) DeleteMessagesBefore(tenantID uuid.UUID, before time.Time) (int64, error) {
+	defer s.acquire(tenantID)()
+	return s.Store.DeleteMessagesBefore(tenantID, before)
+}
@@ -0,0 +1,82 @@
+package storage_test
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+	"multi-tenant/internal/storage/storagetest"
+)
+
+func TestIsolatedStore(t *testing.T) {
+	storagetest.Run(t, storage.NewIsolatedStore(storage.NewMemoryStore(), 4, 1, 2))
+}
+
+// blockingStore holds every InsertMessage until release is closed
+type blockingStore struct {
+	*storage.MemoryStore
+
+	release chan struct{}
+	entered atomic.Int32
+}
+
+func (s *blockingStore) InsertMessage(m *model.Message) error {
+	s.entered.Add(1)
+	<-s.release
+	return s.MemoryStore.InsertMessage(m)
+}
+
+func TestIsolatedStoreLimits(t *testing.T) {
+	busy, quiet := uuid.New(), uuid.New()
+
+	cases := []struct {
+		name                      string
+		poolSize, reserved, limit int
+		// tenants of the inserts, started in order
+		tenants []uuid.UUID
+		// inserts that get through before any is released
+		want int32
+	}{
+		{"per tenant", 10, 2, 2, []uuid.UUID{busy, busy, busy, quiet}, 3},
+		{"shared", 4, 1, 0, []uuid.UUID{busy, busy, busy, busy, quiet}, 3},
+		{"per tenant without a pool", 0, 0, 2, []uuid.UUID{busy, busy, busy, quiet, quiet}, 4},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			inner := &blockingStore{MemoryStore: storage.NewMemoryStore(), release: make(chan struct{})}
+			s := storage.NewIsolatedStore(inner, tc.poolSize, tc.reserved, tc.limit)
+			for _, id := range []uuid.UUID{busy, quiet} {
+				require.NoError(t, s.CreateTenant(id))
+				require.NoError(t, s.EnsurePartition(id))
+			}
+
+			var wg sync.WaitGroup
+			for _, id := range tc.tenants {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					require.NoError(t, s.InsertMessage(&model.Message{ID: uuid.New(), TenantID: id, Payload: []byte(`{}`)}))
+				}()
+			}
+
+			require.Eventually(t, func() bool { return inner.entered.Load() == tc.want },
+				time.Second, time.Millisecond)
+			time.Sleep(20 * time.Millisecond)
+			require.Equal(t, tc.want, inner.entered.Load())
+
+			// tenant management runs on the reserved connections
+			_, err := s.ListTenants()
+			require.NoError(t, err)
+
+			close(inner.release)
+			wg.Wait()
+			require.EqualValues(t, len(tc.tenants), inner.entered.Load())
+		})
+	}
+}
@@ -0,0 +1,515 @@
+// internal/storage/jsonpath.go
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// jsonPath is the subset of SQL/JSON path that MemoryStore evaluates for
+// the @? operator, in lax mode: member (.key, ."key", .*) and array ([*],
+// [n]) accessors, and filters ? (...) using ==, !=, <>, <, <=, >, >=, &&,
+// ||, !, exists(...) and string, number, boolean and null literals.
+type jsonPath struct {
+	relative bool // starts at @ instead of $
+	steps    []pathStep
+}
+
+type stepKind int
+
+const (
+	stepMember stepKind = iota
+	stepAnyMember
+	stepAnyIndex
+	stepIndex
+	stepFilter
+)
+
+type pathStep struct {
+	kind   stepKind
+	key    string
+	index  int
+	filter predicate
+}
+
+type predicate interface {
+	eval(root, current interface{}) bool
+}
+
+// compileJSONPath parses a path expression, reporting unsupported syntax
+// as ErrInvalidQuery
+func compileJSONPath(expr string) (*jsonPath, error) {
+	p := &pathParser{toks: tokenizePath(expr)}
+	p.accept("lax")
+	if p.accept("strict") {
+		return nil, fmt.Errorf("%w: strict mode is not supported", ErrInvalidQuery)
+	}
+	path, err := p.parsePath()
+	if err == nil && !p.done() {
+		err = fmt.Errorf("unexpected %q", p.peek())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidQuery, err)
+	}
+	if path.relative {
+		return nil, fmt.Errorf("%w: @ is only valid inside a filter", ErrInvalidQuery)
+	}
+	return path, nil
+}
+
+// exists reports whether the path yields any item for doc (the @? operator)
+func (jp *jsonPath) exists(doc interface{}) bool {
+	return len(jp.eval(doc, doc)) > 0
+}
+
+func (jp *jsonPath) eval(root, current interface{}) []interface{} {
+	items := []interface{}{root}
+	if jp.relative {
+		items = []interface{}{current}
+	}
+
+	for _, step := range jp.steps {
+		var next []interface{}
+		for _, item := range items {
+			next = append(next, step.apply(root, item)...)
+		}
+		items = next
+	}
+	return items
+}
+
+func (s pathStep) apply(root, item interface{}) []interface{} {
+	switch s.kind {
+	case stepMember, stepAnyMember:
+		// Lax mode unwraps arrays before member access
+		if arr, ok := item.([]interface{}); ok {
+			var out []interface{}
+			for _, el := range arr {
+				out = append(out, s.apply(root, el)...)
+			}
+			return out
+		}
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		if s.kind == stepMember {
+			if v, ok := obj[s.key]; ok {
+				return []interface{}{v}
+			}
+			return nil
+		}
+		out := make([]interface{}, 0, len(obj))
+		for _, v := range obj {
+			out = append(out, v)
+		}
+		return out
+
+	case stepAnyIndex:
+		if arr, ok := item.([]interface{}); ok {
+			return arr
+		}
+		return []interface{}{item}
+
+	case stepIndex:
+		arr, ok := item.([]interface{})
+		if !ok {
+			// Lax mode treats a scalar as a one-element array
+			if s.index == 0 {
+				return []interface{}{item}
+			}
+			return nil
+		}
+		if s.index >= 0 && s.index < len(arr) {
+			return []interface{}{arr[s.index]}
+		}
+		return nil
+
+	case stepFilter:
+		candidates := []interface{}{item}
+		if arr, ok := item.([]interface{}); ok {
+			candidates = arr
+		}
+		var out []interface{}
+		for _, c := range candidates {
+			if s.filter.eval(root, c) {
+				out = append(out, c)
+			}
+		}
+		return out
+	}
+	return nil
+}
+
+// Predicates
+
+type orPred struct{ left, right predicate }
+type andPred struct{ left, right predicate }
+type notPred struct{ inner predicate }
+type existsPred struct{ path *jsonPath }
+
+type comparePred struct {
+	op          string
+	left, right operand
+}
+
+// operand is either a path or a literal
+type operand struct {
+	path    *jsonPath
+	literal interface{}
+}
+
+func (p orPred) eval(root, cur interface{}) bool {
+	return p.left.eval(root, cur) || p.right.eval(root, cur)
+}
+func (p andPred) eval(root, cur interface{}) bool {
+	return p.left.eval(root, cur) && p.right.eval(root, cur)
+}
+func (p notPred) eval(root, cur interface{}) bool {
+	return !p.inner.eval(root, cur)
+}
+func (p existsPred) eval(root, cur interface{}) bool {
+	return len(p.path.eval(root, cur)) > 0
+}
+
+func (o operand) items(root, cur interface{}) []interface{} {
+	if o.path == nil {
+		return []interface{}{o.literal}
+	}
+	var out []interface{}
+	for _, v := range o.path.eval(root, cur) {
+		if arr, ok := v.([]interface{}); ok {
+			out = append(out, arr...)
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// eval is true if any pair of left and right items satisfies the operator
+func (p comparePred) eval(root, cur interface{}) bool {
+	for _, l := range p.left.items(root, cur) {
+		for _, r := range p.right.items(root, cur) {
+			if compareJSON(p.op, l, r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func compareJSON(op string, l, r interface{}) bool {
+	var c int
+	switch lv := l.(type) {
+	case float64:
+		rv, ok := r.(float64)
+		if !ok {
+			return false
+		}
+		switch {
+		case lv < rv:
+			c = -1
+		case lv > rv:
+			c = 1
+		}
+	case string:
+		rv, ok := r.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(lv, rv)
+	case bool:
+		rv, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return false
+		}
+		if lv != rv {
+			c = 1
+		}
+	case nil:
+		if r != nil || (op != "==" && op != "!=") {
+			return false
+		}
+	default:
+		// Objects and arrays are not comparable
+		return false
+	}
+
+	switch op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+// Parser
+
+type pathParser struct {
+	toks []string
+	pos  int
+}
+
+func (p *pathParser) done() bool { return p.pos >= len(p.toks) }
+
+func (p *pathParser) peek() string {
+	if p.done() {
+		return ""
+	}
+	return p.toks[p.pos]
+}
+
+func (p *pathParser) next() string {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *pathParser) accept(tok string) bool {
+	if p.peek() == tok {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) expect(tok string) error {
+	if !p.accept(tok) {
+		return fmt.Errorf("expected %q, got %q", tok, p.peek())
+	}
+	return nil
+}
+
+func (p *pathParser) parsePath() (*jsonPath, error) {
+	path := &jsonPath{}
+	switch p.next() {
+	case "$":
+	case "@":
+		path.relative = true
+	default:
+		return nil, fmt.Errorf("path must start with $ or @")
+	}
+
+	for !p.done() {
+		switch p.peek() {
+		case ".":
+			p.next()
+			key := p.next()
+			switch {
+			case key == "*":
+				path.steps = append(path.steps, pathStep{kind: stepAnyMember})
+			case strings.HasPrefix(key, `"`):
+				s, err := strconv.Unquote(key)
+				if err != nil {
+					return nil, fmt.Errorf("invalid key %s", key)
+				}
+				path.steps = append(path.steps, pathStep{kind: stepMember, key: s})
+			case isIdent(key):
+				path.steps = append(path.steps, pathStep{kind: stepMember, key: key})
+			default:
+				return nil, fmt.Errorf("invalid key %q", key)
+			}
+		case "[":
+			p.next()
+			if p.accept("*") {
+				path.steps = append(path.steps, pathStep{kind: stepAnyIndex})
+			} else {
+				n, err := strconv.Atoi(p.next())
+				if err != nil {
+					return nil, fmt.Errorf("unsupported array subscript")
+				}
+				path.steps = append(path.steps, pathStep{kind: stepIndex, index: n})
+			}
+			if err := p.expect("]"); err != nil {
+				return nil, err
+			}
+		case "?":
+			p.next()
+			if err := p.expect("("); err != nil {
+				return nil, err
+			}
+			pred, err := p.parseOr()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(")"); err != nil {
+				return nil, err
+			}
+			path.steps = append(path.steps, pathStep{kind: stepFilter, filter: pred})
+		default:
+			return path, nil
+		}
+	}
+	return path, nil
+}
+
+func (p *pathParser) parseOr() (predicate, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("||") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orPred{left, right}
+	}
+	return left, nil
+}
+
+func (p *pathParser) parseAnd() (predicate, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("&&") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = andPred{left, right}
+	}
+	return left, nil
+}
+
+func (p *pathParser) parseNot() (predicate, error) {
+	if p.accept("!") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notPred{inner}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *pathParser) parsePrimary() (predicate, error) {
+	if p.accept("(") {
+		pred, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return pred, p.expect(")")
+	}
+	if p.accept("exists") {
+		if err := p.expect("("); err != nil {
+			return nil, err
+		}
+		path, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return existsPred{path}, p.expect(")")
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	switch op {
+	case "==", "!=", "<", "<=", ">", ">=":
+	case "<>":
+		op = "!="
+	default:
+		return nil, fmt.Errorf("unsupported operator %q", op)
+	}
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return comparePred{op: op, left: left, right: right}, nil
+}
+
+func (p *pathParser) parseOperand() (operand, error) {
+	switch tok := p.peek(); {
+	case tok == "$" || tok == "@":
+		path, err := p.parsePath()
+		return operand{path: path}, err
+	case tok == "true", tok == "false", tok == "null", strings.HasPrefix(tok, `"`),
+		tok != "" && (tok[0] == '-' || unicode.IsDigit(rune(tok[0]))):
+		p.next()
+		var v interface{}
+		if err := json.Unmarshal([]byte(tok), &v); err != nil {
+			return operand{}, fmt.Errorf("invalid literal %s", tok)
+		}
+		return operand{literal: v}, nil
+	default:
+		return operand{}, fmt.Errorf("unexpected %q", tok)
+	}
+}
+
+func isIdent(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i, r := range s {
+		if !(r == '_' || unicode.IsLetter(r) || (i > 0 && unicode.IsDigit(r))) {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenizePath splits a path expression into tokens; an unterminated
+// string is returned as-is and rejected by the parser
+func tokenizePath(s string) []string {
+	var toks []string
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			i++
+		case c == '"':
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j < len(s) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		case strings.HasPrefix(s[i:], "=="), strings.HasPrefix(s[i:], "!="), strings.HasPrefix(s[i:], "<>"),
+			strings.HasPrefix(s[i:], "<="), strings.HasPrefix(s[i:], ">="),
+			strings.HasPrefix(s[i:], "&&"), strings.HasPrefix(s[i:], "||"):
+			toks = append(toks, s[i:i+2])
+			i += 2
+		case c == '-' || (c >= '0' && c <= '9'):
+			j := i + 1
+			for j < len(s) && (s[j] == '.' || s[j] == 'e' || s[j] == 'E' || s[j] == '+' || s[j] == '-' || (s[j] >= '0' && s[j] <= '9')) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)) || c >= 0x80:
+			j := i + 1
+			for j < len(s) && (s[j] == '_' || s[j] >= 0x80 || unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j]))) {
+				j++
+			}
+			toks = append(toks, s[i:j])
+			i = j
+		default:
+			toks = append(toks, s[i:i+1])
+			i++
+		}
+	}
+	return toks
+}
@@ -0,0 +1,745 @@
+// internal/storage/memory.go
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+// MemoryStore is an in-process Store for tests and local development.
+// Pagination and filtering match Storage exactly; full-text relevance is
+// approximated by term frequency and JSONPath supports the subset
+// described on jsonPath.
+type MemoryStore struct {
+	// DedupWindow is how long an idempotency key suppresses duplicates
+	DedupWindow time.Duration
+
+	mu         sync.RWMutex
+	tenants    map[uuid.UUID]*model.Tenant
+	partitions map[uuid.UUID][]model.Message // sorted by ID
+	dedup      map[dedupKey]time.Time
+	bindings   map[uuid.UUID][]model.Binding // oldest first
+	subs       []*model.Subscription         // oldest first
+	scheduled  map[uuid.UUID]*scheduledEntry
+	usage      map[usageKey]model.PublishUsage
+	ledger     map[ledgerKey]model.Usage
+}
+
+type scheduledEntry struct {
+	model.ScheduledMessage
+	claimedUntil time.Time
+}
+
+type dedupKey struct {
+	tenantID uuid.UUID
+	key      string
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		tenants:    make(map[uuid.UUID]*model.Tenant),
+		partitions: make(map[uuid.UUID][]model.Message),
+		dedup:      make(map[dedupKey]time.Time),
+		bindings:   make(map[uuid.UUID][]model.Binding),
+		scheduled:  make(map[uuid.UUID]*scheduledEntry),
+		usage:      make(map[usageKey]model.PublishUsage),
+		ledger:     make(map[ledgerKey]model.Usage),
+	}
+}
+
+func (s *MemoryStore) CreateTenant(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.tenants[id]; !ok {
+		s.tenants[id] = &model.Tenant{ID: id, Concurrency: 5, CreatedAt: time.Now().UTC()}
+	}
+	return nil
+}
+
+func (s *MemoryStore) GetTenant(id uuid.UUID) (*model.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, ok := s.tenants[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	cp := *t
+	return &cp, nil
+}
+
+func (s *MemoryStore) DeleteTenant(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.tenants, id)
+	delete(s.bindings, id)
+	subs := s.subs[:0]
+	for _, sub := range s.subs {
+		if sub.SourceTenantID != id && sub.TargetTenantID != id {
+			subs = append(subs, sub)
+		}
+	}
+	s.subs = subs
+	for sid, e := range s.scheduled {
+		if e.TenantID == id {
+			delete(s.scheduled, sid)
+		}
+	}
+	for k := range s.usage {
+		if k.tenantID == id {
+			delete(s.usage, k)
+		}
+	}
+	return nil
+}
+
+func (s *MemoryStore) ListTenants() ([]model.Tenant, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	tenants := make([]model.Tenant, 0, len(s.tenants))
+	for _, t := range s.tenants {
+		tenants = append(tenants, *t)
+	}
+	return tenants, nil
+}
+
+func (s *MemoryStore) UpdateTenantSettings(id uuid.UUID, settings model.TenantSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	t, ok := s.tenants[id]
+	if !ok {
+		return ErrNotFound
+	}
+	t.Settings = settings
+	return nil
+}
+
+func (s *MemoryStore) UpdateTenantConcurrency(tenantID string, workers int) error {
+	id, err := uuid.Parse(tenantID)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tenants[id]; ok {
+		t.Concurrency = workers
+	}
+	return nil
+}
+
+func (s *MemoryStore) AddBinding(tenantID uuid.UUID, pattern string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, b := range s.bindings[tenantID] {
+		if b.Pattern == pattern {
+			return nil
+		}
+	}
+	s.bindings[tenantID] = append(s.bindings[tenantID], model.Binding{
+		TenantID:  tenantID,
+		Pattern:   pattern,
+		CreatedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+func (s *MemoryStore) RemoveBinding(tenantID uuid.UUID, pattern string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	bindings := s.bindings[tenantID]
+	for i, b := range bindings {
+		if b.Pattern == pattern {
+			s.bindings[tenantID] = append(bindings[:i:i], bindings[i+1:]...)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ListBindings(tenantID uuid.UUID) ([]model.Binding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]model.Binding{}, s.bindings[tenantID]...), nil
+}
+
+func (s *MemoryStore) CreateSubscription(sub *model.Subscription) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, existing := range s.subs {
+		if existing.ID == sub.ID {
+			return fmt.Errorf("duplicate subscription %s", sub.ID)
+		}
+	}
+	now := time.Now().UTC()
+	sub.CreatedAt, sub.UpdatedAt = now, now
+	cp := *sub
+	s.subs = append(s.subs, &cp)
+	return nil
+}
+
+func (s *MemoryStore) GetSubscription(id uuid.UUID) (*model.Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, sub := range s.subs {
+		if sub.ID == id {
+			cp := *sub
+			return &cp, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (s *MemoryStore) ListSubscriptions(tenantID uuid.UUID) ([]model.Subscription, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	subs := []model.Subscription{}
+	for _, sub := range s.subs {
+		if sub.SourceTenantID == tenantID || sub.TargetTenantID == tenantID {
+			subs = append(subs, *sub)
+		}
+	}
+	return subs, nil
+}
+
+func (s *MemoryStore) UpdateSubscriptionStatus(id uuid.UUID, status string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, sub := range s.subs {
+		if sub.ID == id {
+			sub.Status = status
+			sub.UpdatedAt = time.Now().UTC()
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (s *MemoryStore) ScheduleMessage(m *model.ScheduledMessage) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.scheduled[m.ID]; ok {
+		return fmt.Errorf("duplicate scheduled message %s", m.ID)
+	}
+	if !json.Valid(m.Payload) {
+		return fmt.Errorf("scheduled message %s: invalid JSON payload", m.ID)
+	}
+	m.CreatedAt = time.Now().UTC()
+	s.scheduled[m.ID] = &scheduledEntry{ScheduledMessage: *m}
+	return nil
+}
+
+func (s *MemoryStore) ListScheduledMessages(tenantID uuid.UUID) ([]model.ScheduledMessage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	msgs := []model.ScheduledMessage{}
+	for _, e := range s.scheduled {
+		if e.TenantID == tenantID {
+			msgs = append(msgs, e.ScheduledMessage)
+		}
+	}
+	sortScheduled(msgs)
+	return msgs, nil
+}
+
+func (s *MemoryStore) CancelScheduledMessage(tenantID, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.scheduled[id]
+	if !ok || e.TenantID != tenantID {
+		return ErrNotFound
+	}
+	delete(s.scheduled, id)
+	return nil
+}
+
+func (s *MemoryStore) ClaimDueMessages(limit int, lease time.Duration) ([]model.ScheduledMessage, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*scheduledEntry
+	for _, e := range s.scheduled {
+		if !e.DeliverAt.After(now) && !e.claimedUntil.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].DeliverAt.Before(due[j].DeliverAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	msgs := make([]model.ScheduledMessage, len(due))
+	for i, e := range due {
+		e.claimedUntil = now.Add(lease)
+		msgs[i] = e.ScheduledMessage
+	}
+	return msgs, nil
+}
+
+func (s *MemoryStore) CompleteScheduledMessage(id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.scheduled, id)
+	return nil
+}
+
+func sortScheduled(msgs []model.ScheduledMessage) {
+	sort.Slice(msgs, func(i, j int) bool {
+		if !msgs[i].DeliverAt.Equal(msgs[j].DeliverAt) {
+			return msgs[i].DeliverAt.Before(msgs[j].DeliverAt)
+		}
+		return bytes.Compare(msgs[i].ID[:], msgs[j].ID[:]) < 0
+	})
+}
+
+func (s *MemoryStore) EnsurePartition(tenantID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.partitions[tenantID]; !ok {
+		s.partitions[tenantID] = nil
+	}
+	return nil
+}
+
+func (s *MemoryStore) InsertMessage(m *model.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.checkInsert([]*model.Message{m}); err != nil {
+		return err
+	}
+	s.insert(m, time.Now().UTC())
+	return nil
+}
+
+func (s *MemoryStore) InsertMessages(msgs []*model.Message) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Validate first so a failing batch leaves no trace, like the
+	// transaction in Storage
+	if err := s.checkInsert(msgs); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UTC()
+	window := s.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	stored := 0
+	for _, m := range msgs {
+		if m.IdempotencyKey != "" {
+			k := dedupKey{m.TenantID, m.IdempotencyKey}
+			if seen, ok := s.dedup[k]; ok && !seen.Before(now.Add(-window)) {
+				continue
+			}
+			s.dedup[k] = now
+		}
+		s.insert(m, now)
+		s.addUsage(m.TenantID, now, model.Usage{Processed: 1, BytesStored: int64(len(m.Payload))})
+		stored++
+	}
+	return stored, nil
+}
+
+// checkInsert rejects messages without a partition or with a taken ID.
+// Callers must hold s.mu.
+func (s *MemoryStore) checkInsert(msgs []*model.Message) error {
+	ids := make(map[uuid.UUID]bool, len(msgs))
+	for _, m := range msgs {
+		part, ok := s.partitions[m.TenantID]
+		if !ok {
+			return fmt.Errorf("no partition for tenant %s", m.TenantID)
+		}
+		if !json.Valid(m.Payload) {
+			return fmt.Errorf("invalid JSON payload for message %s", m.ID)
+		}
+		i := sort.Search(len(part), func(i int) bool { return bytes.Compare(part[i].ID[:], m.ID[:]) >= 0 })
+		if (i < len(part) && part[i].ID == m.ID) || ids[m.ID] {
+			return fmt.Errorf("duplicate message id %s", m.ID)
+		}
+		ids[m.ID] = true
+	}
+	return nil
+}
+
+// insert stores a copy of m in ID order. Callers must hold s.mu.
+func (s *MemoryStore) insert(m *model.Message, storedAt time.Time) {
+	cp := *m
+	cp.Payload = append(json.RawMessage(nil), m.Payload...)
+	cp.IdempotencyKey = ""
+	cp.StoredAt = &storedAt
+	if _, ok := marshalHeaders(m); !ok {
+		cp.Headers = nil
+	}
+
+	part := s.partitions[m.TenantID]
+	i := sort.Search(len(part), func(i int) bool { return bytes.Compare(part[i].ID[:], m.ID[:]) >= 0 })
+	part = append(part, model.Message{})
+	copy(part[i+1:], part[i:])
+	part[i] = cp
+	s.partitions[m.TenantID] = part
+}
+
+func (s *MemoryStore) GetMessage(tenantID, id uuid.UUID) (*model.Message, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	part := s.partitions[tenantID]
+	i := sort.Search(len(part), func(i int) bool { return bytes.Compare(part[i].ID[:], id[:]) >= 0 })
+	if i == len(part) || part[i].ID != id {
+		return nil, ErrNotFound
+	}
+	m := part[i]
+	return &m, nil
+}
+
+func (s *MemoryStore) ListMessagesPaginated(tenantID uuid.UUID, cursor string, filter MessageFilter) (*MessagePage, error) {
+	limit := filter.PageSize()
+
+	order := filter.Order
+	var cur *Cursor
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil || c.Rank != nil {
+			return nil, ErrInvalidCursor
+		}
+		cur = &c
+		order = c.Order
+	}
+
+	descending := order == SortDesc
+	if cur != nil && cur.Backward {
+		descending = !descending
+	}
+
+	match := func(m *model.Message) bool {
+		if !filter.From.IsZero() && m.CreatedAt.Before(filter.From) {
+			return false
+		}
+		if !filter.To.IsZero() && !m.CreatedAt.Before(filter.To) {
+			return false
+		}
+		if len(filter.Payload) > 0 {
+			var doc map[string]interface{}
+			if err := json.Unmarshal(m.Payload, &doc); err != nil {
+				return false
+			}
+			for k, v := range filter.Payload {
+				if s, ok := doc[k].(string); !ok || s != v {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	part := s.partitions[tenantID]
+	var rows []model.Message
+	for n := 0; n < len(part) && len(rows) <= limit; n++ {
+		m := &part[n]
+		if descending {
+			m = &part[len(part)-1-n]
+		}
+		if cur != nil {
+			c := bytes.Compare(m.ID[:], cur.ID[:])
+			if (descending && c >= 0) || (!descending && c <= 0) {
+				continue
+			}
+		}
+		if match(m) {
+			rows = append(rows, *m)
+		}
+	}
+
+	return newMessagePage(rows, nil, limit, order, cur), nil
+}
+
+func (s *MemoryStore) SearchMessages(tenantID uuid.UUID, cursor string, q SearchQuery) (*MessagePage, error) {
+	if q.Text == "" && q.JSONPath == "" {
+		return nil, fmt.Errorf("%w: text or jsonpath is required", ErrInvalidQuery)
+	}
+	limit := MessageFilter{Limit: q.Limit}.PageSize()
+
+	var path *jsonPath
+	if q.JSONPath != "" {
+		var err error
+		if path, err = compileJSONPath(q.JSONPath); err != nil {
+			return nil, err
+		}
+	}
+	var text textQuery
+	if q.Text != "" {
+		text = parseTextQuery(q.Text)
+	}
+
+	var cur *Cursor
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil || c.Order != SortDesc || c.Rank == nil {
+			return nil, ErrInvalidCursor
+		}
+		cur = &c
+	}
+
+	type hit struct {
+		msg  model.Message
+		rank float64
+	}
+
+	s.mu.RLock()
+	var hits []hit
+	for _, m := range s.partitions[tenantID] {
+		var doc interface{}
+		if err := json.Unmarshal(m.Payload, &doc); err != nil {
+			continue
+		}
+		if path != nil && !path.exists(doc) {
+			continue
+		}
+		rank := 0.0
+		if q.Text != "" {
+			var ok bool
+			if rank, ok = text.match(payloadTokens(doc)); !ok {
+				continue
+			}
+		}
+		hits = append(hits, hit{m, rank})
+	}
+	s.mu.RUnlock()
+
+	// (rank, id) descending; backward pages walk it ascending
+	less := func(a, b hit) bool {
+		if a.rank != b.rank {
+			return a.rank > b.rank
+		}
+		return bytes.Compare(a.msg.ID[:], b.msg.ID[:]) > 0
+	}
+	backward := cur != nil && cur.Backward
+	sort.Slice(hits, func(i, j int) bool {
+		if backward {
+			return less(hits[j], hits[i])
+		}
+		return less(hits[i], hits[j])
+	})
+
+	var rows []model.Message
+	var ranks []float64
+	for _, h := range hits {
+		if len(rows) > limit {
+			break
+		}
+		if cur != nil {
+			boundary := hit{model.Message{ID: cur.ID}, *cur.Rank}
+			if (!backward && !less(boundary, h)) || (backward && !less(h, boundary)) {
+				continue
+			}
+		}
+		rows = append(rows, h.msg)
+		ranks = append(ranks, h.rank)
+	}
+
+	return newMessagePage(rows, ranks, limit, SortDesc, cur), nil
+}
+
+func (s *MemoryStore) PruneDedup() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	window := s.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+	cutoff := time.Now().UTC().Add(-window)
+
+	var n int64
+	for k, seen := range s.dedup {
+		if seen.Before(cutoff) {
+			delete(s.dedup, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) DeleteMessagesBefore(tenantID uuid.UUID, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	part := s.partitions[tenantID]
+	kept := part[:0]
+	for _, m := range part {
+		if !m.CreatedAt.Before(before) {
+			kept = append(kept, m)
+		}
+	}
+	n := int64(len(part) - len(kept))
+	clear(part[len(kept):])
+	if _, ok := s.partitions[tenantID]; ok {
+		s.partitions[tenantID] = kept
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+// Full-text search
+
+// textQuery mirrors websearch_to_tsquery: terms are ANDed, "quoted text"
+// is a phrase, a leading - negates and the word "or" separates
+// alternatives.
+type textQuery [][]textTerm
+
+type textTerm struct {
+	words  []string
+	negate bool
+}
+
+func parseTextQuery(q string) textQuery {
+	var groups textQuery
+	var group []textTerm
+
+	for rest := strings.TrimSpace(q); rest != ""; rest = strings.TrimSpace(rest) {
+		negate := false
+		if rest[0] == '-' {
+			negate = true
+			rest = rest[1:]
+		}
+
+		var raw string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.Index(rest[1:], `"`)
+			if end < 0 {
+				raw, rest = rest[1:], ""
+			} else {
+				raw, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			end := strings.IndexFunc(rest, unicode.IsSpace)
+			if end < 0 {
+				end = len(rest)
+			}
+			raw, rest = rest[:end], rest[end:]
+		}
+
+		if !negate && strings.EqualFold(raw, "or") {
+			if len(group) > 0 {
+				groups = append(groups, group)
+				group = nil
+			}
+			continue
+		}
+		if words := tokenize(raw); len(words) > 0 {
+			group = append(group, textTerm{words: words, negate: negate})
+		}
+	}
+	if len(group) > 0 {
+		groups = append(groups, group)
+	}
+	return groups
+}
+
+// match reports whether the token streams satisfy the query, ranking a
+// match by how often its positive terms occur
+func (q textQuery) match(streams [][]string) (float64, bool) {
+	best, matched := 0.0, false
+	for _, group := range q {
+		rank, ok := 0.0, true
+		for _, term := range group {
+			n := term.count(streams)
+			if term.negate {
+				ok = ok && n == 0
+				continue
+			}
+			ok = ok && n > 0
+			rank += float64(n)
+		}
+		if ok && (!matched || rank > best) {
+			best, matched = rank, true
+		}
+	}
+	return best, matched
+}
+
+func (t textTerm) count(streams [][]string) int {
+	n := 0
+	for _, tokens := range streams {
+		for i := 0; i+len(t.words) <= len(tokens); i++ {
+			phrase := true
+			for j, w := range t.words {
+				if tokens[i+j] != w {
+					phrase = false
+					break
+				}
+			}
+			if phrase {
+				n++
+			}
+		}
+	}
+	return n
+}
+
+// payloadTokens returns the lowercased words of every string value in a
+// JSON document, one stream per value, like to_tsvector('simple', jsonb)
+func payloadTokens(doc interface{}) [][]string {
+	var streams [][]string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case string:
+			streams = append(streams, tokenize(v))
+		case []interface{}:
+			for _, el := range v {
+				walk(el)
+			}
+		case map[string]interface{}:
+			for _, el := range v {
+				walk(el)
+			}
+		}
+	}
+	walk(doc)
+	return streams
+}
+
+func tokenize(s string) []string {
+	return strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
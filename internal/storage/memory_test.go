@@ -0,0 +1,12 @@
+package storage_test
+
+import (
+	"testing"
+
+	"multi-tenant/internal/storage"
+	"multi-tenant/internal/storage/storagetest"
+)
+
+func TestMemoryStore(t *testing.T) {
+	storagetest.Run(t, storage.NewMemoryStore())
+}
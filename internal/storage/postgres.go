@@ -3,16 +3,31 @@ package storage
 
 import (
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"strings"
+	"time"
 
 	"github.com/google/uuid"
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 
 	"multi-tenant/internal/model"
 )
 
+var ErrNotFound = errors.New("not found")
+
+// DefaultDedupWindow is how long idempotency keys are remembered when
+// Storage.DedupWindow is unset
+const DefaultDedupWindow = 24 * time.Hour
+
+// Storage is the PostgreSQL implementation of Store
 type Storage struct {
 	DB *sql.DB
+
+	// DedupWindow is how long an idempotency key suppresses duplicates
+	DedupWindow time.Duration
 }
 
 func NewStorage(dsn string) (*Storage, error) {
@@ -26,70 +41,346 @@ func NewStorage(dsn string) (*Storage, error) {
 	return &Storage{DB: db}, nil
 }
 
-// EnsurePartition creates a tenant partition if not exists
+// EnsurePartition creates a tenant partition and its indexes if not exists
 func (s *Storage) EnsurePartition(tenantID uuid.UUID) error {
 	partitionName := fmt.Sprintf("messages_%s", tenantID.String())
 	query := fmt.Sprintf(`
 		CREATE TABLE IF NOT EXISTS %s PARTITION OF messages
-		FOR VALUES IN ('%s')`, partitionName, tenantID.String())
+		FOR VALUES IN ('%s')`, pq.QuoteIdentifier(partitionName), tenantID.String())
 
 	_, err := s.DB.Exec(query)
 	if err != nil {
 		return fmt.Errorf("failed to create partition: %w", err)
 	}
+
+	indexes := []string{
+		// time-range queries on GET /messages
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s (created_at, id)`,
+			pq.QuoteIdentifier(partitionName+"_created_at_idx"), pq.QuoteIdentifier(partitionName)),
+		// payload containment and JSONPath predicates (filter[field]=value, /messages/search)
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (payload jsonb_path_ops)`,
+			pq.QuoteIdentifier(partitionName+"_payload_idx"), pq.QuoteIdentifier(partitionName)),
+		// full-text search over payload string values
+		fmt.Sprintf(`CREATE INDEX IF NOT EXISTS %s ON %s USING GIN (%s)`,
+			pq.QuoteIdentifier(partitionName+"_payload_fts_idx"), pq.QuoteIdentifier(partitionName), payloadTSVector),
+	}
+	for _, q := range indexes {
+		if _, err := s.DB.Exec(q); err != nil {
+			return fmt.Errorf("failed to create partition index: %w", err)
+		}
+	}
 	return nil
 }
 
-// InsertMessage inserts a message into the tenant's partition
+// messageColumns lists the columns read by scanMessage, in order
+const messageColumns = `id, tenant_id, payload, message_id, correlation_id, headers,
+	content_type, routing_key, redelivered, priority, published_at, received_at, stored_at, created_at`
+
+// InsertMessage inserts a message into the tenant's partition.
+// stored_at is left to the column default.
 func (s *Storage) InsertMessage(m *model.Message) error {
+	headers, _ := marshalHeaders(m)
+
 	query := `
-		INSERT INTO messages (id, tenant_id, payload, created_at)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO messages (id, tenant_id, payload, message_id, correlation_id, headers,
+			content_type, routing_key, redelivered, priority, published_at, received_at, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 	`
-	_, err := s.DB.Exec(query, m.ID, m.TenantID, m.Payload, m.CreatedAt)
+	_, err := s.DB.Exec(query, m.ID, m.TenantID, []byte(m.Payload), m.MessageID, m.CorrelationID, headers,
+		m.ContentType, m.RoutingKey, m.Redelivered, int(m.Priority), m.PublishedAt, m.ReceivedAt, m.CreatedAt)
 	return err
 }
 
-// ListMessagesPaginated retrieves messages using cursor-based pagination
-func (s *Storage) ListMessagesPaginated(tenantID uuid.UUID, cursor string, limit int) ([]model.Message, string, error) {
-	query := `
-		SELECT id, tenant_id, payload, created_at
-		FROM messages
-		WHERE tenant_id = $1
-		  AND ($2::uuid IS NULL OR id > $2::uuid)
-		ORDER BY id
-		LIMIT $3
-	`
+// InsertMessages writes a batch of messages with COPY in a single
+// transaction and returns how many were stored. Messages whose
+// IdempotencyKey was already seen for the tenant within DedupWindow are
+// skipped as duplicates. The stored messages are added to the usage
+// ledger. Either the whole batch is applied or none of it; a message whose
+// headers cannot be encoded is stored without them.
+func (s *Storage) InsertMessages(msgs []*model.Message) (int, error) {
+	if len(msgs) == 0 {
+		return 0, nil
+	}
 
-	var rows *sql.Rows
-	var err error
-	if cursor == "" {
-		rows, err = s.DB.Query(query, tenantID, nil, limit)
-	} else {
-		rows, err = s.DB.Query(query, tenantID, cursor, limit)
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return 0, fmt.Errorf("begin tx: %w", err)
 	}
+	defer tx.Rollback()
+
+	msgs, err = s.claimIdempotencyKeys(tx, msgs)
 	if err != nil {
-		return nil, "", fmt.Errorf("query failed: %w", err)
+		return 0, err
+	}
+	if len(msgs) == 0 {
+		return 0, tx.Commit()
+	}
+
+	stmt, err := tx.Prepare(pq.CopyIn("messages", "id", "tenant_id", "payload", "message_id", "correlation_id",
+		"headers", "content_type", "routing_key", "redelivered", "priority", "published_at", "received_at", "created_at"))
+	if err != nil {
+		return 0, fmt.Errorf("prepare copy: %w", err)
+	}
+
+	for _, m := range msgs {
+		headers, _ := marshalHeaders(m)
+		// COPY sends []byte as bytea, so JSONB columns go over as text;
+		// stored_at is left to the column default
+		if _, err := stmt.Exec(m.ID, m.TenantID, string(m.Payload), m.MessageID, m.CorrelationID, string(headers),
+			m.ContentType, m.RoutingKey, m.Redelivered, int(m.Priority), m.PublishedAt, m.ReceivedAt, m.CreatedAt); err != nil {
+			stmt.Close()
+			return 0, fmt.Errorf("copy row: %w", err)
+		}
+	}
+	if _, err := stmt.Exec(); err != nil {
+		stmt.Close()
+		return 0, fmt.Errorf("copy flush: %w", err)
+	}
+	if err := stmt.Close(); err != nil {
+		return 0, fmt.Errorf("copy close: %w", err)
+	}
+	if err := recordStored(tx, msgs, time.Now()); err != nil {
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("commit: %w", err)
+	}
+	return len(msgs), nil
+}
+
+// claimIdempotencyKeys records the idempotency keys of msgs and returns
+// the messages that are not duplicates. A key counts as a duplicate if it
+// repeats within the batch or was claimed within DedupWindow; expired
+// claims are taken over by the new message.
+func (s *Storage) claimIdempotencyKeys(tx *sql.Tx, msgs []*model.Message) ([]*model.Message, error) {
+	type claim struct {
+		tenantID uuid.UUID
+		key      string
+	}
+
+	var tenantIDs, messageIDs, keys []string
+	seen := make(map[claim]bool)
+	for _, m := range msgs {
+		if m.IdempotencyKey == "" {
+			continue
+		}
+		c := claim{m.TenantID, m.IdempotencyKey}
+		if seen[c] {
+			continue
+		}
+		seen[c] = true
+		tenantIDs = append(tenantIDs, m.TenantID.String())
+		messageIDs = append(messageIDs, m.ID.String())
+		keys = append(keys, m.IdempotencyKey)
+	}
+	if len(keys) == 0 {
+		return msgs, nil
+	}
+
+	window := s.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	rows, err := tx.Query(`
+		INSERT INTO message_dedup (tenant_id, idempotency_key, message_id, seen_at)
+		SELECT t, k, m, now()
+		FROM unnest($1::uuid[], $2::text[], $3::uuid[]) AS c(t, k, m)
+		ON CONFLICT (tenant_id, idempotency_key) DO UPDATE
+			SET message_id = EXCLUDED.message_id, seen_at = EXCLUDED.seen_at
+			WHERE message_dedup.seen_at < now() - make_interval(secs => $4)
+		RETURNING message_id
+	`, pq.Array(tenantIDs), pq.Array(keys), pq.Array(messageIDs), window.Seconds())
+	if err != nil {
+		return nil, fmt.Errorf("claim idempotency keys: %w", err)
 	}
 	defer rows.Close()
 
-	var messages []model.Message
-	var lastID uuid.UUID
+	claimed := make(map[uuid.UUID]bool)
 	for rows.Next() {
-		var m model.Message
-		if err := rows.Scan(&m.ID, &m.TenantID, &m.Payload, &m.CreatedAt); err != nil {
-			return nil, "", fmt.Errorf("scan failed: %w", err)
+		var messageID uuid.UUID
+		if err := rows.Scan(&messageID); err != nil {
+			return nil, fmt.Errorf("scan claim: %w", err)
+		}
+		claimed[messageID] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("claim idempotency keys: %w", err)
+	}
+
+	fresh := make([]*model.Message, 0, len(msgs))
+	for _, m := range msgs {
+		if m.IdempotencyKey == "" || claimed[m.ID] {
+			fresh = append(fresh, m)
+		}
+	}
+	return fresh, nil
+}
+
+// PruneDedup forgets idempotency keys older than DedupWindow
+func (s *Storage) PruneDedup() (int64, error) {
+	window := s.DedupWindow
+	if window <= 0 {
+		window = DefaultDedupWindow
+	}
+
+	res, err := s.DB.Exec(`DELETE FROM message_dedup WHERE seen_at < now() - make_interval(secs => $1)`, window.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// DeleteMessagesBefore deletes a tenant's messages created before the
+// given time and returns how many it deleted
+func (s *Storage) DeleteMessagesBefore(tenantID uuid.UUID, before time.Time) (int64, error) {
+	res, err := s.DB.Exec(`DELETE FROM messages WHERE tenant_id = $1 AND created_at < $2`, tenantID, before)
+	if err != nil {
+		return 0, fmt.Errorf("delete messages: %w", err)
+	}
+	return res.RowsAffected()
+}
+
+// GetMessage fetches a single message of a tenant by ID
+func (s *Storage) GetMessage(tenantID, id uuid.UUID) (*model.Message, error) {
+	row := s.DB.QueryRow(`SELECT `+messageColumns+` FROM messages WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+
+	m, err := scanMessage(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	return m, nil
+}
+
+// scanMessage reads a row selected with messageColumns, followed by any
+// extra columns scanned into extra
+func scanMessage(row interface{ Scan(...interface{}) error }, extra ...interface{}) (*model.Message, error) {
+	var m model.Message
+	var payload, headers []byte
+	var priority int
+	var publishedAt, receivedAt, storedAt sql.NullTime
+
+	dest := []interface{}{&m.ID, &m.TenantID, &payload, &m.MessageID, &m.CorrelationID, &headers,
+		&m.ContentType, &m.RoutingKey, &m.Redelivered, &priority, &publishedAt, &receivedAt, &storedAt, &m.CreatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return nil, err
+	}
+
+	m.Payload = payload
+	m.Priority = uint8(priority)
+	if len(headers) > 0 {
+		if err := json.Unmarshal(headers, &m.Headers); err != nil {
+			return nil, fmt.Errorf("decode headers: %w", err)
 		}
-		lastID = m.ID
-		messages = append(messages, m)
 	}
+	if publishedAt.Valid {
+		m.PublishedAt = &publishedAt.Time
+	}
+	if receivedAt.Valid {
+		m.ReceivedAt = &receivedAt.Time
+	}
+	if storedAt.Valid {
+		m.StoredAt = &storedAt.Time
+	}
+	return &m, nil
+}
 
-	nextCursor := ""
-	if len(messages) == limit {
-		nextCursor = lastID.String()
+// marshalHeaders encodes a message's headers for the headers column and
+// reports whether they were kept. Headers that cannot be encoded are
+// logged and stored empty, so one bad message does not fail its batch.
+func marshalHeaders(m *model.Message) ([]byte, bool) {
+	if len(m.Headers) == 0 {
+		return []byte("{}"), true
 	}
+	data, err := json.Marshal(m.Headers)
+	if err != nil {
+		log.Printf("Storing message %s of tenant %s without headers: %v", m.ID, m.TenantID, err)
+		return []byte("{}"), false
+	}
+	return data, true
+}
+
+// ListMessagesPaginated retrieves messages using keyset pagination on the
+// time-ordered message ID. The cursor, when set, overrides filter.Order.
+func (s *Storage) ListMessagesPaginated(tenantID uuid.UUID, cursor string, filter MessageFilter) (*MessagePage, error) {
+	limit := filter.PageSize()
 
-	return messages, nextCursor, nil
+	where := []string{"tenant_id = $1"}
+	args := []interface{}{tenantID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	order := filter.Order
+	var cur *Cursor
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil || c.Rank != nil {
+			return nil, ErrInvalidCursor
+		}
+		cur = &c
+		order = c.Order
+	}
+
+	// Scan direction: backward pages walk against the display order
+	descending := order == SortDesc
+	if cur != nil && cur.Backward {
+		descending = !descending
+	}
+	dir, cmp := "ASC", ">"
+	if descending {
+		dir, cmp = "DESC", "<"
+	}
+
+	if cur != nil {
+		where = append(where, "id "+cmp+" "+arg(cur.ID))
+	}
+	if !filter.From.IsZero() {
+		where = append(where, "created_at >= "+arg(filter.From))
+	}
+	if !filter.To.IsZero() {
+		where = append(where, "created_at < "+arg(filter.To))
+	}
+	if len(filter.Payload) > 0 {
+		doc, err := json.Marshal(filter.Payload)
+		if err != nil {
+			return nil, fmt.Errorf("invalid payload filter: %w", err)
+		}
+		where = append(where, "payload @> "+arg(string(doc))+"::jsonb")
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+messageColumns+`
+		FROM messages
+		WHERE %s
+		ORDER BY id %s
+		LIMIT %s
+	`, strings.Join(where, " AND "), dir, arg(limit+1))
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	for rows.Next() {
+		m, err := scanMessage(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		messages = append(messages, *m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return newMessagePage(messages, nil, limit, order, cur), nil
 }
 
 func (s *Storage) CreateTenant(id uuid.UUID) error {
@@ -97,13 +388,31 @@ func (s *Storage) CreateTenant(id uuid.UUID) error {
 	return err
 }
 
+// GetTenant fetches a tenant record by ID
+func (s *Storage) GetTenant(id uuid.UUID) (*model.Tenant, error) {
+	var t model.Tenant
+	var settings []byte
+	err := s.DB.QueryRow(`SELECT id, name, concurrency, settings, created_at FROM tenants WHERE id = $1`, id).
+		Scan(&t.ID, &t.Name, &t.Concurrency, &settings, &t.CreatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(settings, &t.Settings); err != nil {
+		return nil, fmt.Errorf("decode tenant settings: %w", err)
+	}
+	return &t, nil
+}
+
 func (s *Storage) DeleteTenant(id uuid.UUID) error {
 	_, err := s.DB.Exec(`DELETE FROM tenants WHERE id = $1`, id)
 	return err
 }
 
 func (s *Storage) ListTenants() ([]model.Tenant, error) {
-	rows, err := s.DB.Query(`SELECT id, name, concurrency FROM tenants`)
+	rows, err := s.DB.Query(`SELECT id, name, concurrency, settings FROM tenants`)
 	if err != nil {
 		return nil, err
 	}
@@ -112,9 +421,13 @@ func (s *Storage) ListTenants() ([]model.Tenant, error) {
 	var tenants []model.Tenant
 	for rows.Next() {
 		var t model.Tenant
-		if err := rows.Scan(&t.ID, &t.Name, &t.Concurrency); err != nil {
+		var settings []byte
+		if err := rows.Scan(&t.ID, &t.Name, &t.Concurrency, &settings); err != nil {
 			return nil, err
 		}
+		if err := json.Unmarshal(settings, &t.Settings); err != nil {
+			return nil, fmt.Errorf("decode tenant settings: %w", err)
+		}
 		tenants = append(tenants, t)
 	}
 	return tenants, nil
@@ -128,3 +441,26 @@ func (s *Storage) UpdateTenantConcurrency(tenantID string, workers int) error {
 	`, workers, tenantID)
 	return err
 }
+
+// UpdateTenantSettings replaces the settings of a tenant
+func (s *Storage) UpdateTenantSettings(id uuid.UUID, settings model.TenantSettings) error {
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return fmt.Errorf("encode tenant settings: %w", err)
+	}
+	res, err := s.DB.Exec(`UPDATE tenants SET settings = $1 WHERE id = $2`, string(data), id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// Close closes the underlying connection pool
+func (s *Storage) Close() error {
+	return s.DB.Close()
+}
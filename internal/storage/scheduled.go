@@ -0,0 +1,112 @@
+// internal/storage/scheduled.go
+package storage
+
+import (
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+const scheduledColumns = `id, tenant_id, payload, message_id, event_type, priority, ordering_key, deliver_at, created_at`
+
+// ScheduleMessage stores a message for later delivery and fills in its
+// creation time
+func (s *Storage) ScheduleMessage(m *model.ScheduledMessage) error {
+	return s.DB.QueryRow(`
+		INSERT INTO scheduled_messages (id, tenant_id, payload, message_id, event_type, priority, ordering_key, deliver_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING created_at
+	`, m.ID, m.TenantID, string(m.Payload), m.MessageID, m.EventType, int(m.Priority), m.OrderingKey, m.DeliverAt).Scan(&m.CreatedAt)
+}
+
+// ListScheduledMessages returns a tenant's undelivered messages, soonest
+// first
+func (s *Storage) ListScheduledMessages(tenantID uuid.UUID) ([]model.ScheduledMessage, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+scheduledColumns+` FROM scheduled_messages
+		WHERE tenant_id = $1
+		ORDER BY deliver_at, id
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	msgs := []model.ScheduledMessage{}
+	for rows.Next() {
+		m, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, *m)
+	}
+	return msgs, rows.Err()
+}
+
+// CancelScheduledMessage removes an undelivered message, or returns
+// ErrNotFound. A message already being published may still arrive.
+func (s *Storage) CancelScheduledMessage(tenantID, id uuid.UUID) error {
+	res, err := s.DB.Exec(`DELETE FROM scheduled_messages WHERE tenant_id = $1 AND id = $2`, tenantID, id)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ClaimDueMessages leases up to limit due messages to the caller, soonest
+// first. A message whose lease expires before CompleteScheduledMessage is
+// claimed again, so delivery is at least once.
+func (s *Storage) ClaimDueMessages(limit int, lease time.Duration) ([]model.ScheduledMessage, error) {
+	rows, err := s.DB.Query(`
+		UPDATE scheduled_messages
+		SET claimed_until = now() + make_interval(secs => $2)
+		WHERE id IN (
+			SELECT id FROM scheduled_messages
+			WHERE deliver_at <= now() AND (claimed_until IS NULL OR claimed_until < now())
+			ORDER BY deliver_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+scheduledColumns, limit, lease.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var msgs []model.ScheduledMessage
+	for rows.Next() {
+		m, err := scanScheduled(rows)
+		if err != nil {
+			return nil, err
+		}
+		msgs = append(msgs, *m)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return msgs[i].DeliverAt.Before(msgs[j].DeliverAt) })
+	return msgs, rows.Err()
+}
+
+// CompleteScheduledMessage removes a message once it has been published
+func (s *Storage) CompleteScheduledMessage(id uuid.UUID) error {
+	_, err := s.DB.Exec(`DELETE FROM scheduled_messages WHERE id = $1`, id)
+	return err
+}
+
+func scanScheduled(row interface{ Scan(...interface{}) error }) (*model.ScheduledMessage, error) {
+	var m model.ScheduledMessage
+	var payload []byte
+	var priority int
+	if err := row.Scan(&m.ID, &m.TenantID, &payload, &m.MessageID, &m.EventType, &priority, &m.OrderingKey, &m.DeliverAt, &m.CreatedAt); err != nil {
+		return nil, err
+	}
+	m.Payload = payload
+	m.Priority = uint8(priority)
+	return &m, nil
+}
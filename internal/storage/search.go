@@ -0,0 +1,115 @@
+// internal/storage/search.go
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"multi-tenant/internal/model"
+)
+
+var ErrInvalidQuery = errors.New("invalid search query")
+
+// payloadTSVector is the indexed full-text expression over payload string
+// values. Queries must use the exact same expression to hit the index.
+const payloadTSVector = `to_tsvector('simple', payload)`
+
+// SearchQuery describes a message search. At least one of Text or
+// JSONPath must be set.
+type SearchQuery struct {
+	// Text is a full-text query in websearch syntax, e.g. `refund -failed`
+	Text string
+	// JSONPath is an SQL/JSON path matched with @?, e.g. `$ ? (@.amount > 100)`
+	JSONPath string
+	Limit    int
+}
+
+// SearchMessages finds messages of a tenant by payload content.
+// Full-text matches are ordered by relevance, then newest first; pure
+// JSONPath searches are ordered newest first. Pagination uses the same
+// opaque cursors as ListMessagesPaginated.
+func (s *Storage) SearchMessages(tenantID uuid.UUID, cursor string, q SearchQuery) (*MessagePage, error) {
+	if q.Text == "" && q.JSONPath == "" {
+		return nil, fmt.Errorf("%w: text or jsonpath is required", ErrInvalidQuery)
+	}
+	limit := MessageFilter{Limit: q.Limit}.PageSize()
+
+	args := []interface{}{tenantID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	where := []string{"tenant_id = $1"}
+	rank := "0::float8"
+	if q.Text != "" {
+		tsq := fmt.Sprintf("websearch_to_tsquery('simple', %s)", arg(q.Text))
+		where = append(where, payloadTSVector+" @@ "+tsq)
+		rank = fmt.Sprintf("ts_rank(%s, %s)::float8", payloadTSVector, tsq)
+	}
+	if q.JSONPath != "" {
+		where = append(where, "payload @? "+arg(q.JSONPath)+"::jsonpath")
+	}
+
+	var cur *Cursor
+	if cursor != "" {
+		c, err := DecodeCursor(cursor)
+		if err != nil || c.Order != SortDesc || c.Rank == nil {
+			return nil, ErrInvalidCursor
+		}
+		cur = &c
+	}
+
+	// Results are (rank, id) descending; backward pages walk it ascending
+	dir, cmp := "DESC", "<"
+	if cur != nil && cur.Backward {
+		dir, cmp = "ASC", ">"
+	}
+	keyset := "true"
+	if cur != nil {
+		keyset = fmt.Sprintf("(rank, id) %s (%s::float8, %s::uuid)", cmp, arg(*cur.Rank), arg(cur.ID))
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+messageColumns+`, rank
+		FROM (
+			SELECT `+messageColumns+`, %s AS rank
+			FROM messages
+			WHERE %s
+		) matched
+		WHERE %s
+		ORDER BY rank %s, id %s
+		LIMIT %s
+	`, rank, strings.Join(where, " AND "), keyset, dir, dir, arg(limit+1))
+
+	rows, err := s.DB.Query(query, args...)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code.Class() == "42" {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidQuery, pqErr.Message)
+		}
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+	defer rows.Close()
+
+	var messages []model.Message
+	var ranks []float64
+	for rows.Next() {
+		var r float64
+		m, err := scanMessage(rows, &r)
+		if err != nil {
+			return nil, fmt.Errorf("scan failed: %w", err)
+		}
+		messages = append(messages, *m)
+		ranks = append(ranks, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("query failed: %w", err)
+	}
+
+	return newMessagePage(messages, ranks, limit, SortDesc, cur), nil
+}
@@ -0,0 +1,531 @@
+// internal/storage/storagetest/storagetest.go
+
+// Package storagetest is a conformance suite for storage.Store
+// implementations, run against both PostgreSQL and the in-memory store.
+package storagetest
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/storage"
+)
+
+// Run exercises the behaviour every Store must share. Each test works on
+// fresh tenant IDs, so one store may be shared across runs.
+func Run(t *testing.T, s storage.Store) {
+	t.Run("Tenants", func(t *testing.T) { testTenants(t, s) })
+	t.Run("Bindings", func(t *testing.T) { testBindings(t, s) })
+	t.Run("Subscriptions", func(t *testing.T) { testSubscriptions(t, s) })
+	t.Run("ScheduledMessages", func(t *testing.T) { testScheduledMessages(t, s) })
+	t.Run("PublishUsage", func(t *testing.T) { testPublishUsage(t, s) })
+	t.Run("UsageLedger", func(t *testing.T) { testUsageLedger(t, s) })
+	t.Run("GetMessage", func(t *testing.T) { testGetMessage(t, s) })
+	t.Run("ListMessagesFilter", func(t *testing.T) { testListMessagesFilter(t, s) })
+	t.Run("ListMessagesCursor", func(t *testing.T) { testListMessagesCursor(t, s) })
+	t.Run("SearchMessages", func(t *testing.T) { testSearchMessages(t, s) })
+	t.Run("InsertMessagesDedup", func(t *testing.T) { testInsertMessagesDedup(t, s) })
+	t.Run("InsertMessagesAtomic", func(t *testing.T) { testInsertMessagesAtomic(t, s) })
+	t.Run("InsertMessagesBadHeaders", func(t *testing.T) { testInsertMessagesBadHeaders(t, s) })
+	t.Run("DeleteMessagesBefore", func(t *testing.T) { testDeleteMessagesBefore(t, s) })
+}
+
+func testTenants(t *testing.T, s storage.Store) {
+	id := uuid.New()
+	require.NoError(t, s.CreateTenant(id))
+	require.NoError(t, s.CreateTenant(id), "creating twice is a no-op")
+
+	require.NoError(t, s.UpdateTenantConcurrency(id.String(), 7))
+	tenant, err := s.GetTenant(id)
+	require.NoError(t, err)
+	require.Equal(t, 7, tenant.Concurrency)
+	require.Zero(t, tenant.Settings.MaxPriority)
+
+	require.NoError(t, s.UpdateTenantSettings(id, model.TenantSettings{MaxPriority: 10, QueueType: "quorum"}))
+	tenant, err = s.GetTenant(id)
+	require.NoError(t, err)
+	require.Equal(t, uint8(10), tenant.Settings.MaxPriority)
+	require.Equal(t, "quorum", tenant.Settings.QueueType)
+	require.ErrorIs(t, s.UpdateTenantSettings(uuid.New(), model.TenantSettings{}), storage.ErrNotFound)
+
+	tenants, err := s.ListTenants()
+	require.NoError(t, err)
+	found := false
+	for _, t := range tenants {
+		found = found || t.ID == id
+	}
+	require.True(t, found)
+
+	require.NoError(t, s.DeleteTenant(id))
+	_, err = s.GetTenant(id)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testPublishUsage(t *testing.T, s storage.Store) {
+	id := uuid.New()
+	require.NoError(t, s.CreateTenant(id))
+	march := time.Date(2024, time.March, 1, 0, 0, 0, 0, time.UTC)
+	april := march.AddDate(0, 1, 0)
+
+	u, err := s.GetPublishUsage(id, march)
+	require.NoError(t, err)
+	require.Zero(t, u.Messages)
+
+	require.NoError(t, s.AddPublishUsage(id, march, 2, 100))
+	require.NoError(t, s.AddPublishUsage(id, march, 3, 50))
+	require.NoError(t, s.AddPublishUsage(id, april, 1, 10))
+	u, err = s.GetPublishUsage(id, march)
+	require.NoError(t, err)
+	require.Equal(t, int64(5), u.Messages)
+	require.Equal(t, int64(150), u.Bytes)
+	require.True(t, march.Equal(u.Period))
+	u, err = s.GetPublishUsage(id, april)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), u.Messages)
+}
+
+func testUsageLedger(t *testing.T, s storage.Store) {
+	id, other := uuid.New(), uuid.New()
+	hour := time.Date(2024, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	require.NoError(t, s.AddUsage([]model.UsageRecord{
+		{TenantID: id, Hour: hour.Add(15 * time.Minute), Usage: model.Usage{Published: 2, Failed: 1}},
+		{TenantID: id, Hour: hour, Usage: model.Usage{Published: 1}},
+		{TenantID: id, Hour: hour.Add(time.Hour), Usage: model.Usage{Published: 4}},
+		{TenantID: other, Hour: hour, Usage: model.Usage{Published: 8}},
+	}))
+
+	records, err := s.ListUsage(storage.UsageFilter{TenantID: id, From: hour, To: hour.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	require.True(t, hour.Equal(records[0].Hour))
+	require.Equal(t, model.Usage{Published: 3, Failed: 1}, records[0].Usage)
+	require.Equal(t, int64(4), records[1].Published)
+
+	records, err = s.ListUsage(storage.UsageFilter{From: hour, To: hour.Add(time.Hour)})
+	require.NoError(t, err)
+	var total model.Usage
+	for _, r := range records {
+		if r.TenantID == id || r.TenantID == other {
+			total.Add(r.Usage)
+		}
+	}
+	require.Equal(t, int64(11), total.Published)
+
+	// Stored messages are metered with the insert, duplicates excluded
+	require.NoError(t, s.EnsurePartition(id))
+	msg := func(key string) *model.Message {
+		return &model.Message{
+			ID:             uuid.Must(uuid.NewV7()),
+			TenantID:       id,
+			Payload:        []byte(`{"n":1}`),
+			CreatedAt:      time.Now(),
+			IdempotencyKey: key,
+		}
+	}
+	_, err = s.InsertMessages([]*model.Message{msg("a"), msg("a"), msg("b")})
+	require.NoError(t, err)
+	now := time.Now().UTC().Truncate(time.Hour)
+	records, err = s.ListUsage(storage.UsageFilter{TenantID: id, From: now, To: now.Add(time.Hour)})
+	require.NoError(t, err)
+	require.Len(t, records, 1)
+	require.Equal(t, int64(2), records[0].Processed)
+	require.Equal(t, int64(14), records[0].BytesStored)
+}
+
+func testBindings(t *testing.T, s storage.Store) {
+	id := uuid.New()
+	require.NoError(t, s.CreateTenant(id))
+
+	bindings, err := s.ListBindings(id)
+	require.NoError(t, err)
+	require.Empty(t, bindings)
+
+	require.NoError(t, s.AddBinding(id, "a.order.*"))
+	require.NoError(t, s.AddBinding(id, "b.#"))
+	require.NoError(t, s.AddBinding(id, "a.order.*"), "adding twice is a no-op")
+	bindings, err = s.ListBindings(id)
+	require.NoError(t, err)
+	require.Len(t, bindings, 2)
+	require.Equal(t, "a.order.*", bindings[0].Pattern)
+	require.Equal(t, id, bindings[0].TenantID)
+
+	require.NoError(t, s.RemoveBinding(id, "a.order.*"))
+	require.ErrorIs(t, s.RemoveBinding(id, "a.order.*"), storage.ErrNotFound)
+
+	// Bindings go with their tenant
+	require.NoError(t, s.DeleteTenant(id))
+	bindings, err = s.ListBindings(id)
+	require.NoError(t, err)
+	require.Empty(t, bindings)
+}
+
+func testSubscriptions(t *testing.T, s storage.Store) {
+	source, target, other := uuid.New(), uuid.New(), uuid.New()
+	for _, id := range []uuid.UUID{source, target, other} {
+		require.NoError(t, s.CreateTenant(id))
+	}
+
+	sub := &model.Subscription{
+		ID:             uuid.New(),
+		SourceTenantID: source,
+		TargetTenantID: target,
+		Pattern:        "order.*",
+		Status:         model.SubscriptionPending,
+	}
+	require.NoError(t, s.CreateSubscription(sub))
+	require.False(t, sub.CreatedAt.IsZero())
+
+	require.NoError(t, s.UpdateSubscriptionStatus(sub.ID, model.SubscriptionApproved))
+	got, err := s.GetSubscription(sub.ID)
+	require.NoError(t, err)
+	require.Equal(t, model.SubscriptionApproved, got.Status)
+	require.Equal(t, target, got.TargetTenantID)
+	require.Equal(t, "order.*", got.Pattern)
+
+	// Both sides see it, uninvolved tenants do not
+	for id, want := range map[uuid.UUID]int{source: 1, target: 1, other: 0} {
+		subs, err := s.ListSubscriptions(id)
+		require.NoError(t, err)
+		require.Len(t, subs, want)
+	}
+
+	_, err = s.GetSubscription(uuid.New())
+	require.ErrorIs(t, err, storage.ErrNotFound)
+	require.ErrorIs(t, s.UpdateSubscriptionStatus(uuid.New(), model.SubscriptionRevoked), storage.ErrNotFound)
+
+	// Subscriptions go with either tenant
+	require.NoError(t, s.DeleteTenant(target))
+	_, err = s.GetSubscription(sub.ID)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testScheduledMessages(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.CreateTenant(tenantID))
+
+	schedule := func(deliverAt time.Time) *model.ScheduledMessage {
+		m := &model.ScheduledMessage{
+			ID:          uuid.New(),
+			TenantID:    tenantID,
+			Payload:     []byte(`{"remind":true}`),
+			MessageID:   "m-" + deliverAt.String(),
+			EventType:   "reminder",
+			Priority:    3,
+			OrderingKey: "order-1",
+			DeliverAt:   deliverAt.UTC().Truncate(time.Millisecond),
+		}
+		require.NoError(t, s.ScheduleMessage(m))
+		return m
+	}
+	now := time.Now()
+	later := schedule(now.Add(time.Hour))
+	due := schedule(now.Add(-time.Second))
+	cancelled := schedule(now.Add(-time.Minute))
+
+	list, err := s.ListScheduledMessages(tenantID)
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	require.Equal(t, cancelled.ID, list[0].ID, "soonest first")
+	require.JSONEq(t, `{"remind":true}`, string(list[0].Payload))
+	require.Equal(t, "reminder", list[0].EventType)
+	require.Equal(t, uint8(3), list[0].Priority)
+	require.Equal(t, "order-1", list[0].OrderingKey)
+
+	require.NoError(t, s.CancelScheduledMessage(tenantID, cancelled.ID))
+	require.ErrorIs(t, s.CancelScheduledMessage(tenantID, cancelled.ID), storage.ErrNotFound)
+	require.ErrorIs(t, s.CancelScheduledMessage(uuid.New(), later.ID), storage.ErrNotFound, "other tenants cannot cancel")
+
+	// Only due messages are claimed, and a claim hides them until its lease ends
+	claimed, err := s.ClaimDueMessages(10, time.Hour)
+	require.NoError(t, err)
+	ids := map[uuid.UUID]bool{}
+	for _, m := range claimed {
+		ids[m.ID] = true
+	}
+	require.True(t, ids[due.ID])
+	require.False(t, ids[later.ID])
+	again, err := s.ClaimDueMessages(10, time.Hour)
+	require.NoError(t, err)
+	for _, m := range again {
+		require.NotEqual(t, due.ID, m.ID)
+	}
+
+	require.NoError(t, s.CompleteScheduledMessage(due.ID))
+	list, err = s.ListScheduledMessages(tenantID)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	require.Equal(t, later.ID, list[0].ID)
+}
+
+func testGetMessage(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	publishedAt := time.Now().UTC().Truncate(time.Millisecond)
+	in := &model.Message{
+		ID:            uuid.Must(uuid.NewV7()),
+		TenantID:      tenantID,
+		Payload:       []byte(`{"event":"created"}`),
+		MessageID:     "msg-1",
+		CorrelationID: "corr-1",
+		Headers:       map[string]interface{}{"source": "billing"},
+		ContentType:   "application/json",
+		RoutingKey:    "tenant_" + tenantID.String() + "_queue",
+		Redelivered:   true,
+		Priority:      7,
+		PublishedAt:   &publishedAt,
+		CreatedAt:     publishedAt,
+	}
+	require.NoError(t, s.InsertMessage(in))
+
+	out, err := s.GetMessage(tenantID, in.ID)
+	require.NoError(t, err)
+	require.Equal(t, "msg-1", out.MessageID)
+	require.Equal(t, "corr-1", out.CorrelationID)
+	require.Equal(t, "billing", out.Headers["source"])
+	require.True(t, out.Redelivered)
+	require.Equal(t, uint8(7), out.Priority)
+	require.NotNil(t, out.PublishedAt)
+	require.True(t, publishedAt.Equal(*out.PublishedAt))
+	require.Nil(t, out.ReceivedAt)
+	require.NotNil(t, out.StoredAt)
+
+	_, err = s.GetMessage(uuid.New(), in.ID)
+	require.ErrorIs(t, err, storage.ErrNotFound)
+}
+
+func testListMessagesFilter(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	base := time.Now().UTC().Truncate(time.Second)
+	payloads := []string{`{"event":"created"}`, `{"event":"deleted"}`, `{"event":"created"}`}
+	for i, p := range payloads {
+		err := s.InsertMessage(&model.Message{
+			ID:        uuid.Must(uuid.NewV7()),
+			TenantID:  tenantID,
+			Payload:   []byte(p),
+			CreatedAt: base.Add(time.Duration(i) * time.Minute),
+		})
+		require.NoError(t, err)
+	}
+
+	page, err := s.ListMessagesPaginated(tenantID, "", storage.MessageFilter{
+		Payload: map[string]string{"event": "created"},
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 2)
+
+	page, err = s.ListMessagesPaginated(tenantID, "", storage.MessageFilter{
+		From: base.Add(time.Minute),
+		To:   base.Add(2 * time.Minute),
+	})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 1)
+	require.JSONEq(t, `{"event":"deleted"}`, string(page.Messages[0].Payload))
+}
+
+func testListMessagesCursor(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	var ids []uuid.UUID
+	for i := 0; i < 5; i++ {
+		id := uuid.Must(uuid.NewV7())
+		ids = append(ids, id)
+		require.NoError(t, s.InsertMessage(&model.Message{
+			ID:        id,
+			TenantID:  tenantID,
+			Payload:   []byte(fmt.Sprintf(`{"n":%d}`, i)),
+			CreatedAt: time.Now(),
+		}))
+	}
+
+	filter := storage.MessageFilter{Limit: 2}
+
+	first, err := s.ListMessagesPaginated(tenantID, "", filter)
+	require.NoError(t, err)
+	require.True(t, first.HasMore)
+	require.Empty(t, first.PrevCursor)
+	require.Equal(t, ids[0], first.Messages[0].ID)
+
+	second, err := s.ListMessagesPaginated(tenantID, first.NextCursor, filter)
+	require.NoError(t, err)
+	require.True(t, second.HasMore)
+	require.Equal(t, ids[2], second.Messages[0].ID)
+
+	last, err := s.ListMessagesPaginated(tenantID, second.NextCursor, filter)
+	require.NoError(t, err)
+	require.False(t, last.HasMore)
+	require.Empty(t, last.NextCursor)
+	require.Len(t, last.Messages, 1)
+
+	// Page backwards from the second page
+	back, err := s.ListMessagesPaginated(tenantID, second.PrevCursor, filter)
+	require.NoError(t, err)
+	require.False(t, back.HasMore)
+	require.Equal(t, []uuid.UUID{ids[0], ids[1]}, []uuid.UUID{back.Messages[0].ID, back.Messages[1].ID})
+
+	// Descending order is embedded in the cursor
+	desc, err := s.ListMessagesPaginated(tenantID, "", storage.MessageFilter{Limit: 2, Order: storage.SortDesc})
+	require.NoError(t, err)
+	require.Equal(t, ids[4], desc.Messages[0].ID)
+	next, err := s.ListMessagesPaginated(tenantID, desc.NextCursor, filter)
+	require.NoError(t, err)
+	require.Equal(t, ids[2], next.Messages[0].ID)
+}
+
+func testSearchMessages(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	payloads := []string{
+		`{"note":"refund issued","amount":50}`,
+		`{"note":"refund refund requested","amount":150}`,
+		`{"note":"order shipped","amount":300}`,
+	}
+	for _, p := range payloads {
+		require.NoError(t, s.InsertMessage(&model.Message{
+			ID:        uuid.Must(uuid.NewV7()),
+			TenantID:  tenantID,
+			Payload:   []byte(p),
+			CreatedAt: time.Now(),
+		}))
+	}
+
+	page, err := s.SearchMessages(tenantID, "", storage.SearchQuery{Text: "refund"})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 2)
+	require.JSONEq(t, payloads[1], string(page.Messages[0].Payload), "higher rank first")
+
+	page, err = s.SearchMessages(tenantID, "", storage.SearchQuery{JSONPath: "$ ? (@.amount > 100)", Limit: 1})
+	require.NoError(t, err)
+	require.True(t, page.HasMore)
+	next, err := s.SearchMessages(tenantID, page.NextCursor, storage.SearchQuery{JSONPath: "$ ? (@.amount > 100)", Limit: 1})
+	require.NoError(t, err)
+	require.False(t, next.HasMore)
+	require.NotEqual(t, page.Messages[0].ID, next.Messages[0].ID)
+
+	_, err = s.SearchMessages(tenantID, "", storage.SearchQuery{JSONPath: "$ ? ("})
+	require.ErrorIs(t, err, storage.ErrInvalidQuery)
+}
+
+func testInsertMessagesDedup(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	newMsg := func(key string) *model.Message {
+		return &model.Message{
+			ID:             uuid.Must(uuid.NewV7()),
+			TenantID:       tenantID,
+			Payload:        []byte(`{"event":"created"}`),
+			CreatedAt:      time.Now(),
+			IdempotencyKey: key,
+		}
+	}
+
+	stored, err := s.InsertMessages([]*model.Message{newMsg("a"), newMsg("a"), newMsg("b"), newMsg("")})
+	require.NoError(t, err)
+	require.Equal(t, 3, stored)
+
+	// Redelivery of an already stored key is dropped
+	stored, err = s.InsertMessages([]*model.Message{newMsg("b"), newMsg("c")})
+	require.NoError(t, err)
+	require.Equal(t, 1, stored)
+
+	page, err := s.ListMessagesPaginated(tenantID, "", storage.MessageFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 4)
+}
+
+func testInsertMessagesAtomic(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	ok := &model.Message{
+		ID:        uuid.Must(uuid.NewV7()),
+		TenantID:  tenantID,
+		Payload:   []byte(`{"event":"created"}`),
+		CreatedAt: time.Now(),
+	}
+	orphan := &model.Message{
+		ID:        uuid.Must(uuid.NewV7()),
+		TenantID:  uuid.New(), // no partition
+		Payload:   []byte(`{"event":"created"}`),
+		CreatedAt: time.Now(),
+	}
+
+	_, err := s.InsertMessages([]*model.Message{ok, orphan})
+	require.Error(t, err)
+
+	_, err = s.GetMessage(tenantID, ok.ID)
+	require.ErrorIs(t, err, storage.ErrNotFound, "a failed batch stores nothing")
+}
+
+func testInsertMessagesBadHeaders(t *testing.T, s storage.Store) {
+	tenantID := uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+
+	good := &model.Message{
+		ID:        uuid.Must(uuid.NewV7()),
+		TenantID:  tenantID,
+		Payload:   []byte(`{"n":1}`),
+		Headers:   map[string]interface{}{"source": "billing"},
+		CreatedAt: time.Now(),
+	}
+	bad := &model.Message{
+		ID:        uuid.Must(uuid.NewV7()),
+		TenantID:  tenantID,
+		Payload:   []byte(`{"n":2}`),
+		Headers:   map[string]interface{}{"ratio": math.NaN()}, // not encodable as JSON
+		CreatedAt: time.Now(),
+	}
+
+	n, err := s.InsertMessages([]*model.Message{good, bad})
+	require.NoError(t, err)
+	require.Equal(t, 2, n, "a message with bad headers does not fail its batch")
+
+	got, err := s.GetMessage(tenantID, good.ID)
+	require.NoError(t, err)
+	require.Equal(t, "billing", got.Headers["source"])
+
+	got, err = s.GetMessage(tenantID, bad.ID)
+	require.NoError(t, err)
+	require.Empty(t, got.Headers, "headers that cannot be encoded are dropped")
+	require.JSONEq(t, `{"n":2}`, string(got.Payload))
+}
+
+func testDeleteMessagesBefore(t *testing.T, s storage.Store) {
+	tenantID, other := uuid.New(), uuid.New()
+	require.NoError(t, s.EnsurePartition(tenantID))
+	require.NoError(t, s.EnsurePartition(other))
+
+	cutoff := time.Now().UTC().Truncate(time.Second)
+	for _, m := range []*model.Message{
+		{ID: uuid.Must(uuid.NewV7()), TenantID: tenantID, Payload: []byte(`{"n":1}`), CreatedAt: cutoff.Add(-time.Hour)},
+		{ID: uuid.Must(uuid.NewV7()), TenantID: tenantID, Payload: []byte(`{"n":2}`), CreatedAt: cutoff},
+		{ID: uuid.Must(uuid.NewV7()), TenantID: other, Payload: []byte(`{"n":3}`), CreatedAt: cutoff.Add(-time.Hour)},
+	} {
+		require.NoError(t, s.InsertMessage(m))
+	}
+
+	n, err := s.DeleteMessagesBefore(tenantID, cutoff)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), n)
+
+	page, err := s.ListMessagesPaginated(tenantID, "", storage.MessageFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 1)
+	require.JSONEq(t, `{"n":2}`, string(page.Messages[0].Payload))
+
+	page, err = s.ListMessagesPaginated(other, "", storage.MessageFilter{})
+	require.NoError(t, err)
+	require.Len(t, page.Messages, 1, "other tenants keep their messages")
+}
@@ -0,0 +1,71 @@
+// internal/storage/store.go
+package storage
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+// Store is the persistence layer used by the tenant manager and the API.
+// Storage (PostgreSQL) and MemoryStore implement it with the same
+// semantics, which storagetest.Run verifies for both.
+type Store interface {
+	// Tenants
+	CreateTenant(id uuid.UUID) error
+	GetTenant(id uuid.UUID) (*model.Tenant, error)
+	DeleteTenant(id uuid.UUID) error
+	ListTenants() ([]model.Tenant, error)
+
+	// Settings
+	UpdateTenantConcurrency(tenantID string, workers int) error
+	UpdateTenantSettings(id uuid.UUID, settings model.TenantSettings) error
+
+	// Topic bindings
+	AddBinding(tenantID uuid.UUID, pattern string) error
+	RemoveBinding(tenantID uuid.UUID, pattern string) error
+	ListBindings(tenantID uuid.UUID) ([]model.Binding, error)
+
+	// Fan-out subscriptions
+	CreateSubscription(sub *model.Subscription) error
+	GetSubscription(id uuid.UUID) (*model.Subscription, error)
+	ListSubscriptions(tenantID uuid.UUID) ([]model.Subscription, error)
+	UpdateSubscriptionStatus(id uuid.UUID, status string) error
+
+	// Scheduled messages
+	ScheduleMessage(m *model.ScheduledMessage) error
+	ListScheduledMessages(tenantID uuid.UUID) ([]model.ScheduledMessage, error)
+	CancelScheduledMessage(tenantID, id uuid.UUID) error
+	ClaimDueMessages(limit int, lease time.Duration) ([]model.ScheduledMessage, error)
+	CompleteScheduledMessage(id uuid.UUID) error
+
+	// Publish quotas
+	AddPublishUsage(tenantID uuid.UUID, period time.Time, messages, bytes int64) error
+	GetPublishUsage(tenantID uuid.UUID, period time.Time) (model.PublishUsage, error)
+
+	// Usage ledger; InsertMessages also records what it stores
+	AddUsage(records []model.UsageRecord) error
+	ListUsage(f UsageFilter) ([]model.UsageRecord, error)
+
+	// Partitions
+	EnsurePartition(tenantID uuid.UUID) error
+
+	// Messages
+	InsertMessage(m *model.Message) error
+	InsertMessages(msgs []*model.Message) (int, error)
+	GetMessage(tenantID, id uuid.UUID) (*model.Message, error)
+	ListMessagesPaginated(tenantID uuid.UUID, cursor string, filter MessageFilter) (*MessagePage, error)
+	SearchMessages(tenantID uuid.UUID, cursor string, q SearchQuery) (*MessagePage, error)
+	DeleteMessagesBefore(tenantID uuid.UUID, before time.Time) (int64, error)
+	PruneDedup() (int64, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*Storage)(nil)
+	_ Store = (*MemoryStore)(nil)
+	_ Store = (*IsolatedStore)(nil)
+)
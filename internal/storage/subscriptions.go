@@ -0,0 +1,79 @@
+// internal/storage/subscriptions.go
+package storage
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+const subscriptionColumns = `id, source_tenant_id, target_tenant_id, pattern, status, created_at, updated_at`
+
+// CreateSubscription inserts sub and fills in its timestamps
+func (s *Storage) CreateSubscription(sub *model.Subscription) error {
+	return s.DB.QueryRow(`
+		INSERT INTO subscriptions (id, source_tenant_id, target_tenant_id, pattern, status)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING created_at, updated_at
+	`, sub.ID, sub.SourceTenantID, sub.TargetTenantID, sub.Pattern, sub.Status).
+		Scan(&sub.CreatedAt, &sub.UpdatedAt)
+}
+
+func (s *Storage) GetSubscription(id uuid.UUID) (*model.Subscription, error) {
+	sub, err := scanSubscription(s.DB.QueryRow(`SELECT `+subscriptionColumns+` FROM subscriptions WHERE id = $1`, id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sub, err
+}
+
+// ListSubscriptions returns the subscriptions a tenant is the source or
+// the target of, oldest first
+func (s *Storage) ListSubscriptions(tenantID uuid.UUID) ([]model.Subscription, error) {
+	rows, err := s.DB.Query(`
+		SELECT `+subscriptionColumns+` FROM subscriptions
+		WHERE source_tenant_id = $1 OR target_tenant_id = $1
+		ORDER BY created_at, id
+	`, tenantID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	subs := []model.Subscription{}
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, *sub)
+	}
+	return subs, rows.Err()
+}
+
+// UpdateSubscriptionStatus sets a subscription's status, or returns
+// ErrNotFound
+func (s *Storage) UpdateSubscriptionStatus(id uuid.UUID, status string) error {
+	res, err := s.DB.Exec(`UPDATE subscriptions SET status = $2, updated_at = now() WHERE id = $1`, id, status)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func scanSubscription(row interface{ Scan(...interface{}) error }) (*model.Subscription, error) {
+	var sub model.Subscription
+	err := row.Scan(&sub.ID, &sub.SourceTenantID, &sub.TargetTenantID, &sub.Pattern, &sub.Status, &sub.CreatedAt, &sub.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &sub, nil
+}
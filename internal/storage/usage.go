@@ -0,0 +1,205 @@
+// internal/storage/usage.go
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+
+	"multi-tenant/internal/model"
+)
+
+// AddPublishUsage adds to a tenant's publish counters for the month
+// starting at period
+func (s *Storage) AddPublishUsage(tenantID uuid.UUID, period time.Time, messages, bytes int64) error {
+	_, err := s.DB.Exec(`
+		INSERT INTO publish_usage (tenant_id, period, messages, bytes) VALUES ($1, $2, $3, $4)
+		ON CONFLICT (tenant_id, period) DO UPDATE
+		SET messages = publish_usage.messages + EXCLUDED.messages,
+		    bytes = publish_usage.bytes + EXCLUDED.bytes
+	`, tenantID, period.UTC().Format(time.DateOnly), messages, bytes)
+	return err
+}
+
+// GetPublishUsage returns a tenant's publish counters for the month
+// starting at period, which are zero before anything is recorded
+func (s *Storage) GetPublishUsage(tenantID uuid.UUID, period time.Time) (model.PublishUsage, error) {
+	u := model.PublishUsage{TenantID: tenantID, Period: period.UTC()}
+	err := s.DB.QueryRow(`
+		SELECT COALESCE(SUM(messages), 0), COALESCE(SUM(bytes), 0) FROM publish_usage
+		WHERE tenant_id = $1 AND period = $2
+	`, tenantID, period.UTC().Format(time.DateOnly)).Scan(&u.Messages, &u.Bytes)
+	return u, err
+}
+
+type usageKey struct {
+	tenantID uuid.UUID
+	period   time.Time
+}
+
+func (s *MemoryStore) AddPublishUsage(tenantID uuid.UUID, period time.Time, messages, bytes int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := usageKey{tenantID, period.UTC()}
+	u := s.usage[key]
+	u.Messages += messages
+	u.Bytes += bytes
+	s.usage[key] = u
+	return nil
+}
+
+func (s *MemoryStore) GetPublishUsage(tenantID uuid.UUID, period time.Time) (model.PublishUsage, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	u := s.usage[usageKey{tenantID, period.UTC()}]
+	u.TenantID, u.Period = tenantID, period.UTC()
+	return u, nil
+}
+
+// UsageFilter selects ledger rows for hours in [From, To); a nil TenantID
+// selects every tenant
+type UsageFilter struct {
+	TenantID uuid.UUID
+	From, To time.Time
+}
+
+// usageHour is the ledger hour that t falls in
+func usageHour(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Hour)
+}
+
+// execer is a *sql.DB or *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+// AddUsage adds records to the usage ledger in one transaction
+func (s *Storage) AddUsage(records []model.UsageRecord) error {
+	tx, err := s.DB.Begin()
+	if err != nil {
+		return fmt.Errorf("begin tx: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range records {
+		if err := addUsage(tx, r.TenantID, r.Hour, r.Usage); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func addUsage(db execer, tenantID uuid.UUID, hour time.Time, u model.Usage) error {
+	_, err := db.Exec(`
+		INSERT INTO usage_ledger (tenant_id, hour, published, processed, failed, bytes_stored)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (tenant_id, hour) DO UPDATE
+		SET published = usage_ledger.published + EXCLUDED.published,
+		    processed = usage_ledger.processed + EXCLUDED.processed,
+		    failed = usage_ledger.failed + EXCLUDED.failed,
+		    bytes_stored = usage_ledger.bytes_stored + EXCLUDED.bytes_stored
+	`, tenantID, usageHour(hour), u.Published, u.Processed, u.Failed, u.BytesStored)
+	if err != nil {
+		return fmt.Errorf("add usage of tenant %s: %w", tenantID, err)
+	}
+	return nil
+}
+
+// recordStored adds the messages stored by a batch to the ledger, so it
+// counts them exactly once along with the insert. Callers pass the
+// batch's transaction.
+func recordStored(db execer, msgs []*model.Message, now time.Time) error {
+	byTenant := make(map[uuid.UUID]model.Usage)
+	for _, m := range msgs {
+		u := byTenant[m.TenantID]
+		u.Processed++
+		u.BytesStored += int64(len(m.Payload))
+		byTenant[m.TenantID] = u
+	}
+	for tenantID, u := range byTenant {
+		if err := addUsage(db, tenantID, now, u); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListUsage returns the ledger rows matching f by tenant, then hour
+func (s *Storage) ListUsage(f UsageFilter) ([]model.UsageRecord, error) {
+	rows, err := s.DB.Query(`
+		SELECT tenant_id, hour, published, processed, failed, bytes_stored FROM usage_ledger
+		WHERE ($1::uuid IS NULL OR tenant_id = $1) AND hour >= $2 AND hour < $3
+		ORDER BY tenant_id, hour
+	`, nullUUID(f.TenantID), f.From, f.To)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []model.UsageRecord{}
+	for rows.Next() {
+		var r model.UsageRecord
+		if err := rows.Scan(&r.TenantID, &r.Hour, &r.Published, &r.Processed, &r.Failed, &r.BytesStored); err != nil {
+			return nil, err
+		}
+		r.Hour = r.Hour.UTC()
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func nullUUID(id uuid.UUID) interface{} {
+	if id == uuid.Nil {
+		return nil
+	}
+	return id
+}
+
+type ledgerKey struct {
+	tenantID uuid.UUID
+	hour     time.Time
+}
+
+func (s *MemoryStore) AddUsage(records []model.UsageRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range records {
+		s.addUsage(r.TenantID, r.Hour, r.Usage)
+	}
+	return nil
+}
+
+// addUsage adds to a ledger row. Callers must hold s.mu.
+func (s *MemoryStore) addUsage(tenantID uuid.UUID, hour time.Time, u model.Usage) {
+	key := ledgerKey{tenantID, usageHour(hour)}
+	row := s.ledger[key]
+	row.Add(u)
+	s.ledger[key] = row
+}
+
+func (s *MemoryStore) ListUsage(f UsageFilter) ([]model.UsageRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	records := []model.UsageRecord{}
+	for k, u := range s.ledger {
+		if (f.TenantID != uuid.Nil && k.tenantID != f.TenantID) || k.hour.Before(f.From) || !k.hour.Before(f.To) {
+			continue
+		}
+		records = append(records, model.UsageRecord{TenantID: k.tenantID, Hour: k.hour, Usage: u})
+	}
+	sort.Slice(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.TenantID != b.TenantID {
+			return a.TenantID.String() < b.TenantID.String()
+		}
+		return a.Hour.Before(b.Hour)
+	})
+	return records, nil
+}
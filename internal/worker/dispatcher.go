@@ -0,0 +1,150 @@
+// internal/worker/dispatcher.go
+package worker
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+
+	"multi-tenant/internal/messaging"
+)
+
+// laneBuffer is how many deliveries may wait on a lane before Dispatch
+// blocks, so one slow key only stalls the others once its lane is full
+const laneBuffer = 16
+
+// HandlerFunc processes a delivery, including settling it
+type HandlerFunc func(d messaging.Delivery)
+
+// Dispatcher runs a tenant's deliveries on a fixed number of lanes, each
+// a goroutine handling one delivery at a time. Deliveries with the same
+// ordering key hash to the same lane, so they are handled sequentially and
+// in delivery order while different keys run in parallel. Deliveries
+// without a key are spread round-robin.
+type Dispatcher struct {
+	handle HandlerFunc
+
+	mu    sync.RWMutex
+	key   KeyFunc
+	lanes []chan messaging.Delivery
+	next  atomic.Uint64 // round-robin counter for unkeyed deliveries
+	wg    sync.WaitGroup
+
+	pending atomic.Int64 // dispatched deliveries not yet handled
+}
+
+// NewDispatcher starts n lanes (at least one); with a nil key every
+// delivery is unkeyed
+func NewDispatcher(n int, key KeyFunc, handle HandlerFunc) *Dispatcher {
+	d := &Dispatcher{handle: handle, key: key}
+	d.start(n)
+	return d
+}
+
+func (d *Dispatcher) start(n int) {
+	d.lanes = make([]chan messaging.Delivery, max(n, 1))
+	for i := range d.lanes {
+		lane := make(chan messaging.Delivery, laneBuffer)
+		d.lanes[i] = lane
+		d.wg.Add(1)
+		go func() {
+			defer d.wg.Done()
+			for msg := range lane {
+				d.handle(msg)
+				d.pending.Add(-1)
+			}
+		}()
+	}
+}
+
+// drain closes the lanes and waits until their deliveries are handled.
+// Callers must hold mu.
+func (d *Dispatcher) drain() {
+	for _, lane := range d.lanes {
+		close(lane)
+	}
+	d.wg.Wait()
+	d.lanes = nil
+}
+
+// Dispatch queues msg on its lane. Deliveries dispatched after Stop are
+// left unsettled, for the broker to redeliver.
+func (d *Dispatcher) Dispatch(msg messaging.Delivery) {
+	// Resize, SetKey and Stop wait on the read lock, so the lanes stay
+	// open until the send completes
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	if d.lanes == nil {
+		return
+	}
+	d.pending.Add(1)
+	d.lanes[d.laneFor(msg)] <- msg
+}
+
+// Pending returns the number of deliveries dispatched but not yet
+// handled, including those waiting to be queued on a full lane; it shows
+// how many more lanes could be kept busy
+func (d *Dispatcher) Pending() int {
+	return int(d.pending.Load())
+}
+
+// laneFor picks the lane of msg. Callers must hold mu.
+func (d *Dispatcher) laneFor(msg messaging.Delivery) int {
+	var key string
+	if d.key != nil {
+		key = d.key(msg)
+	}
+	if key == "" {
+		return int(d.next.Add(1) % uint64(len(d.lanes)))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return int(h.Sum32() % uint32(len(d.lanes)))
+}
+
+// Lanes returns the number of lanes
+func (d *Dispatcher) Lanes() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return len(d.lanes)
+}
+
+// Resize changes the number of lanes. Keys hash to different lanes
+// afterwards, so the current lanes are drained first to keep each key in
+// order.
+func (d *Dispatcher) Resize(n int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.lanes == nil || max(n, 1) == len(d.lanes) {
+		return
+	}
+	d.drain()
+	d.start(n)
+}
+
+// SetKey changes how ordering keys are read, draining the lanes first as
+// for Resize
+func (d *Dispatcher) SetKey(key KeyFunc) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.key = key
+	if d.lanes == nil {
+		return
+	}
+	n := len(d.lanes)
+	d.drain()
+	d.start(n)
+}
+
+// Stop waits until every dispatched delivery has been handled
+func (d *Dispatcher) Stop() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.lanes != nil {
+		d.drain()
+	}
+}
@@ -0,0 +1,101 @@
+package worker_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/worker"
+)
+
+func TestDispatcherKeepsKeyOrder(t *testing.T) {
+	key, err := worker.NewKeyFunc(&model.OrderingKey{JSONPath: "$.order.id"})
+	require.NoError(t, err)
+
+	var mu sync.Mutex
+	seen := make(map[string][]int)
+	d := worker.NewDispatcher(4, key, func(msg messaging.Delivery) {
+		// Give other deliveries of the same key a chance to overtake
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		k := key(msg)
+		seen[k] = append(seen[k], int(msg.DeliveryTag))
+	})
+
+	for i := range 200 {
+		body := fmt.Sprintf(`{"order":{"id":%d}}`, i%5)
+		d.Dispatch(messaging.Delivery{Body: []byte(body), DeliveryTag: uint64(i)})
+		if i == 100 {
+			d.Resize(3)
+		}
+	}
+	d.Stop()
+
+	require.Len(t, seen, 5)
+	for k, tags := range seen {
+		require.Len(t, tags, 40)
+		require.IsIncreasing(t, tags, "key %s out of order", k)
+	}
+}
+
+func TestDispatcherRunsKeysInParallel(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan string, 3)
+	d := worker.NewDispatcher(2, worker.HeaderKey(messaging.OrderingKeyHeader), func(msg messaging.Delivery) {
+		started <- string(msg.Body)
+		if string(msg.Body) == "a1" {
+			<-release
+		}
+	})
+	defer d.Stop()
+
+	// Keys "a" and "b" hash to different lanes of two
+	keyed := func(body, key string) messaging.Delivery {
+		return messaging.Delivery{Body: []byte(body), Headers: map[string]interface{}{messaging.OrderingKeyHeader: key}}
+	}
+	d.Dispatch(keyed("a1", "a"))
+	require.Equal(t, "a1", <-started)
+	d.Dispatch(keyed("a2", "a"))
+	d.Dispatch(keyed("b1", "b"))
+
+	select {
+	case got := <-started:
+		require.Equal(t, "b1", got, "a2 must wait for a1")
+	case <-time.After(5 * time.Second):
+		t.Fatal("key b stalled behind key a")
+	}
+	close(release)
+	require.Equal(t, "a2", <-started)
+}
+
+func TestNewKeyFunc(t *testing.T) {
+	_, err := worker.NewKeyFunc(&model.OrderingKey{})
+	require.ErrorIs(t, err, worker.ErrInvalidOrderingKey)
+	_, err = worker.NewKeyFunc(&model.OrderingKey{Header: "h", JSONPath: "$.a"})
+	require.ErrorIs(t, err, worker.ErrInvalidOrderingKey)
+	_, err = worker.NewKeyFunc(&model.OrderingKey{JSONPath: "$.a..b"})
+	require.ErrorIs(t, err, worker.ErrInvalidOrderingKey)
+
+	byHeader, err := worker.NewKeyFunc(nil)
+	require.NoError(t, err)
+	require.Equal(t, "o-1", byHeader(messaging.Delivery{Headers: map[string]interface{}{"x-ordering-key": "o-1"}}))
+	require.Empty(t, byHeader(messaging.Delivery{}))
+
+	byPath, err := worker.NewKeyFunc(&model.OrderingKey{JSONPath: "customer.id"})
+	require.NoError(t, err)
+	for body, want := range map[string]string{
+		`{"customer":{"id":"c-7"}}`:          "c-7",
+		`{"customer":{"id":12345678901234}}`: "12345678901234",
+		`{"customer":{"id":{"nested":1}}}`:   "",
+		`{"customer":"c-7"}`:                 "",
+		`not json`:                           "",
+	} {
+		require.Equal(t, want, byPath(messaging.Delivery{Body: []byte(body)}), body)
+	}
+}
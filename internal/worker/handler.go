@@ -0,0 +1,192 @@
+// internal/worker/handler.go
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+)
+
+var (
+	// ErrDrop ends a handler chain early; the message is acked without
+	// running the remaining handlers
+	ErrDrop = errors.New("message dropped")
+
+	ErrInvalidHandler = errors.New("invalid handler")
+	ErrInvalidMessage = errors.New("invalid message")
+	// ErrForbiddenAddress is returned by webhooks whose host, or a host
+	// they redirect to, is not a public address
+	ErrForbiddenAddress = errors.New("webhook address not allowed")
+)
+
+// Message is a delivery on its way through a tenant's handler chain.
+// Handlers may replace Body; the delivery itself is settled by whoever
+// runs the chain once it ends.
+type Message struct {
+	TenantID  string
+	EventType string
+	Body      []byte
+	Delivery  messaging.Delivery
+
+	// Stored is the body to store once the chain ends, as the persist
+	// handler found it; nil leaves the message unstored
+	Stored []byte
+}
+
+// NewMessage starts a delivery of tenantID through a chain
+func NewMessage(tenantID string, d messaging.Delivery) *Message {
+	return &Message{
+		TenantID:  tenantID,
+		EventType: d.EventType(),
+		Body:      d.Body,
+		Delivery:  d,
+	}
+}
+
+// Handler processes a message as one step of a chain. An error stops the
+// chain and rejects the message, except ErrDrop, which acks it.
+type Handler interface {
+	Handle(ctx context.Context, m *Message) error
+}
+
+// Chain runs its handlers in order until one fails
+type Chain []Handler
+
+func (c Chain) Handle(ctx context.Context, m *Message) error {
+	for _, h := range c {
+		if err := h.Handle(ctx, m); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Route runs Chain on messages whose event type matches Pattern
+type Route struct {
+	Pattern string
+	Chain   Chain
+}
+
+// Router picks a tenant's chain by event type. Its routes may be replaced
+// while messages are handled; each message runs through the routes it
+// started with.
+type Router struct {
+	fallback Handler
+
+	mu     sync.RWMutex
+	routes []Route
+}
+
+// NewRouter returns a Router that hands messages no route matches to
+// fallback
+func NewRouter(fallback Handler, routes []Route) *Router {
+	return &Router{fallback: fallback, routes: routes}
+}
+
+// SetRoutes replaces the routes
+func (r *Router) SetRoutes(routes []Route) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.routes = routes
+}
+
+func (r *Router) Handle(ctx context.Context, m *Message) error {
+	r.mu.RLock()
+	routes := r.routes
+	r.mu.RUnlock()
+
+	for _, route := range routes {
+		if messaging.TopicMatch(route.Pattern, m.EventType) {
+			return route.Chain.Handle(ctx, m)
+		}
+	}
+	return r.fallback.Handle(ctx, m)
+}
+
+// Factory builds a handler from its configuration, which is nil when the
+// spec has none
+type Factory func(config json.RawMessage) (Handler, error)
+
+// Registry maps handler types to the factories that build them
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+}
+
+// NewRegistry returns a registry of the built-in handlers: persist,
+// webhook, transform, validate and drop
+func NewRegistry() *Registry {
+	r := &Registry{factories: make(map[string]Factory)}
+	r.Register("persist", func(json.RawMessage) (Handler, error) { return Persist{}, nil })
+	r.Register("webhook", NewWebhook)
+	r.Register("transform", NewTransform)
+	r.Register("validate", NewValidate)
+	r.Register("drop", func(json.RawMessage) (Handler, error) { return Drop{}, nil })
+	return r
+}
+
+// Register adds a handler type, replacing any of the same name
+func (r *Registry) Register(name string, f Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = f
+}
+
+// Types returns the registered handler types in order
+func (r *Registry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	types := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		types = append(types, name)
+	}
+	sort.Strings(types)
+	return types
+}
+
+// New builds the handler a spec describes
+func (r *Registry) New(spec model.HandlerSpec) (Handler, error) {
+	r.mu.RLock()
+	f, ok := r.factories[spec.Type]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown type %q", ErrInvalidHandler, spec.Type)
+	}
+
+	h, err := f(spec.Config)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrInvalidHandler, spec.Type, err)
+	}
+	return h, nil
+}
+
+// Routes builds the routes of a tenant's handler configuration
+func (r *Registry) Routes(cfg []model.HandlerRoute) ([]Route, error) {
+	routes := make([]Route, 0, len(cfg))
+	for i, rc := range cfg {
+		if err := messaging.ValidateEventPattern(rc.EventTypes); err != nil {
+			return nil, fmt.Errorf("%w: route %d: %w", ErrInvalidHandler, i, err)
+		}
+		if len(rc.Handlers) == 0 {
+			return nil, fmt.Errorf("%w: route %d has no handlers", ErrInvalidHandler, i)
+		}
+
+		chain := make(Chain, 0, len(rc.Handlers))
+		for _, spec := range rc.Handlers {
+			h, err := r.New(spec)
+			if err != nil {
+				return nil, fmt.Errorf("route %d: %w", i, err)
+			}
+			chain = append(chain, h)
+		}
+		routes = append(routes, Route{Pattern: rc.EventTypes, Chain: chain})
+	}
+	return routes, nil
+}
@@ -0,0 +1,116 @@
+package worker_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+	"multi-tenant/internal/worker"
+)
+
+func TestBuiltinHandlers(t *testing.T) {
+	reg := worker.NewRegistry()
+	// The test servers listen on loopback
+	reg.Register("webhook", worker.NewWebhookFactory([]netip.Prefix{netip.MustParsePrefix("127.0.0.1/32")}))
+	build := func(typ, config string) worker.Handler {
+		h, err := reg.New(model.HandlerSpec{Type: typ, Config: json.RawMessage(config)})
+		require.NoError(t, err)
+		return h
+	}
+	message := func(body string) *worker.Message {
+		return worker.NewMessage("t1", messaging.Delivery{Body: []byte(body), RoutingKey: "t1.order.created"})
+	}
+
+	t.Run("transform", func(t *testing.T) {
+		h := build("transform", `{"set":{"meta":{"v":1},"meta.source":"api"},"remove":["secret","user.password"]}`)
+		m := message(`{"id":1.50,"secret":"x","user":{"name":"a","password":"p"}}`)
+		require.NoError(t, h.Handle(context.Background(), m))
+		require.JSONEq(t, `{"id":1.50,"meta":{"v":1,"source":"api"},"user":{"name":"a"}}`, string(m.Body))
+
+		require.ErrorIs(t, h.Handle(context.Background(), message(`[1]`)), worker.ErrInvalidMessage)
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		h := build("validate", `{"required":["order.id"],"types":{"order.id":"number","note":"string"}}`)
+		require.NoError(t, h.Handle(context.Background(), message(`{"order":{"id":3}}`)))
+		require.ErrorIs(t, h.Handle(context.Background(), message(`{"order":{}}`)), worker.ErrInvalidMessage)
+		require.ErrorIs(t, h.Handle(context.Background(), message(`{"order":{"id":"3"}}`)), worker.ErrInvalidMessage)
+		require.ErrorIs(t, h.Handle(context.Background(), message(`{"order":{"id":3},"note":1}`)), worker.ErrInvalidMessage)
+	})
+
+	t.Run("webhook", func(t *testing.T) {
+		status := http.StatusOK
+		var got *http.Request
+		var body []byte
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = r
+			body, _ = io.ReadAll(r.Body)
+			w.WriteHeader(status)
+		}))
+		defer srv.Close()
+
+		h := build("webhook", `{"url":"`+srv.URL+`","headers":{"Authorization":"Bearer s3cret"}}`)
+		require.NoError(t, h.Handle(context.Background(), message(`{"id":1}`)))
+		require.JSONEq(t, `{"id":1}`, string(body))
+		require.Equal(t, "t1", got.Header.Get("X-Tenant-ID"))
+		require.Equal(t, "order.created", got.Header.Get("X-Event-Type"))
+		require.Equal(t, "Bearer s3cret", got.Header.Get("Authorization"))
+
+		status = http.StatusBadGateway
+		require.Error(t, h.Handle(context.Background(), message(`{"id":1}`)))
+
+		// Internal addresses are refused, directly or through a redirect
+		h, err := worker.NewWebhook(json.RawMessage(`{"url":"` + srv.URL + `"}`))
+		require.NoError(t, err)
+		require.ErrorIs(t, h.Handle(context.Background(), message(`{}`)), worker.ErrForbiddenAddress)
+
+		redirect := httptest.NewServer(http.RedirectHandler("http://127.0.0.2/", http.StatusTemporaryRedirect))
+		defer redirect.Close()
+		h = build("webhook", `{"url":"`+redirect.URL+`"}`)
+		require.ErrorIs(t, h.Handle(context.Background(), message(`{}`)), worker.ErrForbiddenAddress)
+	})
+
+	t.Run("invalid config", func(t *testing.T) {
+		for _, spec := range []model.HandlerSpec{
+			{Type: "webhook", Config: json.RawMessage(`{"url":"ftp://example.com"}`)},
+			{Type: "transform"},
+			{Type: "validate", Config: json.RawMessage(`{"types":{"a":"date"}}`)},
+			{Type: "validate", Config: json.RawMessage(`{"require":["a"]}`)},
+		} {
+			_, err := reg.New(spec)
+			require.ErrorIs(t, err, worker.ErrInvalidHandler, spec.Type)
+		}
+	})
+}
+
+func TestRouter(t *testing.T) {
+	routes, err := worker.NewRegistry().Routes([]model.HandlerRoute{
+		{EventTypes: "order.*", Handlers: []model.HandlerSpec{{Type: "persist"}, {Type: "drop"}}},
+	})
+	require.NoError(t, err)
+	r := worker.NewRouter(worker.Persist{}, routes)
+
+	m := worker.NewMessage("t1", messaging.Delivery{Body: []byte(`{}`), RoutingKey: "t1.order.created"})
+	require.ErrorIs(t, r.Handle(context.Background(), m), worker.ErrDrop)
+
+	// Fanned-out copies are routed by the event type they carry
+	m = worker.NewMessage("t1", messaging.Delivery{Body: []byte(`{}`), RoutingKey: messaging.QueueName("t1"),
+		Headers: map[string]interface{}{messaging.EventTypeHeader: "order.paid"}})
+	require.ErrorIs(t, r.Handle(context.Background(), m), worker.ErrDrop)
+
+	// Unrouted messages go to the fallback
+	m = worker.NewMessage("t1", messaging.Delivery{Body: []byte(`{}`), RoutingKey: "t1.user.created"})
+	require.NoError(t, r.Handle(context.Background(), m))
+	require.NotNil(t, m.Stored)
+
+	_, err = worker.NewRegistry().Routes([]model.HandlerRoute{{EventTypes: "order.*"}})
+	require.ErrorIs(t, err, worker.ErrInvalidHandler)
+}
@@ -0,0 +1,397 @@
+// internal/worker/handlers.go
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// DefaultWebhookTimeout bounds a webhook request when its config sets none
+const DefaultWebhookTimeout = 10 * time.Second
+
+// Persist marks the message to be stored with its body as it is at this
+// step; storing and acking happen once the chain ends
+type Persist struct{}
+
+func (Persist) Handle(_ context.Context, m *Message) error {
+	m.Stored = m.Body
+	return nil
+}
+
+// Drop acks the message without running the rest of the chain
+type Drop struct{}
+
+func (Drop) Handle(context.Context, *Message) error {
+	return ErrDrop
+}
+
+// WebhookConfig configures the webhook handler
+type WebhookConfig struct {
+	URL       string            `json:"url"`
+	Headers   map[string]string `json:"headers,omitempty"`
+	TimeoutMS int64             `json:"timeout_ms,omitempty"`
+}
+
+// Webhook POSTs the message body to a URL, failing unless it answers 2xx.
+// The tenant, event type and message ID are sent as X-Tenant-ID,
+// X-Event-Type and X-Message-ID.
+type Webhook struct {
+	cfg     WebhookConfig
+	timeout time.Duration
+	client  *http.Client
+}
+
+// defaultWebhook builds the webhooks of NewWebhook
+var defaultWebhook = NewWebhookFactory(nil)
+
+// NewWebhook builds a webhook that may only reach public addresses
+func NewWebhook(config json.RawMessage) (Handler, error) {
+	return defaultWebhook(config)
+}
+
+// NewWebhookFactory returns a factory of webhooks that refuse to connect
+// to loopback, private, link-local and other non-public addresses outside
+// allow. The address is checked on every connection, so neither DNS
+// answers nor redirects can point a webhook at an internal service.
+func NewWebhookFactory(allow []netip.Prefix) Factory {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	// A proxy would be dialled instead of the webhook host
+	transport.Proxy = nil
+	transport.DialContext = (&net.Dialer{
+		Timeout:   30 * time.Second,
+		KeepAlive: 30 * time.Second,
+		Control:   webhookControl(allow),
+	}).DialContext
+	client := &http.Client{Transport: transport}
+
+	return func(config json.RawMessage) (Handler, error) {
+		return newWebhook(config, client)
+	}
+}
+
+// webhookControl refuses connections to non-public addresses outside
+// allow
+func webhookControl(allow []netip.Prefix) func(network, address string, _ syscall.RawConn) error {
+	return func(_, address string, _ syscall.RawConn) error {
+		ap, err := netip.ParseAddrPort(address)
+		if err != nil {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, address)
+		}
+		ip := ap.Addr().Unmap()
+		for _, p := range allow {
+			if p.Contains(ip) {
+				return nil
+			}
+		}
+		if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+			return fmt.Errorf("%w: %s", ErrForbiddenAddress, ip)
+		}
+		return nil
+	}
+}
+
+func newWebhook(config json.RawMessage, client *http.Client) (Handler, error) {
+	var cfg WebhookConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("url must be an absolute http(s) URL, got %q", cfg.URL)
+	}
+	if cfg.TimeoutMS < 0 {
+		return nil, errors.New("timeout_ms must not be negative")
+	}
+
+	timeout := DefaultWebhookTimeout
+	if cfg.TimeoutMS > 0 {
+		timeout = time.Duration(cfg.TimeoutMS) * time.Millisecond
+	}
+	return &Webhook{cfg: cfg, timeout: timeout, client: client}, nil
+}
+
+func (w *Webhook) Handle(ctx context.Context, m *Message) error {
+	ctx, cancel := context.WithTimeout(ctx, w.timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.cfg.URL, bytes.NewReader(m.Body))
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	contentType := m.Delivery.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Tenant-ID", m.TenantID)
+	req.Header.Set("X-Event-Type", m.EventType)
+	if m.Delivery.MessageID != "" {
+		req.Header.Set("X-Message-ID", m.Delivery.MessageID)
+	}
+	for k, v := range w.cfg.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s answered %s", w.cfg.URL, resp.Status)
+	}
+	return nil
+}
+
+// TransformConfig configures the transform handler. Paths are
+// dot-separated object fields with an optional "$." prefix.
+type TransformConfig struct {
+	// Set assigns values at paths, creating missing objects on the way
+	Set map[string]json.RawMessage `json:"set,omitempty" swaggertype:"object"`
+	// Remove deletes the fields at paths; missing ones are ignored
+	Remove []string `json:"remove,omitempty"`
+}
+
+// Transform rewrites a JSON object body. Removals apply before values are
+// set; messages whose body is not an object are rejected.
+type Transform struct {
+	set    []setField // by path, so parents are set before their fields
+	remove [][]string
+}
+
+type setField struct {
+	fields []string
+	value  json.RawMessage
+}
+
+func NewTransform(config json.RawMessage) (Handler, error) {
+	var cfg TransformConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if len(cfg.Set) == 0 && len(cfg.Remove) == 0 {
+		return nil, errors.New("set or remove is required")
+	}
+
+	paths := make([]string, 0, len(cfg.Set))
+	for path := range cfg.Set {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	t := &Transform{}
+	for _, path := range paths {
+		fields, ok := splitPath(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		if !json.Valid(cfg.Set[path]) {
+			return nil, fmt.Errorf("invalid value for %q", path)
+		}
+		t.set = append(t.set, setField{fields: fields, value: cfg.Set[path]})
+	}
+	for _, path := range cfg.Remove {
+		fields, ok := splitPath(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		t.remove = append(t.remove, fields)
+	}
+	return t, nil
+}
+
+func (t *Transform) Handle(_ context.Context, m *Message) error {
+	doc, err := decodeObject(m.Body)
+	if err != nil {
+		return err
+	}
+
+	for _, fields := range t.remove {
+		parent, ok := lookup(doc, fields[:len(fields)-1]).(map[string]interface{})
+		if ok {
+			delete(parent, fields[len(fields)-1])
+		}
+	}
+	for _, sf := range t.set {
+		obj := doc
+		for _, f := range sf.fields[:len(sf.fields)-1] {
+			next, ok := obj[f].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				obj[f] = next
+			}
+			obj = next
+		}
+		// Decoded afresh for each message, which may go on to change it
+		var v interface{}
+		dec := json.NewDecoder(bytes.NewReader(sf.value))
+		dec.UseNumber()
+		if err := dec.Decode(&v); err != nil {
+			return fmt.Errorf("transform: %w", err)
+		}
+		obj[sf.fields[len(sf.fields)-1]] = v
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("transform: %w", err)
+	}
+	m.Body = body
+	return nil
+}
+
+// ValidateConfig configures the validate handler
+type ValidateConfig struct {
+	// Required paths must be present
+	Required []string `json:"required,omitempty"`
+	// Types maps paths to the JSON type their values must have, if
+	// present: string, number, boolean, object, array or null
+	Types map[string]string `json:"types,omitempty"`
+	// MaxBytes caps the body size; zero leaves it unlimited
+	MaxBytes int `json:"max_bytes,omitempty"`
+}
+
+// Validate rejects messages whose body is not a JSON object meeting its
+// config, wrapping ErrInvalidMessage
+type Validate struct {
+	required map[string][]string
+	types    map[string][]string
+	cfg      ValidateConfig
+}
+
+func NewValidate(config json.RawMessage) (Handler, error) {
+	var cfg ValidateConfig
+	if err := decodeConfig(config, &cfg); err != nil {
+		return nil, err
+	}
+	if cfg.MaxBytes < 0 {
+		return nil, errors.New("max_bytes must not be negative")
+	}
+
+	v := &Validate{
+		required: make(map[string][]string, len(cfg.Required)),
+		types:    make(map[string][]string, len(cfg.Types)),
+		cfg:      cfg,
+	}
+	for _, path := range cfg.Required {
+		fields, ok := splitPath(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		v.required[path] = fields
+	}
+	for path, typ := range cfg.Types {
+		fields, ok := splitPath(path)
+		if !ok {
+			return nil, fmt.Errorf("invalid path %q", path)
+		}
+		switch typ {
+		case "string", "number", "boolean", "object", "array", "null":
+		default:
+			return nil, fmt.Errorf("unknown type %q for %q", typ, path)
+		}
+		v.types[path] = fields
+	}
+	return v, nil
+}
+
+func (v *Validate) Handle(_ context.Context, m *Message) error {
+	if v.cfg.MaxBytes > 0 && len(m.Body) > v.cfg.MaxBytes {
+		return fmt.Errorf("%w: body of %d bytes exceeds %d", ErrInvalidMessage, len(m.Body), v.cfg.MaxBytes)
+	}
+	doc, err := decodeObject(m.Body)
+	if err != nil {
+		return err
+	}
+
+	for path, fields := range v.required {
+		if !has(doc, fields) {
+			return fmt.Errorf("%w: %s is required", ErrInvalidMessage, path)
+		}
+	}
+	for path, fields := range v.types {
+		if !has(doc, fields) {
+			continue
+		}
+		if got := jsonType(lookup(doc, fields)); got != v.cfg.Types[path] {
+			return fmt.Errorf("%w: %s is %s, want %s", ErrInvalidMessage, path, got, v.cfg.Types[path])
+		}
+	}
+	return nil
+}
+
+// decodeConfig decodes a handler's config strictly; a missing config
+// leaves cfg zero
+func decodeConfig(config json.RawMessage, cfg interface{}) error {
+	if len(config) == 0 || string(config) == "null" {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(config))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(cfg); err != nil {
+		return fmt.Errorf("bad config: %w", err)
+	}
+	return nil
+}
+
+// decodeObject decodes a JSON object body, keeping numbers as written
+func decodeObject(body []byte) (map[string]interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var doc map[string]interface{}
+	if err := dec.Decode(&doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("%w: body is not a JSON object", ErrInvalidMessage)
+	}
+	return doc, nil
+}
+
+// lookup returns the value at fields, or nil if it is missing
+func lookup(doc interface{}, fields []string) interface{} {
+	for _, f := range fields {
+		obj, ok := doc.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		doc = obj[f]
+	}
+	return doc
+}
+
+// has reports whether fields lead to a value, which may be null
+func has(doc map[string]interface{}, fields []string) bool {
+	parent, ok := lookup(doc, fields[:len(fields)-1]).(map[string]interface{})
+	if !ok {
+		return false
+	}
+	_, ok = parent[fields[len(fields)-1]]
+	return ok
+}
+
+func jsonType(v interface{}) string {
+	switch v.(type) {
+	case string:
+		return "string"
+	case json.Number:
+		return "number"
+	case bool:
+		return "boolean"
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return "null"
+}
@@ -0,0 +1,93 @@
+// internal/worker/key.go
+package worker
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"multi-tenant/internal/messaging"
+	"multi-tenant/internal/model"
+)
+
+var ErrInvalidOrderingKey = errors.New("invalid ordering key")
+
+// KeyFunc returns the ordering key of a delivery, or "" if it has none
+type KeyFunc func(d messaging.Delivery) string
+
+// NewKeyFunc builds the KeyFunc for a tenant's ordering setting; nil
+// selects the messaging.OrderingKeyHeader header
+func NewKeyFunc(cfg *model.OrderingKey) (KeyFunc, error) {
+	switch {
+	case cfg == nil:
+		return HeaderKey(messaging.OrderingKeyHeader), nil
+	case cfg.Header != "" && cfg.JSONPath != "":
+		return nil, fmt.Errorf("%w: set either header or json_path", ErrInvalidOrderingKey)
+	case cfg.Header != "":
+		return HeaderKey(cfg.Header), nil
+	case cfg.JSONPath != "":
+		return JSONPathKey(cfg.JSONPath)
+	}
+	return nil, fmt.Errorf("%w: header or json_path is required", ErrInvalidOrderingKey)
+}
+
+// HeaderKey reads the ordering key from a message header
+func HeaderKey(name string) KeyFunc {
+	return func(d messaging.Delivery) string {
+		v, ok := d.Headers[name]
+		if !ok || v == nil {
+			return ""
+		}
+		return fmt.Sprint(v)
+	}
+}
+
+// JSONPathKey reads the ordering key from the payload at a dot-separated
+// path of object fields, with an optional "$." prefix. Strings are used
+// as they are and other scalars as their JSON text; objects, arrays,
+// missing fields and invalid payloads yield no key.
+func JSONPathKey(path string) (KeyFunc, error) {
+	fields, ok := splitPath(path)
+	if !ok {
+		return nil, fmt.Errorf("%w: json_path %q", ErrInvalidOrderingKey, path)
+	}
+
+	return func(d messaging.Delivery) string {
+		dec := json.NewDecoder(bytes.NewReader(d.Body))
+		dec.UseNumber()
+		var v interface{}
+		if err := dec.Decode(&v); err != nil {
+			return ""
+		}
+		for _, f := range fields {
+			obj, ok := v.(map[string]interface{})
+			if !ok {
+				return ""
+			}
+			v = obj[f]
+		}
+		switch v := v.(type) {
+		case string:
+			return v
+		case json.Number:
+			return v.String()
+		case bool:
+			return fmt.Sprint(v)
+		}
+		return ""
+	}, nil
+}
+
+// splitPath splits a dot-separated path of object fields with an optional
+// "$." prefix, reporting whether every field is named
+func splitPath(path string) ([]string, bool) {
+	fields := strings.Split(strings.TrimPrefix(path, "$."), ".")
+	for _, f := range fields {
+		if f == "" {
+			return nil, false
+		}
+	}
+	return fields, true
+}
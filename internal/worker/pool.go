@@ -1,73 +1,87 @@
 package worker
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"log"
 
-	"github.com/streadway/amqp"
-
 	"multi-tenant/internal/messaging"
 	"multi-tenant/internal/metrics"
 )
 
 type WorkerPool struct {
 	tenantID string
-	conn     *amqp.Connection
-	ch       *amqp.Channel
+	broker   messaging.Broker
 	stopCh   chan struct{}
 	workers  int
+	key      KeyFunc
+	handler  Handler
 }
 
-func NewWorkerPool(tenantID string, rabbit *messaging.RabbitClient, workerCount int) *WorkerPool {
+// NewWorkerPool creates a pool of workerCount lanes; messages sharing an
+// x-ordering-key header are processed in order, see SetKey
+func NewWorkerPool(tenantID string, broker messaging.Broker, workerCount int) *WorkerPool {
 	return &WorkerPool{
 		tenantID: tenantID,
-		conn:     rabbit.GetConnection(),
-		ch:       rabbit.GetChannel(),
+		broker:   broker,
 		stopCh:   make(chan struct{}),
 		workers:  workerCount,
+		key:      HeaderKey(messaging.OrderingKeyHeader),
+		handler:  logHandler{},
 	}
 }
 
+// SetHandler sets what processes the pool's messages, by default logging
+// their decoded payload. The pool has no store, so Persist has no effect.
+// It applies from the next Start.
+func (wp *WorkerPool) SetHandler(h Handler) {
+	wp.handler = h
+}
+
+// SetKey sets how ordering keys are read; it applies from the next Start
+func (wp *WorkerPool) SetKey(key KeyFunc) {
+	wp.key = key
+}
+
 func (wp *WorkerPool) Start() {
 	log.Printf("[Worker] Starting pool for tenant %s", wp.tenantID)
 
-	msgs, err := wp.ch.Consume(
-		"tenant_"+wp.tenantID+"_queue",
-		"",
-		false, // manual ack
-		false,
-		false,
-		false,
-		nil,
-	)
+	sub, err := wp.broker.Consume(wp.tenantID)
 	if err != nil {
 		log.Fatalf("Failed to register consumer: %v", err)
 	}
+	msgs := sub.Deliveries()
+
+	handler := wp.handler
+	lanes := NewDispatcher(wp.workers, wp.key, func(msg messaging.Delivery) {
+		if err := wp.handleMessage(handler, msg); err != nil {
+			log.Printf("Failed to process message: %v", err)
+			_ = msg.Nack(false, false) // send to DLQ
+			return
+		}
+
+		_ = msg.Ack(false)
+		metrics.WorkerProcessed.WithLabelValues(wp.tenantID).Inc()
+	})
+	stopCh := wp.stopCh
 
 	go func() {
-		metrics.WorkerActive.WithLabelValues(wp.tenantID).Add(1)
-		defer metrics.WorkerActive.WithLabelValues(wp.tenantID).Sub(1)
+		metrics.WorkerActive.WithLabelValues(wp.tenantID).Add(float64(lanes.Lanes()))
+		defer metrics.WorkerActive.WithLabelValues(wp.tenantID).Sub(float64(lanes.Lanes()))
+		defer sub.Cancel()
+		defer lanes.Stop()
 
 		for {
 			select {
-			case <-wp.stopCh:
+			case <-stopCh:
 				log.Printf("[Worker] Stopping pool for tenant %s", wp.tenantID)
 				return
 			case msg, ok := <-msgs:
 				if !ok {
 					return
 				}
-
-				// Simulate processing
-				err := wp.handleMessage(msg)
-				if err != nil {
-					log.Printf("Failed to process message: %v", err)
-					_ = msg.Reject(false) // send to DLQ
-					continue
-				}
-
-				_ = msg.Ack(false)
-				metrics.WorkerProcessed.WithLabelValues(wp.tenantID).Inc()
+				lanes.Dispatch(msg)
 			}
 		}
 	}()
@@ -77,14 +91,26 @@ func (wp *WorkerPool) Stop() {
 	close(wp.stopCh)
 }
 
-func (wp *WorkerPool) handleMessage(msg amqp.Delivery) error {
-	// Simulate decoding JSON payload
+// handleMessage runs a delivery through handler; a dropped message counts
+// as processed
+func (wp *WorkerPool) handleMessage(handler Handler, msg messaging.Delivery) error {
+	err := handler.Handle(context.Background(), NewMessage(wp.tenantID, msg))
+	if errors.Is(err, ErrDrop) {
+		return nil
+	}
+	return err // will trigger DLQ if nacked without requeue
+}
+
+// logHandler logs the decoded JSON payload of each message
+type logHandler struct{}
+
+func (logHandler) Handle(_ context.Context, m *Message) error {
 	var payload map[string]interface{}
-	if err := json.Unmarshal(msg.Body, &payload); err != nil {
+	if err := json.Unmarshal(m.Body, &payload); err != nil {
 		log.Printf("[Worker] Failed to parse message: %v", err)
-		return err // will trigger DLQ if reject(false)
+		return err
 	}
-	log.Printf("[Worker] Tenant %s processed message: %v", wp.tenantID, payload)
+	log.Printf("[Worker] Tenant %s processed message: %v", m.TenantID, payload)
 	return nil
 }
 